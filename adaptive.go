@@ -0,0 +1,80 @@
+package main
+
+import (
+	"log"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// adaptiveLadder is the sequence of behaviors adaptive.<base> escalates
+// through, from mildly annoying to nasty. Each entry is a name relative to
+// -base that the query is served as.
+var adaptiveLadder = []string{
+	"800.sleep",
+	"3000.sleep",
+	"splitudp",
+	"tc-txt.preset",
+	"manycuts",
+	"cnamepit",
+}
+
+const (
+	// adaptiveRetryWindow is how soon a client must ask again for us to
+	// consider it a retry of the same query.
+	adaptiveRetryWindow = 5 * time.Second
+	// adaptiveMemory is how long we remember a client and name.
+	adaptiveMemory = 10 * time.Minute
+)
+
+// adaptiveState holds, for each client and name, the current rung of the
+// ladder under "<key>|level" and the time of the last query, in Unix
+// nanoseconds, under "<key>|seen" and the transport it used under
+// "<key>|tcp".
+var adaptiveState = newCounters("adaptive")
+
+// adaptiveHandler (experimental) watches how a client reacts to the behavior
+// it was served for a name. If it retries soon, or falls back from UDP to
+// TCP, the next query for that name gets the next nastier behavior from
+// adaptiveLadder. Every escalation is logged, so the log shows how far down
+// the ladder each resolver was willing to go. Giving up isn't detected: a
+// client that never asks for the name again is neither logged nor acted on,
+// and the rung it reached is just forgotten after adaptiveMemory.
+func adaptiveHandler(w dns.ResponseWriter, q *dns.Msg) {
+	logQuery(w, q, "adaptiveHandler")
+	client := clientIP(w)
+	key := client + "|" + strings.ToLower(qname(q))
+	now := time.Now()
+	tcp := int64(0)
+	if w.RemoteAddr().Network() == "tcp" {
+		tcp = 1
+	}
+
+	level, _ := adaptiveState.get(key + "|level")
+	if seen, ok := adaptiveState.get(key + "|seen"); ok {
+		elapsed := now.Sub(time.Unix(0, seen))
+		wasTCP, _ := adaptiveState.get(key + "|tcp")
+		reaction := ""
+		switch {
+		case tcp == 1 && wasTCP == 0:
+			reaction = "fell back to TCP"
+		case elapsed < adaptiveRetryWindow:
+			reaction = "retried"
+		}
+		if reaction != "" && int(level) < len(adaptiveLadder)-1 {
+			log.Printf("adaptive: %s %s for %q after %s against %s, escalating to %s",
+				client, reaction, qname(q), elapsed.Round(time.Millisecond),
+				adaptiveLadder[level], adaptiveLadder[level+1])
+			level++
+		} else if reaction == "" {
+			log.Printf("adaptive: %s came back for %q after %s, staying at %s",
+				client, qname(q), elapsed.Round(time.Millisecond), adaptiveLadder[level])
+		}
+	}
+	adaptiveState.set(key+"|level", level, adaptiveMemory)
+	adaptiveState.set(key+"|seen", now.UnixNano(), adaptiveMemory)
+	adaptiveState.set(key+"|tcp", tcp, adaptiveMemory)
+
+	serveAs(w, q, dns.Fqdn(adaptiveLadder[level]+"."+*basename))
+}
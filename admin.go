@@ -0,0 +1,32 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// serveAdmin runs the HTTP admin API on addr. It should only ever be exposed
+// to the people running tests against this instance.
+func serveAdmin(addr string) error {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ghost", ghostAdminHandler)
+	mux.HandleFunc("/stats", statsAdminHandler)
+	mux.HandleFunc("/overrides", overridesAdminHandler)
+	mux.HandleFunc("/sessions", sessionsAdminHandler)
+	mux.HandleFunc("/quarantine", quarantineAdminHandler)
+	mux.HandleFunc("/ephemeral", ephemeralAdminHandler)
+	mux.HandleFunc("/capabilities", capabilitiesAdminHandler)
+	mux.HandleFunc("/cluster", clusterAdminHandler)
+	mux.HandleFunc("/monitored", monitoredAdminHandler)
+	return http.ListenAndServe(addr, mux)
+}
+
+// requirePost writes an error and returns false if r isn't a POST.
+func requirePost(w http.ResponseWriter, r *http.Request) bool {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, fmt.Sprintf("%s not allowed", r.Method), http.StatusMethodNotAllowed)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"net/netip"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+var asnDB = flag.String("asn-db", "", "routeviews prefix-to-AS file (pfx2as format) used to attribute clients to ASNs.")
+
+// asnTable maps prefixes to origin ASNs, as loaded from -asn-db.
+type asnTable struct {
+	prefixes map[netip.Prefix]string
+	// lengths are the distinct prefix lengths in prefixes, longest first.
+	lengths []int
+}
+
+// asns is nil unless -asn-db was given.
+var asns *asnTable
+
+// loadASNTable reads a routeviews pfx2as file, which has one
+// "<address>\t<length>\t<asn>" line per prefix.
+func loadASNTable(path string) (*asnTable, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	t := &asnTable{prefixes: make(map[netip.Prefix]string)}
+	seen := make(map[int]bool)
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 3 {
+			continue
+		}
+		addr, err := netip.ParseAddr(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %s", path, line, err)
+		}
+		bits, err := strconv.Atoi(fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %s", path, line, err)
+		}
+		prefix, err := addr.Prefix(bits)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %s", path, line, err)
+		}
+		t.prefixes[prefix] = fields[2]
+		if !seen[bits] {
+			seen[bits] = true
+			t.lengths = append(t.lengths, bits)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(t.lengths)))
+	return t, nil
+}
+
+// lookup returns the origin ASN of the longest prefix containing ip, or
+// "unknown".
+func (t *asnTable) lookup(ip string) string {
+	if t == nil {
+		return "unknown"
+	}
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return "unknown"
+	}
+	addr = addr.Unmap()
+	for _, bits := range t.lengths {
+		if bits > addr.BitLen() {
+			continue
+		}
+		prefix, err := addr.Prefix(bits)
+		if err != nil {
+			continue
+		}
+		if asn, ok := t.prefixes[prefix]; ok {
+			return asn
+		}
+	}
+	return "unknown"
+}
+
+// histogramBounds are the upper bounds, in milliseconds, of the response time
+// histogram buckets. The last bucket catches everything slower.
+var histogramBounds = []float64{1, 5, 10, 50, 100, 500, 1000, 5000}
+
+// usage counts what one handler has done for one population of clients.
+type usage struct {
+	Queries uint64 `json:"queries"`
+	// Retries counts queries repeating the same question from the same
+	// client within retryWindow.
+	Retries uint64 `json:"retries"`
+	// Histogram counts responses by time taken, using histogramBounds.
+	Histogram []uint64 `json:"histogram_ms"`
+}
+
+func (u *usage) record(elapsed time.Duration, retry bool) {
+	if u.Histogram == nil {
+		u.Histogram = make([]uint64, len(histogramBounds)+1)
+	}
+	u.Queries++
+	if retry {
+		u.Retries++
+	}
+	ms := float64(elapsed) / float64(time.Millisecond)
+	i := sort.SearchFloat64s(histogramBounds, ms)
+	u.Histogram[i]++
+}
+
+// retryWindow is how soon a repeated question counts as a retry.
+const retryWindow = 5 * time.Second
+
+var (
+	statsMu sync.Mutex
+	// handlerStats is keyed by handler name.
+	handlerStats = make(map[string]*usage)
+	// asnStats is keyed by ASN and then handler name.
+	asnStats = make(map[string]map[string]*usage)
+	// recentQuestions remembers recent (client, question) pairs to spot
+	// retries.
+	recentQuestions = newCounters("retries")
+)
+
+// recordQuery accounts for one query that took elapsed to handle, and reports
+// whether it was a retry.
+func recordQuery(client, handler string, q *dns.Msg, elapsed time.Duration) bool {
+	if handler == "" {
+		handler = "unknown"
+	}
+	retry := false
+	if len(q.Question) > 0 {
+		question := q.Question[0]
+		key := fmt.Sprintf("%s|%s|%d", client, strings.ToLower(question.Name), question.Qtype)
+		retry = recentQuestions.incr(key, retryWindow) > 1
+	}
+	asn := asns.lookup(client)
+
+	statsMu.Lock()
+	defer statsMu.Unlock()
+	if handlerStats[handler] == nil {
+		handlerStats[handler] = new(usage)
+	}
+	handlerStats[handler].record(elapsed, retry)
+	if asnStats[asn] == nil {
+		asnStats[asn] = make(map[string]*usage)
+	}
+	if asnStats[asn][handler] == nil {
+		asnStats[asn][handler] = new(usage)
+	}
+	asnStats[asn][handler].record(elapsed, retry)
+	return retry
+}
+
+// statsAdminHandler exports the per-handler and per-ASN statistics, and the
+// handlers that panicked, as JSON.
+func statsAdminHandler(w http.ResponseWriter, r *http.Request) {
+	quarantined := quarantineSnapshot()
+	statsMu.Lock()
+	body, err := json.MarshalIndent(struct {
+		HistogramBounds []float64                    `json:"histogram_bounds_ms"`
+		Handlers        map[string]*usage            `json:"handlers"`
+		ASNs            map[string]map[string]*usage `json:"asns"`
+		Quarantine      map[string]quarantineRecord  `json:"quarantine"`
+	}{histogramBounds, handlerStats, asnStats, quarantined}, "", "  ")
+	statsMu.Unlock()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(body)
+}
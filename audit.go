@@ -0,0 +1,101 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// auditPageSize is how many queries each page of an audit lists.
+const auditPageSize = 10
+
+// auditHandler serves TXT records under audit.<base> describing a session,
+// for testers who can only reach this server over DNS. Since the session
+// token is taken out of the name like anywhere else, the handler sees the
+// session on the responseWriter. <token>.audit.<base> summarizes the session,
+// and <page>.<token>.audit.<base> lists the queries it logged, oldest first,
+// auditPageSize per page starting at page 1. Queries under audit.<base> are
+// not logged in the session themselves.
+func auditHandler(w dns.ResponseWriter, q *dns.Msg) {
+	logQuery(w, q, "auditHandler")
+	rw, ok := w.(*responseWriter)
+	if !ok || rw.session == nil {
+		txtError(w, q, "query [<page>.]<token>.audit.<base> with the token of a live session")
+		return
+	}
+	labels := subLabels(qname(q), zone("audit"))
+	page := 0
+	if len(labels) > 0 {
+		var err error
+		if page, err = strconv.Atoi(labels[len(labels)-1]); err != nil || page < 0 {
+			txtError(w, q, "query [<page>.]<token>.audit.<base> with page a number")
+			return
+		}
+	}
+	m := new(dns.Msg)
+	m.SetRcode(q, dns.RcodeSuccess)
+	m.Authoritative = true
+	if q.Question[0].Qtype != dns.TypeTXT {
+		m.Ns = []dns.RR{soaRecord(zone("audit"))}
+		w.WriteMsg(m)
+		return
+	}
+	lines := auditLines(rw.session, page)
+	if lines == nil {
+		m.SetRcode(q, dns.RcodeNameError)
+		m.Authoritative = true
+		m.Ns = []dns.RR{soaRecord(zone("audit"))}
+		w.WriteMsg(m)
+		return
+	}
+	for i, line := range lines {
+		if len(line) > 255 {
+			lines[i] = line[:255]
+		}
+	}
+	m.Answer = []dns.RR{&dns.TXT{
+		Hdr: dns.RR_Header{Name: qname(q), Rrtype: dns.TypeTXT, Class: dns.ClassINET},
+		Txt: lines,
+	}}
+	w.WriteMsg(m)
+}
+
+// auditLines returns the lines of the given page of the audit of s, page 0
+// being the summary, or nil if there is no such page.
+func auditLines(s *session, page int) []string {
+	sessionsMu.Lock()
+	defer sessionsMu.Unlock()
+	pages := (len(s.queries) + auditPageSize - 1) / auditPageSize
+	if page == 0 {
+		lines := []string{
+			fmt.Sprintf("token=%s created=%s expires=%s", s.token, s.created.UTC().Format(time.RFC3339), s.expires.UTC().Format(time.RFC3339)),
+			fmt.Sprintf("queries=%d not_logged=%d pages=%d", len(s.queries)+s.dropped, s.dropped, pages),
+		}
+		var handlers []string
+		for handler := range s.stats {
+			handlers = append(handlers, handler)
+		}
+		sort.Strings(handlers)
+		for _, handler := range handlers {
+			u := s.stats[handler]
+			lines = append(lines, fmt.Sprintf("handler=%s queries=%d retries=%d", handler, u.Queries, u.Retries))
+		}
+		return lines
+	}
+	if page > pages {
+		return nil
+	}
+	lines := []string{fmt.Sprintf("page %d of %d", page, pages)}
+	for _, r := range s.queries[(page-1)*auditPageSize : min(page*auditPageSize, len(s.queries))] {
+		rcode := r.Rcode
+		if rcode == "" {
+			rcode = "none"
+		}
+		lines = append(lines, fmt.Sprintf("%s %s %s %s %s %s %s responses=%d %.1fms",
+			r.Time.UTC().Format("15:04:05.000"), r.Client, r.Transport, r.Name, r.Type, r.Handler, rcode, r.Responses, r.ElapsedMS))
+	}
+	return lines
+}
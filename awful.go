@@ -1,55 +1,318 @@
 package main
 
 import (
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/hex"
 	"flag"
+	"fmt"
 	"log"
+	"math/rand/v2"
 	"net"
+	"net/http"
+	"os"
 	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/miekg/dns"
 )
 
-var ip = flag.String("ip", "127.0.0.1", "ip address of this server")
-var listen = flag.String("listen", ":1053", "port to listen on")
+var ip = flag.String("ip", "127.0.0.1", "deprecated: use -advertise-ip.")
+var advertiseIP = flag.String("advertise-ip", "", "IPv4 address this server is reachable at from the outside, used in A records and glue. Defaults to -ip.")
+var advertiseIP6 = flag.String("advertise-ip6", "", "IPv6 address this server is reachable at from the outside, used in AAAA records and glue. If empty, no AAAA records are served.")
+var listen = flag.String("listen", ":1053", "comma separated addresses to listen on. On multi-homed hosts, list each local address so that every packet leaves from the address it relates to.")
 var basename = flag.String("base", "example.com", "domain on which this is configured in the public DNS.")
+var matrixDelays = flag.String("matrix-delays", "A=0,AAAA=200,HTTPS=400,SVCB=400,MX=600,TXT=800",
+	"comma separated TYPE=milliseconds delays used by matrix.<base>; unlisted types are not delayed.")
+var adminListen = flag.String("admin-listen", "", "address for the HTTP admin API, e.g. 127.0.0.1:8053. Disabled if empty.")
+var lab = flag.Bool("lab", false, "enable handlers that send packets to places other than the querier's address and port. Only use this on closed test networks.")
+
+// mux routes queries to handlers by the subtree of -base they fall in.
+var mux = dns.NewServeMux()
+
+// udpConns are the sockets UDP queries arrive on, one per -listen address.
+// Handlers that need to send datagrams of their own use them, so that those
+// come from the expected address.
+var udpConns []net.PacketConn
+
+// advertise4 and advertise6 are the addresses put into A and AAAA records
+// pointing at this server. advertise6 is nil if there is none.
+var advertise4, advertise6 net.IP
+
+// qtypeDelays holds the parsed value of -matrix-delays.
+var qtypeDelays map[uint16]time.Duration
 
 func main() {
 	flag.Parse()
+	if flag.Arg(0) == "manifest" {
+		if err := writeManifest(os.Stdout, flag.Args()[1:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	if flag.Arg(0) == "verify-delegation" {
+		if err := verifyDelegation(os.Stdout, flag.Args()[1:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	var err error
+	qtypeDelays, err = parseQtypeDelays(*matrixDelays)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := parseOptionFlags(); err != nil {
+		log.Fatal(err)
+	}
+	if err := parseJitterFlags(); err != nil {
+		log.Fatal(err)
+	}
+	if err := checkTCPPolicy(); err != nil {
+		log.Fatal(err)
+	}
+	if err := parseMigrateNS(); err != nil {
+		log.Fatal(err)
+	}
+	if err := parseFlap(); err != nil {
+		log.Fatal(err)
+	}
+	if err := openRedis(); err != nil {
+		log.Fatal(err)
+	}
+	if *asnDB != "" {
+		asns, err = loadASNTable(*asnDB)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if err := parseWebhooks(); err != nil {
+		log.Fatal(err)
+	}
+	if *scenarioFile != "" {
+		scenarios, err = loadScenarios(*scenarioFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if *responsesDB != "" {
+		replayDB, err = openResponses(*responsesDB)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
 
-	mux := dns.NewServeMux()
+	if err := parseAdvertised(); err != nil {
+		log.Fatal(err)
+	}
+	if err := serveReverse(); err != nil {
+		log.Fatal(err)
+	}
+	if err := serveBehaviorZone(); err != nil {
+		log.Fatal(err)
+	}
+	if err := generateZoneKey(); err != nil {
+		log.Fatal(err)
+	}
+	if err := joinCluster(); err != nil {
+		log.Fatal(err)
+	}
+	if err := parseClockOffsets(); err != nil {
+		log.Fatal(err)
+	}
 
-	udpServer := &dns.Server{
-		Addr:    *listen,
-		Net:     "udp",
-		Handler: mux,
+	var servers []*dns.Server
+	for _, addr := range strings.Split(*listen, ",") {
+		udpConn, err := net.ListenPacket("udp", addr)
+		if err != nil {
+			log.Fatal(err)
+		}
+		udpConns = append(udpConns, udpConn)
+		tcpListener, err := listenTCP(addr)
+		if err != nil {
+			log.Fatal(err)
+		}
+		servers = append(servers, &dns.Server{
+			PacketConn: udpConn,
+			Handler:    dns.HandlerFunc(serveQuery),
+		}, tcpServer(tcpListener))
 	}
-	tcpServer := &dns.Server{
-		Addr:    *listen,
-		Net:     "tcp",
-		Handler: mux,
+
+	if *tlsListen != "" {
+		server, err := dotServer(*tlsListen)
+		if err != nil {
+			log.Fatal(err)
+		}
+		servers = append(servers, server)
+	}
+
+	var dohSrv *http.Server
+	var dohListener net.Listener
+	if *httpsListen != "" {
+		dohSrv, err = dohServer(*httpsListen)
+		if err != nil {
+			log.Fatal(err)
+		}
+		dohListener, err = listenTCP(*httpsListen)
+		if err != nil {
+			log.Fatal(err)
+		}
 	}
 
-	mux.HandleFunc("cnamepit."+*basename, cnamePitHandler)
-	mux.HandleFunc("manycuts."+*basename, manyCutsHandler)
-	mux.HandleFunc("sleep."+*basename, sleepHandler)
-	mux.HandleFunc(".", unknownHandler)
+	var dtlsSrv *dtlsServer
+	if *dtlsListen != "" {
+		dtlsSrv, err = newDTLSServer(*dtlsListen)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	handle("cnamepit", disarming("cnamepit", cnamePitHandler))
+	handle("manycuts", disarming("manycuts", manyCutsHandler))
+	handle("sleep", sleepHandler)
+	handle("preset", presetHandler)
+	handle("matrix", matrixHandler)
+	handle("splitudp", splitUDPHandler)
+	handle("wrongport", wrongPortHandler)
+	handle("stalens", staleNSHandler)
+	handle("ghost", ghostHandler)
+	handle("entbug", entBugHandler)
+	handle("crossdup", crossDupHandler)
+	handle("adaptive", adaptiveHandler)
+	handle("ttlskew", ttlSkewHandler)
+	handle("occluded", occludedHandler)
+	handle("disagree", disagreeHandler)
+	handle("infwild", infWildHandler)
+	handle("giant", giantHandler)
+	handle("lenbug", lenBugHandler)
+	handle("encode", encodeHandler)
+	handle("wrongclass", wrongClassHandler)
+	handle("ns", nsHandler)
+	handle("scenario", scenarioHandler)
+	handle("nthtry", nthTryHandler)
+	handle("ednsdiff", ednsDiffHandler)
+	handle("qps", qpsHandler)
+	for _, name := range signedZones {
+		handle(name, signedZoneHandler(name))
+	}
+	handle("crosssign", crossSignHandler)
+	handle("dots", dotsHandler)
+	handle("ephemeral", ephemeralHandler)
+	handle("migrate", migrateHandler)
+	handle("blackhole", blackholeHandler)
+	handle("interleave", interleaveHandler)
+	handle("cnameloop", cnameLoopHandler)
+	handle("truncate", truncateHandler)
+	handle("nsanswer", nsAnswerHandler)
+	handle("malformed", malformedHandler)
+	handle("cluster", clusterHandler)
+	handle("comploop", compLoopHandler)
+	handle("glueless", gluelessHandler)
+	handle("audit", auditHandler)
+	handle("lame", lameHandler)
+	handle("badid", badIDHandler)
+	handle("multisoa", multiSOAHandler)
+	handle("poison", poisonHandler)
+	handle("selfcut", selfCutHandler)
+	handle("edns", ednsHandler)
+	handle("badednsflags", badEDNSFlagsHandler)
+	handle("bigudp", locked(bigUDPHandler))
+	handle("trickle", trickleHandler)
+	handle("tcpreset", tcpResetHandler)
+	handle("decrement", decrementHandler)
+	handle("dupes", locked(dupesHandler))
+	handle("latereply", lateReplyHandler)
+	handle("flaky", flakyHandler)
+	handle("parity", parityHandler)
+	handle("failfirst", failFirstHandler)
+	handle("rcode", rcodeHandler)
+	handle("report", reportHandler)
+	handle("broken-but-monitored", monitoredHandler)
+	handle("inconsistent", inconsistentHandler)
+	handle("unlock", unlockHandler)
+	handle("ttl", ttlHandler)
+	handle("wrongtype", wrongTypeHandler)
+	if replayDB != nil {
+		mux.HandleFunc(".", routeDS(guarded("replay", replayHandler)))
+	} else {
+		mux.HandleFunc(".", routeDS(unknownHandler))
+	}
 
 	errChan := make(chan error)
-	go func() {
-		errChan <- udpServer.ListenAndServe()
-	}()
-	go func() {
-		errChan <- tcpServer.ListenAndServe()
-	}()
-
-	err := <-errChan
-	if err != nil {
+	for _, server := range servers {
+		go func() {
+			if server.PacketConn != nil || server.Listener != nil {
+				errChan <- server.ActivateAndServe()
+			} else {
+				errChan <- server.ListenAndServe()
+			}
+		}()
+	}
+	if dohSrv != nil {
+		go func() {
+			errChan <- dohSrv.ServeTLS(dohListener, "", "")
+		}()
+	}
+	if *capabilitiesLog > 0 {
+		go logCapabilities()
+	}
+	if dtlsSrv != nil {
+		go func() {
+			errChan <- dtlsSrv.serve()
+		}()
+	}
+	if *adminListen != "" {
+		go func() {
+			errChan <- serveAdmin(*adminListen)
+		}()
+	}
+	if *grpcListen != "" {
+		go func() {
+			errChan <- serveGRPC(*grpcListen)
+		}()
+	}
+
+	if err := waitForServers(errChan); err != nil {
 		log.Fatal(err)
 	}
 }
 
+// parseAdvertised sets advertise4 and advertise6 from the flags.
+func parseAdvertised() error {
+	addr := *advertiseIP
+	if addr == "" {
+		addr = *ip
+	}
+	advertise4 = net.ParseIP(addr).To4()
+	if advertise4 == nil {
+		return fmt.Errorf("-advertise-ip: %q is not an IPv4 address", addr)
+	}
+	if *advertiseIP6 != "" {
+		advertise6 = net.ParseIP(*advertiseIP6)
+		if advertise6 == nil || advertise6.To4() != nil {
+			return fmt.Errorf("-advertise-ip6: %q is not an IPv6 address", *advertiseIP6)
+		}
+	}
+	return nil
+}
+
+// udpConnFor returns the UDP socket that the query being answered with w
+// arrived on, or failing that the first one.
+func udpConnFor(w dns.ResponseWriter) net.PacketConn {
+	local := w.LocalAddr().String()
+	for _, c := range udpConns {
+		if c.LocalAddr().String() == local {
+			return c
+		}
+	}
+	return udpConns[0]
+}
+
 // qname returns the QNAME from a query. If there is no QNAME in a query it
 // returns ".".
 func qname(q *dns.Msg) string {
@@ -59,9 +322,226 @@ func qname(q *dns.Msg) string {
 	return "."
 }
 
+// handle registers h to serve the subtree name.<base>, guarded against
+// panics.
+func handle(name string, h dns.HandlerFunc) {
+	h = guarded(name, h)
+	f := func(w dns.ResponseWriter, q *dns.Msg) {
+		if rw, ok := w.(*responseWriter); ok {
+			rw.handler = name
+			if rw.refuseMixedCase(q) {
+				return
+			}
+		}
+		h(w, q)
+	}
+	mux.HandleFunc(zone(name), f)
+	handlers[dns.CanonicalName(zone(name))] = f
+	handlerNames[dns.CanonicalName(zone(name))] = name
+}
+
+var (
+	// handlers holds the handlers registered with handle, and handlerNames
+	// their names, keyed by zone.
+	handlers     = make(map[string]dns.HandlerFunc)
+	handlerNames = make(map[string]string)
+)
+
+// handlerFor returns the name of the handler registered for the closest zone
+// enclosing name, or "" if there is none.
+func handlerFor(name string) string {
+	name = dns.CanonicalName(name)
+	for off, end := 0, false; !end; off, end = dns.NextLabel(name, off) {
+		if h, ok := handlerNames[name[off:]]; ok {
+			return h
+		}
+	}
+	return ""
+}
+
+// routeDS returns a handler for the root that hands DS queries to the handler
+// registered for the closest enclosing zone, including the zone whose apex
+// is asked about, and everything else to next. The mux on its own sends all DS
+// queries to the root's handler, looking for the parent zone, but the
+// handlers play both sides of every cut under -base.
+func routeDS(next dns.HandlerFunc) dns.HandlerFunc {
+	return func(w dns.ResponseWriter, q *dns.Msg) {
+		if q.Question[0].Qtype == dns.TypeDS {
+			name := dns.CanonicalName(qname(q))
+			for off, end := 0, false; !end; off, end = dns.NextLabel(name, off) {
+				if h, ok := handlers[name[off:]]; ok {
+					h(w, q)
+					return
+				}
+			}
+		}
+		next(w, q)
+	}
+}
+
+// zone returns the fully qualified name of the subtree a handler is
+// registered on, e.g. zone("cnamepit") is "cnamepit.example.com.".
+func zone(name string) string {
+	return dns.Fqdn(name + "." + *basename)
+}
+
+// subLabels returns the labels of name that precede zone, which name must be
+// within. For instance subLabels("a.b.cnamepit.example.com.",
+// "cnamepit.example.com.") returns ["a", "b"].
+func subLabels(name, zone string) []string {
+	labels := dns.SplitDomainName(name)
+	n := len(labels) - dns.CountLabel(zone)
+	if n <= 0 {
+		return nil
+	}
+	return labels[:n]
+}
+
+// aRecord returns an A record for name pointing at this server.
+func aRecord(name string) dns.RR {
+	return &dns.A{
+		Hdr: dns.RR_Header{
+			Name:   name,
+			Rrtype: dns.TypeA,
+			Class:  dns.ClassINET,
+		},
+		A: advertise4,
+	}
+}
+
+// aaaaRecord returns an AAAA record for name pointing at this server. It
+// returns nil if there is no -advertise-ip6.
+func aaaaRecord(name string) dns.RR {
+	if advertise6 == nil {
+		return nil
+	}
+	return &dns.AAAA{
+		Hdr: dns.RR_Header{
+			Name:   name,
+			Rrtype: dns.TypeAAAA,
+			Class:  dns.ClassINET,
+		},
+		AAAA: advertise6,
+	}
+}
+
+// glue returns the address records for a name server called host that is
+// really this server.
+func glue(host string) []dns.RR {
+	rrs := []dns.RR{aRecord(host)}
+	if rr := aaaaRecord(host); rr != nil {
+		rrs = append(rrs, rr)
+	}
+	return rrs
+}
+
+// soaRecord returns an SOA record for zone, for use in the authority section
+// of negative responses.
+func soaRecord(zone string) dns.RR {
+	return &dns.SOA{
+		Hdr: dns.RR_Header{
+			Name:   zone,
+			Rrtype: dns.TypeSOA,
+			Class:  dns.ClassINET,
+		},
+		Ns:      "ns." + dns.Fqdn(*basename),
+		Mbox:    "hostmaster." + dns.Fqdn(*basename),
+		Serial:  1,
+		Refresh: 3600,
+		Retry:   600,
+		Expire:  86400,
+	}
+}
+
+// delegation returns an NS RRset for childZone, naming a single server below
+// it, and the glue for that server.
+func delegation(childZone string, ttl uint32) (ns []dns.RR, extra []dns.RR) {
+	return nsRRset(childZone, ttl, "ns."+childZone)
+}
+
+// nsRRset returns an NS RRset for zone naming hosts, all of which are really
+// this server, and the address records for them.
+func nsRRset(zone string, ttl uint32, hosts ...string) (ns []dns.RR, extra []dns.RR) {
+	for _, host := range hosts {
+		ns = append(ns, &dns.NS{
+			Hdr: dns.RR_Header{
+				Name:   zone,
+				Rrtype: dns.TypeNS,
+				Class:  dns.ClassINET,
+				Ttl:    ttl,
+			},
+			Ns: host,
+		})
+		extra = append(extra, glue(host)...)
+	}
+	return ns, extra
+}
+
+// healthyAnswer fills in m the way a well-behaved authoritative server for
+// zone would: A and AAAA queries get this server's address, SRV queries get a record
+// pointing back at the name, TXT queries get a short note, and anything else
+// gets NODATA.
+func healthyAnswer(m *dns.Msg, q *dns.Msg, zone string) {
+	m.Authoritative = true
+	name := qname(q)
+	switch q.Question[0].Qtype {
+	case dns.TypeA:
+		m.Answer = []dns.RR{aRecord(name)}
+	case dns.TypeAAAA:
+		if rr := aaaaRecord(name); rr != nil {
+			m.Answer = []dns.RR{rr}
+		} else {
+			m.Ns = []dns.RR{soaRecord(zone)}
+		}
+	case dns.TypeSRV:
+		m.Answer = []dns.RR{
+			&dns.SRV{
+				Hdr: dns.RR_Header{
+					Name:   name,
+					Rrtype: dns.TypeSRV,
+					Class:  dns.ClassINET,
+				},
+				Port:   53,
+				Target: name,
+			},
+		}
+	case dns.TypeTXT:
+		m.Answer = []dns.RR{
+			&dns.TXT{
+				Hdr: dns.RR_Header{
+					Name:   name,
+					Rrtype: dns.TypeTXT,
+					Class:  dns.ClassINET,
+				},
+				Txt: []string{"this name is served by awful.zone"},
+			},
+		}
+	default:
+		m.Ns = []dns.RR{soaRecord(zone)}
+	}
+}
+
+// clientIP returns the IP address, without port, that a query came from.
+func clientIP(w dns.ResponseWriter) string {
+	host, _, err := net.SplitHostPort(w.RemoteAddr().String())
+	if err != nil {
+		return w.RemoteAddr().String()
+	}
+	return host
+}
+
 func logQuery(w dns.ResponseWriter, q *dns.Msg, handler string) {
-	log.Printf("query from %s for %q, handled by %s",
-		w.RemoteAddr(), qname(q), handler)
+	in := ""
+	if rw, ok := w.(*responseWriter); ok && rw.session != nil {
+		in = " in session " + rw.session.token
+	}
+	if asns != nil {
+		log.Printf("query from %s (AS%s) for %q%s, handled by %s",
+			w.RemoteAddr(), asns.lookup(clientIP(w)), qname(q), in, handler)
+		return
+	}
+	log.Printf("query from %s for %q%s, handled by %s",
+		w.RemoteAddr(), qname(q), in, handler)
 }
 
 // unknownHandler handles any request that doesn't match a pattern.
@@ -70,6 +550,15 @@ func unknownHandler(w dns.ResponseWriter, q *dns.Msg) {
 	txtError(w, q, "request did not match any known pattern.")
 }
 
+// requireLab writes an error and returns false unless -lab was given.
+func requireLab(w dns.ResponseWriter, q *dns.Msg) bool {
+	if !*lab {
+		txtError(w, q, "this handler is only available in lab mode (-lab).")
+		return false
+	}
+	return true
+}
+
 // txtError writes a response with a TXT record containing the given error
 // message.
 func txtError(w dns.ResponseWriter, q *dns.Msg, errorMsg string) {
@@ -108,13 +597,32 @@ func cnamePitHandler(w dns.ResponseWriter, q *dns.Msg) {
 	w.WriteMsg(m)
 }
 
-// manyCutsHandler always replies with a referral.
+// manyCutsHandler always replies with a referral, unless the label below
+// manycuts.<base> is a number N. Then a name under N.manycuts.<base> is
+// delegated to a name server under N-1.manycuts.<base>, with no glue, so
+// that a resolver has to go down a chain of N delegations to find its
+// address, and a name under 0.manycuts.<base> is answered. The chain is in
+// the names, so it is as long for every client, every time.
 func manyCutsHandler(w dns.ResponseWriter, q *dns.Msg) {
 	logQuery(w, q, "manyCutsHandler")
 	m := new(dns.Msg)
 	m.SetRcode(q, dns.RcodeSuccess)
 	name := q.Question[0].Name
 	nextName := "q." + name
+	withGlue := true
+	labels := subLabels(name, zone("manycuts"))
+	if len(labels) > 0 {
+		if depth, err := strconv.ParseInt(labels[len(labels)-1], 10, 32); err == nil && depth >= 0 {
+			if depth == 0 {
+				healthyAnswer(m, q, zone("manycuts"))
+				w.WriteMsg(m)
+				return
+			}
+			labels[len(labels)-1] = strconv.FormatInt(depth-1, 10)
+			nextName = "q." + strings.Join(labels, ".") + "." + zone("manycuts")
+			withGlue = false
+		}
+	}
 	record := &dns.NS{
 		Hdr: dns.RR_Header{
 			Name:   name,
@@ -124,15 +632,8 @@ func manyCutsHandler(w dns.ResponseWriter, q *dns.Msg) {
 		Ns: nextName,
 	}
 	m.Ns = []dns.RR{record}
-	m.Extra = []dns.RR{
-		&dns.A{
-			Hdr: dns.RR_Header{
-				Name:   nextName,
-				Rrtype: dns.TypeA,
-				Class:  dns.ClassINET,
-			},
-			A: net.ParseIP(*ip),
-		},
+	if withGlue {
+		m.Extra = glue(nextName)
 	}
 
 	w.WriteMsg(m)
@@ -156,3 +657,1414 @@ func sleepHandler(w dns.ResponseWriter, q *dns.Msg) {
 	time.Sleep(time.Duration(sleepCount) * time.Millisecond)
 	w.WriteMsg(m)
 }
+
+// parseQtypeDelays parses a comma separated list of TYPE=milliseconds pairs,
+// e.g. "A=0,AAAA=200".
+func parseQtypeDelays(s string) (map[uint16]time.Duration, error) {
+	delays := make(map[uint16]time.Duration)
+	for _, pair := range strings.Split(s, ",") {
+		if pair == "" {
+			continue
+		}
+		typeName, ms, ok := strings.Cut(pair, "=")
+		if !ok {
+			return nil, fmt.Errorf("malformed type delay %q", pair)
+		}
+		qtype, ok := dns.StringToType[strings.ToUpper(typeName)]
+		if !ok {
+			return nil, fmt.Errorf("unknown type %q", typeName)
+		}
+		n, err := strconv.ParseUint(ms, 10, 16)
+		if err != nil {
+			return nil, fmt.Errorf("bad delay for %s: %s", typeName, err)
+		}
+		delays[qtype] = time.Duration(n) * time.Millisecond
+	}
+	return delays, nil
+}
+
+// matrixHandler answers like a healthy zone, but first sleeps for a delay that
+// depends on the qtype, as configured with -matrix-delays. Asking for several
+// types of the same name shows how a client orders and parallelizes them.
+func matrixHandler(w dns.ResponseWriter, q *dns.Msg) {
+	logQuery(w, q, "matrixHandler")
+	time.Sleep(qtypeDelays[q.Question[0].Qtype])
+	m := new(dns.Msg)
+	m.SetRcode(q, dns.RcodeSuccess)
+	healthyAnswer(m, q, zone("matrix"))
+	w.WriteMsg(m)
+}
+
+// splitUDPHandler packs an otherwise healthy response and sends it in two
+// halves, each in its own datagram. Neither half is a valid DNS message. Over
+// TCP each half gets its own length prefix, which is just as broken.
+func splitUDPHandler(w dns.ResponseWriter, q *dns.Msg) {
+	logQuery(w, q, "splitUDPHandler")
+	m := new(dns.Msg)
+	m.SetRcode(q, dns.RcodeSuccess)
+	healthyAnswer(m, q, zone("splitudp"))
+	wire, err := m.Pack()
+	if err != nil {
+		log.Printf("packing response: %s", err)
+		return
+	}
+	half := len(wire) / 2
+	w.Write(wire[:half])
+	w.Write(wire[half:])
+}
+
+// wrongPortHandler (lab mode only) sends a healthy response to the querier's
+// IP, but to a different UDP port than the query came from. The port is taken
+// from the first label if it is numeric, and is otherwise the query's source
+// port plus one. Clients should ignore the response and time out.
+func wrongPortHandler(w dns.ResponseWriter, q *dns.Msg) {
+	logQuery(w, q, "wrongPortHandler")
+	if !requireLab(w, q) {
+		return
+	}
+	src, ok := w.RemoteAddr().(*net.UDPAddr)
+	if !ok {
+		txtError(w, q, "wrongport only works over UDP")
+		return
+	}
+	port := src.Port + 1
+	labels := strings.Split(qname(q), ".")
+	if n, err := strconv.ParseUint(labels[0], 10, 16); err == nil {
+		port = int(n)
+	}
+	if port == src.Port || port > 65535 {
+		port = src.Port ^ 1
+	}
+
+	m := new(dns.Msg)
+	m.SetRcode(q, dns.RcodeSuccess)
+	healthyAnswer(m, q, zone("wrongport"))
+	wire, err := m.Pack()
+	if err != nil {
+		log.Printf("packing response: %s", err)
+		return
+	}
+	dst := &net.UDPAddr{IP: src.IP, Port: port, Zone: src.Zone}
+	if _, err := udpConnFor(w).WriteTo(wire, dst); err != nil {
+		log.Printf("sending to %s: %s", dst, err)
+	}
+}
+
+// staleNSGeneration counts queries to stalens.<base>; each one gets an NS set
+// named after a new generation.
+var staleNSGeneration atomic.Uint64
+
+// staleNSHandler answers authoritatively for stalens.<base>, but every
+// response carries a brand new NS RRset for the zone in its authority section,
+// with glue. All of the NS names ever handed out keep resolving, and asking
+// any of them yields yet another NS set. A resolver that lets the child's NS
+// RRset replace what it has cached never settles on a server set.
+func staleNSHandler(w dns.ResponseWriter, q *dns.Msg) {
+	logQuery(w, q, "staleNSHandler")
+	apex := zone("stalens")
+	gen := staleNSGeneration.Add(1)
+	m := new(dns.Msg)
+	m.SetRcode(q, dns.RcodeSuccess)
+	m.Authoritative = true
+
+	var nsSet, extra []dns.RR
+	for i := uint64(0); i < 2; i++ {
+		host := fmt.Sprintf("ns%d.%s", 2*gen+i, apex)
+		nsSet = append(nsSet, &dns.NS{
+			Hdr: dns.RR_Header{
+				Name:   apex,
+				Rrtype: dns.TypeNS,
+				Class:  dns.ClassINET,
+				Ttl:    3600,
+			},
+			Ns: host,
+		})
+		extra = append(extra, glue(host)...)
+	}
+
+	name := qname(q)
+	switch qtype := q.Question[0].Qtype; {
+	case qtype == dns.TypeNS && strings.EqualFold(name, apex):
+		m.Answer = nsSet
+		m.Extra = extra
+	case qtype == dns.TypeA:
+		m.Answer = []dns.RR{aRecord(name)}
+		m.Ns = nsSet
+		m.Extra = extra
+	case qtype == dns.TypeAAAA && advertise6 != nil:
+		m.Answer = []dns.RR{aaaaRecord(name)}
+		m.Ns = nsSet
+		m.Extra = extra
+	default:
+		m.Ns = []dns.RR{soaRecord(apex)}
+	}
+	w.WriteMsg(m)
+}
+
+// entBugHandler serves a zone containing a single name, a.b.c.entbug.<base>,
+// which makes b.c.entbug.<base> and c.entbug.<base> empty non-terminals. Like
+// a well known class of broken load balancers, it answers NXDOMAIN rather
+// than NODATA for those. A resolver following RFC 8020 will conclude that
+// a.b.c.entbug.<base> doesn't exist either.
+func entBugHandler(w dns.ResponseWriter, q *dns.Msg) {
+	logQuery(w, q, "entBugHandler")
+	apex := zone("entbug")
+	leaf := "a.b.c." + apex
+	name := strings.ToLower(qname(q))
+	m := new(dns.Msg)
+	m.SetRcode(q, dns.RcodeSuccess)
+	switch {
+	case name == leaf || name == apex:
+		healthyAnswer(m, q, apex)
+	default:
+		// Includes the empty non-terminals, which is the bug.
+		m.SetRcode(q, dns.RcodeNameError)
+		m.Authoritative = true
+		m.Ns = []dns.RR{soaRecord(apex)}
+	}
+	w.WriteMsg(m)
+}
+
+// crossDupHandler (lab mode only) answers TCP queries normally, and also
+// fires a copy of the response over UDP at port 53 of the querier's address.
+// Nothing on the client side should accept that datagram.
+func crossDupHandler(w dns.ResponseWriter, q *dns.Msg) {
+	logQuery(w, q, "crossDupHandler")
+	if !requireLab(w, q) {
+		return
+	}
+	m := new(dns.Msg)
+	m.SetRcode(q, dns.RcodeSuccess)
+	healthyAnswer(m, q, zone("crossdup"))
+	// Packed once, so that the copy is the very response sent over TCP.
+	wire, err := packed(w, m)
+	if err != nil {
+		log.Printf("packing response: %s", err)
+		return
+	}
+	if _, err := w.Write(wire); err != nil {
+		log.Printf("writing crossdup response: %s", err)
+	}
+
+	src, ok := w.RemoteAddr().(*net.TCPAddr)
+	if !ok {
+		return
+	}
+	dst := &net.UDPAddr{IP: src.IP, Port: 53, Zone: src.Zone}
+	if _, err := udpConnFor(w).WriteTo(wire, dst); err != nil {
+		log.Printf("sending to %s: %s", dst, err)
+	}
+}
+
+// ttlSkewReferrals remembers which clients were referred to which ttlskew
+// child zones, for as long as the parent's NS TTL lasts.
+var ttlSkewReferrals = newCounters("ttlskew")
+
+// ttlSkewHandler serves child zones named <parent>-<child>.ttlskew.<base>,
+// where the parent's delegation carries an NS TTL of <parent> seconds and the
+// child's own NS RRset carries <child> seconds. As with ghost.<base>, a client
+// is talking to the parent until it has been handed a referral, and to the
+// child until that referral's TTL runs out.
+func ttlSkewHandler(w dns.ResponseWriter, q *dns.Msg) {
+	logQuery(w, q, "ttlSkewHandler")
+	labels := subLabels(qname(q), zone("ttlskew"))
+	if len(labels) == 0 {
+		txtError(w, q, "query a name under <parent ttl>-<child ttl>.ttlskew.<base>")
+		return
+	}
+	child := strings.ToLower(labels[len(labels)-1])
+	parentTTL, childTTL, err := parseTTLPair(child)
+	if err != nil {
+		txtError(w, q, err.Error())
+		return
+	}
+	childZone := child + "." + zone("ttlskew")
+	key := clientIP(w) + "|" + child
+	m := new(dns.Msg)
+	m.SetRcode(q, dns.RcodeSuccess)
+
+	if _, ok := ttlSkewReferrals.get(key); !ok {
+		ttlSkewReferrals.set(key, 1, time.Duration(parentTTL)*time.Second)
+		m.Ns, m.Extra = delegation(childZone, parentTTL)
+		w.WriteMsg(m)
+		return
+	}
+	healthyAnswer(m, q, childZone)
+	if q.Question[0].Qtype == dns.TypeNS && strings.EqualFold(qname(q), childZone) {
+		m.Answer, m.Extra = delegation(childZone, childTTL)
+		m.Ns = nil
+	} else if len(m.Answer) > 0 {
+		m.Ns, m.Extra = delegation(childZone, childTTL)
+	}
+	w.WriteMsg(m)
+}
+
+// parseTTLPair parses a label of the form <parent>-<child>, both TTLs in
+// seconds.
+func parseTTLPair(label string) (parent, child uint32, err error) {
+	p, c, ok := strings.Cut(label, "-")
+	if !ok {
+		return 0, 0, fmt.Errorf("expected <parent ttl>-<child ttl>, got %q", label)
+	}
+	pn, err := strconv.ParseUint(p, 10, 32)
+	if err != nil {
+		return 0, 0, fmt.Errorf("bad parent ttl: %s", err)
+	}
+	cn, err := strconv.ParseUint(c, 10, 32)
+	if err != nil {
+		return 0, 0, fmt.Errorf("bad child ttl: %s", err)
+	}
+	return uint32(pn), uint32(cn), nil
+}
+
+// occludedHandler answers for names under <cut>.occluded.<base> with both a
+// referral to the child zone <cut>.occluded.<base> and an answer for the
+// name, which lies below the cut. A server that is only authoritative for the
+// parent has no business serving that answer, and resolvers should not
+// believe it.
+func occludedHandler(w dns.ResponseWriter, q *dns.Msg) {
+	logQuery(w, q, "occludedHandler")
+	labels := subLabels(qname(q), zone("occluded"))
+	if len(labels) == 0 {
+		txtError(w, q, "query a name under <cut>.occluded.<base>")
+		return
+	}
+	cut := labels[len(labels)-1] + "." + zone("occluded")
+	m := new(dns.Msg)
+	m.SetRcode(q, dns.RcodeSuccess)
+	healthyAnswer(m, q, cut)
+	m.Authoritative = false
+	m.Ns, m.Extra = delegation(cut, 3600)
+	w.WriteMsg(m)
+}
+
+// disagreeReferrals remembers which clients were referred to which disagree
+// child zones.
+var disagreeReferrals = newCounters("disagree")
+
+// disagreeHandler serves child zones <child>.disagree.<base>. The parent's
+// referral names p1 and p2 below the child as its servers, while the child
+// itself claims to be served by c1 and c2. All four are this server. As with
+// ghost.<base>, a client is talking to the parent until it has been handed a
+// referral, and to the child for the referral's TTL after that.
+func disagreeHandler(w dns.ResponseWriter, q *dns.Msg) {
+	logQuery(w, q, "disagreeHandler")
+	labels := subLabels(qname(q), zone("disagree"))
+	if len(labels) == 0 {
+		txtError(w, q, "query a name under <child>.disagree.<base>")
+		return
+	}
+	child := strings.ToLower(labels[len(labels)-1])
+	childZone := child + "." + zone("disagree")
+	key := clientIP(w) + "|" + child
+	m := new(dns.Msg)
+	m.SetRcode(q, dns.RcodeSuccess)
+
+	if _, ok := disagreeReferrals.get(key); !ok {
+		disagreeReferrals.set(key, 1, 300*time.Second)
+		m.Ns, m.Extra = nsRRset(childZone, 300, "p1."+childZone, "p2."+childZone)
+		w.WriteMsg(m)
+		return
+	}
+	healthyAnswer(m, q, childZone)
+	ns, extra := nsRRset(childZone, 300, "c1."+childZone, "c2."+childZone)
+	if q.Question[0].Qtype == dns.TypeNS && strings.EqualFold(qname(q), childZone) {
+		m.Answer, m.Ns, m.Extra = ns, nil, extra
+	} else if len(m.Answer) > 0 {
+		m.Ns, m.Extra = ns, extra
+	}
+	w.WriteMsg(m)
+}
+
+// infWildHandler answers for every name under infwild.<base>, like a wildcard
+// would, except that every name gets its own addresses: A records in 10/8 and
+// AAAA records in 2001:db8::/32, derived from a hash of the name. Feeding a
+// resolver endless distinct names fills its cache with distinct entries.
+//
+// The shape of the entries can be set with labels anywhere below infwild:
+// t<N> sets the TTL to N seconds (default 3600), and s<N> asks for about N
+// bytes of RDATA per answer, as that many bytes of TXT, or as N/4 A or N/16
+// AAAA records. So x1.t86400.infwild.<base> is a small long-lived entry, and
+// x1.t5.s4000.infwild.<base> a big short-lived one.
+func infWildHandler(w dns.ResponseWriter, q *dns.Msg) {
+	logQuery(w, q, "infWildHandler")
+	m := new(dns.Msg)
+	m.SetRcode(q, dns.RcodeSuccess)
+	infWildAnswer(m, q, zone("infwild"), zone("infwild"))
+	w.WriteMsg(m)
+}
+
+// infWildAnswer fills m with infWildHandler's answer to q, for a name under
+// subtree, in the zone whose apex is apex.
+func infWildAnswer(m *dns.Msg, q *dns.Msg, subtree, apex string) {
+	name := qname(q)
+	ttl, size := uint32(3600), 0
+	for _, label := range subLabels(name, subtree) {
+		label = strings.ToLower(label)
+		if len(label) < 2 {
+			continue
+		}
+		n, err := strconv.ParseUint(label[1:], 10, 32)
+		if err != nil {
+			continue
+		}
+		switch label[0] {
+		case 't':
+			ttl = uint32(n)
+		case 's':
+			size = int(min(n, 60000))
+		}
+	}
+	hdr := dns.RR_Header{
+		Name:  name,
+		Class: dns.ClassINET,
+		Ttl:   ttl,
+	}
+	m.Authoritative = true
+	switch q.Question[0].Qtype {
+	case dns.TypeA:
+		hdr.Rrtype = dns.TypeA
+		for i := 0; i < max(1, size/4); i++ {
+			a := make(net.IP, 4)
+			copy(a, nameHash(name, i))
+			a[0] = 10
+			m.Answer = append(m.Answer, &dns.A{Hdr: hdr, A: a})
+		}
+	case dns.TypeAAAA:
+		hdr.Rrtype = dns.TypeAAAA
+		for i := 0; i < max(1, size/16); i++ {
+			aaaa := make(net.IP, 16)
+			copy(aaaa, nameHash(name, i))
+			copy(aaaa, []byte{0x20, 0x01, 0x0d, 0xb8})
+			m.Answer = append(m.Answer, &dns.AAAA{Hdr: hdr, AAAA: aaaa})
+		}
+	case dns.TypeTXT:
+		hdr.Rrtype = dns.TypeTXT
+		txt := fmt.Sprintf("%x", nameHash(name, 0))
+		for len(txt) < size {
+			txt += txt
+		}
+		if size > 0 {
+			txt = txt[:size]
+		}
+		m.Answer = []dns.RR{&dns.TXT{Hdr: hdr, Txt: splitTXT(txt)}}
+	default:
+		m.Ns = []dns.RR{soaRecord(apex)}
+	}
+}
+
+// nameHash returns 16 bytes derived from name and i.
+func nameHash(name string, i int) []byte {
+	sum := sha256.Sum256(fmt.Appendf(nil, "%s|%d", strings.ToLower(name), i))
+	return sum[:16]
+}
+
+// splitTXT splits s into character-strings of at most 255 bytes.
+func splitTXT(s string) []string {
+	var strs []string
+	for len(s) > 255 {
+		strs = append(strs, s[:255])
+		s = s[255:]
+	}
+	return append(strs, s)
+}
+
+// lenBugHandler serves names under lenbug.<base>, which are answered like a
+// healthy zone unless the name is exactly a certain number of bytes long in
+// wire format, like middleboxes with off-by-one errors in their parsers. Those
+// names fail. Labels anywhere below lenbug pick the length and the failure:
+// l<N> fails names N bytes long (default 78), and formerr, servfail, refused
+// or drop pick what happens to them (default formerr). A label of the right
+// size, as in xxxx.l64.lenbug.<base>, pads the name to the length.
+func lenBugHandler(w dns.ResponseWriter, q *dns.Msg) {
+	logQuery(w, q, "lenBugHandler")
+	name := qname(q)
+	length, failure := 78, "formerr"
+	for _, label := range subLabels(name, zone("lenbug")) {
+		label = strings.ToLower(label)
+		switch label {
+		case "formerr", "servfail", "refused", "drop":
+			failure = label
+			continue
+		}
+		if strings.HasPrefix(label, "l") {
+			if n, err := strconv.Atoi(label[1:]); err == nil {
+				length = n
+			}
+		}
+	}
+
+	m := new(dns.Msg)
+	// The wire format has a length byte for each label where the
+	// presentation format has a dot, plus the root label.
+	if len(name)+1 != length {
+		m.SetRcode(q, dns.RcodeSuccess)
+		healthyAnswer(m, q, zone("lenbug"))
+		w.WriteMsg(m)
+		return
+	}
+	switch failure {
+	case "drop":
+		return
+	case "servfail":
+		m.SetRcode(q, dns.RcodeServerFailure)
+	case "refused":
+		m.SetRcode(q, dns.RcodeRefused)
+	default:
+		m.SetRcode(q, dns.RcodeFormatError)
+	}
+	w.WriteMsg(m)
+}
+
+// encodeHandler serves names of the form <data>.<encoding>.encode.<base>,
+// where encoding is hex or b32 (unpadded base32, in either case). It decodes
+// data, which may be split over several labels, and answers with a single
+// record of the query type whose RDATA is exactly the decoded bytes, whether
+// or not they make sense for that type. For instance a query for type TXT
+// and 0568656c6c6f.hex.encode.<base> gets the TXT record "hello".
+func encodeHandler(w dns.ResponseWriter, q *dns.Msg) {
+	logQuery(w, q, "encodeHandler")
+	name := qname(q)
+	labels := subLabels(name, zone("encode"))
+	if len(labels) < 2 {
+		txtError(w, q, "query <data>.hex.encode.<base> or <data>.b32.encode.<base>")
+		return
+	}
+	data := strings.Join(labels[:len(labels)-1], "")
+	var rdata []byte
+	var err error
+	switch encoding := strings.ToLower(labels[len(labels)-1]); encoding {
+	case "hex":
+		rdata, err = hex.DecodeString(data)
+	case "b32":
+		rdata, err = base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(strings.ToUpper(data))
+	default:
+		err = fmt.Errorf("unknown encoding %q", encoding)
+	}
+	if err != nil {
+		txtError(w, q, err.Error())
+		return
+	}
+
+	m := new(dns.Msg)
+	m.SetRcode(q, dns.RcodeSuccess)
+	m.Authoritative = true
+	m.Answer = []dns.RR{&dns.RFC3597{
+		Hdr:   dns.RR_Header{Name: name, Rrtype: q.Question[0].Qtype, Class: dns.ClassINET},
+		Rdata: hex.EncodeToString(rdata),
+	}}
+	w.WriteMsg(m)
+}
+
+// wrongClassHandler answers like a healthy zone, except that the records in
+// the answer section have a class other than the one asked for. Labels
+// anywhere below wrongclass pick the class: ch (the default), hs, none (254),
+// or c<N> for class N. With the label mixed, the answer has the records in
+// both the right and the wrong class. Resolvers should throw away what they
+// didn't ask for.
+func wrongClassHandler(w dns.ResponseWriter, q *dns.Msg) {
+	logQuery(w, q, "wrongClassHandler")
+	class, mixed := uint16(dns.ClassCHAOS), false
+	for _, label := range subLabels(qname(q), zone("wrongclass")) {
+		switch label = strings.ToLower(label); label {
+		case "ch":
+			class = dns.ClassCHAOS
+		case "hs":
+			class = dns.ClassHESIOD
+		case "none":
+			class = dns.ClassNONE
+		case "mixed":
+			mixed = true
+		default:
+			if !strings.HasPrefix(label, "c") {
+				continue
+			}
+			if n, err := strconv.ParseUint(label[1:], 10, 16); err == nil {
+				class = uint16(n)
+			}
+		}
+	}
+
+	m := new(dns.Msg)
+	m.SetRcode(q, dns.RcodeSuccess)
+	healthyAnswer(m, q, zone("wrongclass"))
+	var answer []dns.RR
+	for _, rr := range m.Answer {
+		if mixed {
+			answer = append(answer, dns.Copy(rr))
+		}
+		rr.Header().Class = class
+		answer = append(answer, rr)
+	}
+	m.Answer = answer
+	w.WriteMsg(m)
+}
+
+// nthTryMemory is how long nthtry.<base> remembers attempts for a name after
+// the last one.
+const nthTryMemory = time.Minute
+
+// nthTryAttempts counts attempts under "<client>|<name>", and keeps the time
+// of the first one, in Unix nanoseconds, under "<client>|<name>|first".
+var nthTryAttempts = newCounters("nthtry")
+
+// nthTryHandler serves names of the form <anything>.<N>.nthtry.<base>. It
+// drops the first N-1 attempts to resolve a name, and answers from attempt N
+// on. Attempts are counted per session if the query carries a session token,
+// since resolvers often retry from different addresses, and per client
+// address otherwise. Each attempt is logged with the time since the first, so
+// the log shows the resolver's timeout schedule.
+func nthTryHandler(w dns.ResponseWriter, q *dns.Msg) {
+	logQuery(w, q, "nthTryHandler")
+	name := qname(q)
+	labels := subLabels(name, zone("nthtry"))
+	var n int64
+	if len(labels) > 0 {
+		n, _ = strconv.ParseInt(labels[len(labels)-1], 10, 32)
+	}
+	if n < 1 {
+		txtError(w, q, "query <anything>.<N>.nthtry.<base> with N at least 1")
+		return
+	}
+	client := retryClient(w)
+	key := client + "|" + strings.ToLower(name)
+	attempt := nthTryAttempts.incr(key, nthTryMemory)
+	now := time.Now()
+	first, ok := nthTryAttempts.get(key + "|first")
+	if !ok || attempt == 1 {
+		first = now.UnixNano()
+	}
+	nthTryAttempts.set(key+"|first", first, nthTryMemory)
+	log.Printf("nthtry: attempt %d from %s for %q, %s after the first",
+		attempt, client, name, now.Sub(time.Unix(0, first)).Round(time.Millisecond))
+	if attempt < n {
+		return
+	}
+	m := new(dns.Msg)
+	m.SetRcode(q, dns.RcodeSuccess)
+	healthyAnswer(m, q, zone("nthtry"))
+	w.WriteMsg(m)
+}
+
+// ednsDiffHandler serves names under ednsdiff.<base> with one answer for
+// queries with EDNS and another for queries without it: 192.0.2.1,
+// 2001:db8::1 and TXT "edns" versus 198.51.100.1, 2001:db8::2 and TXT
+// "no edns". Whichever a resolver ends up caching shows whether it fell back
+// to plain DNS along the way.
+func ednsDiffHandler(w dns.ResponseWriter, q *dns.Msg) {
+	logQuery(w, q, "ednsDiffHandler")
+	name := qname(q)
+	opt := q.IsEdns0()
+	m := new(dns.Msg)
+	m.SetRcode(q, dns.RcodeSuccess)
+	m.Authoritative = true
+	hdr := func(rrtype uint16) dns.RR_Header {
+		return dns.RR_Header{Name: name, Rrtype: rrtype, Class: dns.ClassINET, Ttl: 300}
+	}
+	switch q.Question[0].Qtype {
+	case dns.TypeA:
+		addr := "198.51.100.1"
+		if opt != nil {
+			addr = "192.0.2.1"
+		}
+		m.Answer = []dns.RR{&dns.A{Hdr: hdr(dns.TypeA), A: net.ParseIP(addr)}}
+	case dns.TypeAAAA:
+		addr := "2001:db8::2"
+		if opt != nil {
+			addr = "2001:db8::1"
+		}
+		m.Answer = []dns.RR{&dns.AAAA{Hdr: hdr(dns.TypeAAAA), AAAA: net.ParseIP(addr)}}
+	case dns.TypeTXT:
+		txt := "no edns"
+		if opt != nil {
+			txt = "edns"
+		}
+		m.Answer = []dns.RR{&dns.TXT{Hdr: hdr(dns.TypeTXT), Txt: []string{txt}}}
+	default:
+		m.Ns = []dns.RR{soaRecord(zone("ednsdiff"))}
+	}
+	if opt != nil {
+		m.SetEdns0(1232, opt.Do())
+	}
+	w.WriteMsg(m)
+}
+
+// dotsHandler serves names of the form <anything>.<variant>.dots.<base> with
+// a CNAME whose names are odd in a way picked by variant:
+//
+//	root     the target is the root, "."
+//	escaped  the target has a label with a dot in it, x\.y.target.dots.<base>
+//	double   the target has an empty label in the middle, as if it were
+//	         written x..target.dots.<base>, which ends the name early on the
+//	         wire and leaves the rest of the RDATA as garbage
+//	notrail  the target is missing its terminating root label, so a parser
+//	         reading it runs past the end of the RDATA
+//	mixed    the owner and target are in a different mix of case than the
+//	         question
+//
+// Names under target.dots.<base> are answered like a healthy zone.
+func dotsHandler(w dns.ResponseWriter, q *dns.Msg) {
+	logQuery(w, q, "dotsHandler")
+	name := qname(q)
+	labels := subLabels(name, zone("dots"))
+	if len(labels) == 0 {
+		txtError(w, q, "query <anything>.<variant>.dots.<base> with variant root, escaped, double, notrail or mixed")
+		return
+	}
+	targetZone := "target." + zone("dots")
+	m := new(dns.Msg)
+	m.SetRcode(q, dns.RcodeSuccess)
+	m.Authoritative = true
+	hdr := dns.RR_Header{Name: name, Rrtype: dns.TypeCNAME, Class: dns.ClassINET}
+	switch variant := strings.ToLower(labels[len(labels)-1]); variant {
+	case "target":
+		healthyAnswer(m, q, targetZone)
+	case "root":
+		m.Answer = []dns.RR{&dns.CNAME{Hdr: hdr, Target: "."}}
+	case "escaped":
+		m.Answer = []dns.RR{&dns.CNAME{Hdr: hdr, Target: `x\.y.` + targetZone}}
+	case "double":
+		rdata := append([]byte{1, 'x', 0}, packName(targetZone)...)
+		m.Answer = []dns.RR{&dns.RFC3597{Hdr: hdr, Rdata: hex.EncodeToString(rdata)}}
+	case "notrail":
+		rdata := packName("x." + targetZone)
+		rdata = rdata[:len(rdata)-1]
+		m.Answer = []dns.RR{&dns.RFC3597{Hdr: hdr, Rdata: hex.EncodeToString(rdata)}}
+	case "mixed":
+		hdr.Name = flipCase(name)
+		m.Answer = []dns.RR{&dns.CNAME{Hdr: hdr, Target: flipCase("x." + targetZone)}}
+	default:
+		txtError(w, q, "unknown variant "+variant)
+		return
+	}
+	w.WriteMsg(m)
+}
+
+// flipCase returns name with the case of every other letter flipped.
+func flipCase(name string) string {
+	b := []byte(name)
+	flip := true
+	for i, c := range b {
+		if !('a' <= c && c <= 'z' || 'A' <= c && c <= 'Z') {
+			continue
+		}
+		if flip {
+			b[i] = c ^ 0x20
+		}
+		flip = !flip
+	}
+	return string(b)
+}
+
+// cnameLoopHandler serves names under <N>.cnameloop.<base> that form a closed
+// loop of N CNAMEs: <N>.cnameloop.<base> points at a.<N>.cnameloop.<base>,
+// which points at b.<N>.cnameloop.<base>, and so on, until the Nth points
+// back at <N>.cnameloop.<base>. Past z the names are h26, h27 and so on.
+// Resolvers should detect the loop and fail, rather than follow it until
+// their chain length limit.
+func cnameLoopHandler(w dns.ResponseWriter, q *dns.Msg) {
+	logQuery(w, q, "cnameLoopHandler")
+	labels := subLabels(qname(q), zone("cnameloop"))
+	var n uint64
+	if len(labels) > 0 {
+		n, _ = strconv.ParseUint(labels[len(labels)-1], 10, 16)
+	}
+	if n < 1 {
+		txtError(w, q, "query <N>.cnameloop.<base> with N at least 1")
+		return
+	}
+	loopZone := labels[len(labels)-1] + "." + zone("cnameloop")
+	member := func(i int) string {
+		switch {
+		case i == 0:
+			return loopZone
+		case i <= 26:
+			return string(rune('a'+i-1)) + "." + loopZone
+		}
+		return fmt.Sprintf("h%d.%s", i-1, loopZone)
+	}
+	pos := -1
+	switch len(labels) {
+	case 1:
+		pos = 0
+	case 2:
+		for i := 1; i < int(n); i++ {
+			if strings.EqualFold(member(i), qname(q)) {
+				pos = i
+				break
+			}
+		}
+	}
+	m := new(dns.Msg)
+	m.SetRcode(q, dns.RcodeSuccess)
+	m.Authoritative = true
+	if pos < 0 {
+		m.Rcode = dns.RcodeNameError
+		m.Ns = []dns.RR{soaRecord(loopZone)}
+		w.WriteMsg(m)
+		return
+	}
+	m.Answer = []dns.RR{&dns.CNAME{
+		Hdr:    dns.RR_Header{Name: qname(q), Rrtype: dns.TypeCNAME, Class: dns.ClassINET},
+		Target: member((pos + 1) % int(n)),
+	}}
+	w.WriteMsg(m)
+}
+
+// truncateHandler answers every query under truncate.<base> over UDP with TC
+// set, sending the client to TCP, where it gets a healthy answer. Labels
+// anywhere below truncate change that: with partial the truncated response
+// carries the answer section anyway, which clients must not use, and with
+// notcp the TCP connection is closed as soon as the query arrives on it, so
+// the fallback fails.
+func truncateHandler(w dns.ResponseWriter, q *dns.Msg) {
+	logQuery(w, q, "truncateHandler")
+	partial, noTCP := false, false
+	for _, label := range subLabels(qname(q), zone("truncate")) {
+		switch strings.ToLower(label) {
+		case "partial":
+			partial = true
+		case "notcp":
+			noTCP = true
+		}
+	}
+	m := new(dns.Msg)
+	m.SetRcode(q, dns.RcodeSuccess)
+	if _, udp := w.RemoteAddr().(*net.UDPAddr); !udp {
+		if noTCP {
+			w.Close()
+			return
+		}
+		healthyAnswer(m, q, zone("truncate"))
+		w.WriteMsg(m)
+		return
+	}
+	if partial {
+		healthyAnswer(m, q, zone("truncate"))
+	}
+	m.Truncated = true
+	w.WriteMsg(m)
+}
+
+// nsAnswerHandler answers queries for any type but NS under nsanswer.<base>
+// with an NS RRset for the name itself in the answer section, naming
+// ns.<base>, and nothing else. That is neither an answer nor a referral, and
+// resolvers have to decide which to take it for. NS queries get the same
+// RRset, which for them is a proper answer.
+func nsAnswerHandler(w dns.ResponseWriter, q *dns.Msg) {
+	logQuery(w, q, "nsAnswerHandler")
+	m := new(dns.Msg)
+	m.SetRcode(q, dns.RcodeSuccess)
+	m.Authoritative = true
+	m.Answer, _ = nsRRset(qname(q), 300, "ns."+dns.Fqdn(*basename))
+	w.WriteMsg(m)
+}
+
+// badIDDelay is how long badIDHandler waits before following a response with
+// the wrong ID with the right one.
+const badIDDelay = 200 * time.Millisecond
+
+// badIDHandler answers queries under badid.<base> with a healthy answer whose
+// ID is one more than the query's, which clients must drop as not theirs.
+// With a label late anywhere below badid, the right response follows after
+// badIDDelay, so a client that drops the first one still gets an answer.
+func badIDHandler(w dns.ResponseWriter, q *dns.Msg) {
+	logQuery(w, q, "badIDHandler")
+	late := false
+	for _, label := range subLabels(qname(q), zone("badid")) {
+		if strings.EqualFold(label, "late") {
+			late = true
+		}
+	}
+	m := new(dns.Msg)
+	m.SetRcode(q, dns.RcodeSuccess)
+	healthyAnswer(m, q, zone("badid"))
+	bad := m.Copy()
+	bad.Id = q.Id + 1
+	w.WriteMsg(bad)
+	if !late {
+		return
+	}
+	time.Sleep(badIDDelay)
+	w.WriteMsg(m)
+}
+
+// multiSOAHandler answers every query under multisoa.<base> negatively, with
+// two conflicting SOA records in the authority section: one with serial 1
+// and a negative caching TTL of 60 seconds, and one with serial 2 and 3600.
+// With a label owners anywhere below multisoa, the second is owned by <base>
+// instead of multisoa.<base>. Names below multisoa.<base> are NXDOMAIN, and
+// the apex is NODATA for anything but SOA, which is answered with the first.
+func multiSOAHandler(w dns.ResponseWriter, q *dns.Msg) {
+	logQuery(w, q, "multiSOAHandler")
+	apex := zone("multisoa")
+	labels := subLabels(qname(q), apex)
+	first := soaRecord(apex).(*dns.SOA)
+	first.Hdr.Ttl, first.Minttl = 60, 60
+	second := soaRecord(apex).(*dns.SOA)
+	second.Hdr.Ttl, second.Serial, second.Minttl = 3600, 2, 3600
+	for _, label := range labels {
+		if strings.EqualFold(label, "owners") {
+			second.Hdr.Name = dns.Fqdn(*basename)
+		}
+	}
+	m := new(dns.Msg)
+	m.SetRcode(q, dns.RcodeSuccess)
+	m.Authoritative = true
+	switch {
+	case len(labels) > 0:
+		m.Rcode = dns.RcodeNameError
+		m.Ns = []dns.RR{first, second}
+	case q.Question[0].Qtype == dns.TypeSOA:
+		m.Answer = []dns.RR{first}
+	default:
+		m.Ns = []dns.RR{first, second}
+	}
+	w.WriteMsg(m)
+}
+
+// poisonTarget is the name outside -base that poisonHandler injects records
+// for, and poisonAddress the address it claims that name has.
+const poisonTarget = "www.example.org."
+
+var poisonAddress = net.IPv4(192, 0, 2, 66)
+
+// poisonHandler serves names of the form <anything>.<section>.poison.<base>
+// with a healthy answer, plus records for poisonTarget, which this server
+// has no authority over, injected into the given section: an A record in
+// answer or additional, or in authority an NS record taking over the zone
+// above poisonTarget. A resolver that accepts the A record will resolve
+// poisonTarget to poisonAddress afterwards, and one that accepts the NS
+// record will send its queries for that zone here.
+func poisonHandler(w dns.ResponseWriter, q *dns.Msg) {
+	logQuery(w, q, "poisonHandler")
+	labels := subLabels(qname(q), zone("poison"))
+	if len(labels) == 0 {
+		txtError(w, q, "query <anything>.<section>.poison.<base> with section answer, authority or additional")
+		return
+	}
+	injected := &dns.A{
+		Hdr: dns.RR_Header{Name: poisonTarget, Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 86400},
+		A:   poisonAddress,
+	}
+	m := new(dns.Msg)
+	m.SetRcode(q, dns.RcodeSuccess)
+	healthyAnswer(m, q, zone("poison"))
+	switch section := strings.ToLower(labels[len(labels)-1]); section {
+	case "answer":
+		m.Answer = append(m.Answer, injected)
+	case "authority":
+		parent, _ := dns.NextLabel(poisonTarget, 0)
+		ns, extra := nsRRset(poisonTarget[parent:], 86400, "ns."+zone("poison"))
+		m.Ns = append(m.Ns, ns...)
+		m.Extra = append(m.Extra, extra...)
+	case "additional":
+		m.Extra = append(m.Extra, injected)
+	default:
+		txtError(w, q, "unknown section "+section)
+		return
+	}
+	w.WriteMsg(m)
+}
+
+// ednsHandler serves names of the form <anything>.<behavior>.edns.<base>
+// with a healthy answer, but mishandles EDNS in the way behavior says:
+//
+//	ignore     leave the OPT record out of the response
+//	formerr    answer FORMERR, without an OPT record, to queries with EDNS
+//	badversion answer with an OPT record claiming EDNS version 1
+//	multiopt   answer with two OPT records, which RFC 6891 makes a FORMERR
+//
+// Queries without EDNS are answered normally, so a resolver that falls back
+// to plain DNS gets its answer.
+func ednsHandler(w dns.ResponseWriter, q *dns.Msg) {
+	logQuery(w, q, "ednsHandler")
+	labels := subLabels(qname(q), zone("edns"))
+	if len(labels) == 0 {
+		txtError(w, q, "query <anything>.<behavior>.edns.<base> with behavior ignore, formerr, badversion or multiopt")
+		return
+	}
+	opt := q.IsEdns0()
+	m := new(dns.Msg)
+	m.SetRcode(q, dns.RcodeSuccess)
+	healthyAnswer(m, q, zone("edns"))
+	if opt == nil {
+		w.WriteMsg(m)
+		return
+	}
+	switch behavior := strings.ToLower(labels[len(labels)-1]); behavior {
+	case "ignore":
+	case "formerr":
+		m = new(dns.Msg)
+		m.SetRcode(q, dns.RcodeFormatError)
+	case "badversion":
+		m.SetEdns0(1232, opt.Do())
+		m.IsEdns0().SetVersion(1)
+	case "multiopt":
+		m.SetEdns0(1232, opt.Do())
+		m.SetEdns0(512, false)
+	default:
+		txtError(w, q, "unknown behavior "+behavior)
+		return
+	}
+	w.WriteMsg(m)
+}
+
+// badEDNSFlagsOption is the code of the option badEDNSFlagsHandler adds,
+// the first one reserved for local and experimental use, which no client
+// should know.
+const badEDNSFlagsOption = dns.EDNS0LOCALSTART
+
+// badEDNSFlagsHandler serves names under badednsflags.<base> with a healthy
+// answer whose OPT record has all the must-be-zero bits of the EDNS flags
+// set, and carries an option of unknown type. RFC 6891 says both are to be
+// ignored, so a client should use the answer as is. Queries without EDNS
+// get no OPT record, and a plain answer.
+func badEDNSFlagsHandler(w dns.ResponseWriter, q *dns.Msg) {
+	logQuery(w, q, "badEDNSFlagsHandler")
+	m := new(dns.Msg)
+	m.SetRcode(q, dns.RcodeSuccess)
+	healthyAnswer(m, q, zone("badednsflags"))
+	if opt := q.IsEdns0(); opt != nil {
+		m.SetEdns0(1232, opt.Do())
+		reply := m.IsEdns0()
+		reply.SetZ(0x3fff)
+		reply.Option = append(reply.Option, &dns.EDNS0_LOCAL{
+			Code: badEDNSFlagsOption,
+			Data: []byte("awful"),
+		})
+	}
+	w.WriteMsg(m)
+}
+
+// decrementStep is how much lower the TTLs in the second response of
+// decrementHandler are.
+const decrementStep = 60
+
+// decrementHandler answers each query under decrement.<base> twice. The first
+// response has three records, with a TTL of 300: A records for 192.0.2.1 to
+// 192.0.2.3, AAAA records for 2001:db8::1 to 2001:db8::3, or TXT records "1"
+// to "3". The second, sent right after it, has the TTLs lowered by
+// decrementStep and the last record left out, like a copy that spent a
+// minute in a cache that since lost a record. A client should take the first
+// and ignore the second, rather than merge the two or let the second
+// overwrite what it cached. Other types get NODATA, twice, with the SOA's
+// TTL lowered in the second.
+func decrementHandler(w dns.ResponseWriter, q *dns.Msg) {
+	logQuery(w, q, "decrementHandler")
+	name := qname(q)
+	m := new(dns.Msg)
+	m.SetRcode(q, dns.RcodeSuccess)
+	m.Authoritative = true
+	hdr := func(rrtype uint16) dns.RR_Header {
+		return dns.RR_Header{Name: name, Rrtype: rrtype, Class: dns.ClassINET, Ttl: 300}
+	}
+	for i := 1; i <= 3; i++ {
+		switch q.Question[0].Qtype {
+		case dns.TypeA:
+			m.Answer = append(m.Answer, &dns.A{Hdr: hdr(dns.TypeA), A: net.IPv4(192, 0, 2, byte(i))})
+		case dns.TypeAAAA:
+			m.Answer = append(m.Answer, &dns.AAAA{Hdr: hdr(dns.TypeAAAA), AAAA: net.ParseIP(fmt.Sprintf("2001:db8::%d", i))})
+		case dns.TypeTXT:
+			m.Answer = append(m.Answer, &dns.TXT{Hdr: hdr(dns.TypeTXT), Txt: []string{strconv.Itoa(i)}})
+		}
+	}
+	if len(m.Answer) == 0 {
+		soa := soaRecord(zone("decrement"))
+		soa.Header().Ttl = 300
+		m.Ns = []dns.RR{soa}
+	}
+	second := m.Copy()
+	if len(second.Answer) > 0 {
+		second.Answer = second.Answer[:len(second.Answer)-1]
+	}
+	for _, rr := range append(second.Answer, second.Ns...) {
+		rr.Header().Ttl -= min(decrementStep, rr.Header().Ttl)
+	}
+	w.WriteMsg(m)
+	w.WriteMsg(second)
+}
+
+// dupesMax is the most copies of a response dupesHandler sends, which bounds
+// how much it amplifies a query.
+const dupesMax = 20
+
+// dupesHandler serves names of the form [<anything>.][rcode.]<n>.dupes.<base>
+// over UDP by sending n copies (default 2) of a healthy answer. With a label
+// rcode, every copy after the first is an NXDOMAIN instead, so a client that
+// lets a later datagram replace the one it took gets a different answer. Over
+// TCP, where there is no room for duplicates, the answer is sent once.
+func dupesHandler(w dns.ResponseWriter, q *dns.Msg) {
+	logQuery(w, q, "dupesHandler")
+	labels := subLabels(qname(q), zone("dupes"))
+	copies, differ := 2, false
+	if len(labels) > 0 {
+		if n, err := strconv.Atoi(labels[len(labels)-1]); err == nil {
+			if n < 1 || n > dupesMax {
+				txtError(w, q, fmt.Sprintf("the number of copies must be between 1 and %d", dupesMax))
+				return
+			}
+			copies = n
+		}
+	}
+	for _, label := range labels {
+		if strings.EqualFold(label, "rcode") {
+			differ = true
+		}
+	}
+	m := new(dns.Msg)
+	m.SetRcode(q, dns.RcodeSuccess)
+	healthyAnswer(m, q, zone("dupes"))
+	w.WriteMsg(m.Copy())
+	if _, udp := w.RemoteAddr().(*net.UDPAddr); !udp {
+		return
+	}
+	if differ {
+		m = new(dns.Msg)
+		m.SetRcode(q, dns.RcodeNameError)
+		m.Authoritative = true
+		m.Ns = []dns.RR{soaRecord(zone("dupes"))}
+	}
+	for i := 1; i < copies; i++ {
+		w.WriteMsg(m.Copy())
+	}
+}
+
+// lateReplyAttempts counts attempts to resolve each name under
+// latereply.<base>, per client, like nthTryAttempts.
+var lateReplyAttempts = newCounters("latereply")
+
+// lateReplyHandler serves names of the form <anything>.<ms>.latereply.<base>.
+// The first attempt to resolve a name is answered, like sleep.<base> does,
+// only after ms milliseconds, past the point where a resolver should have
+// given up on it and retried; the answer is then 198.51.100.1,
+// 2001:db8::2 or TXT "late". The retries are answered right away, with a
+// healthy answer. A resolver that ends up with the late answer matched a
+// response it no longer waited for, perhaps to a newer query. Attempts are
+// counted per session or client address, as for nthtry.<base>.
+func lateReplyHandler(w dns.ResponseWriter, q *dns.Msg) {
+	logQuery(w, q, "lateReplyHandler")
+	name := qname(q)
+	labels := subLabels(name, zone("latereply"))
+	var ms int64 = -1
+	if len(labels) > 0 {
+		// Like sleep.<base>, no more than 16 bits of milliseconds, so no
+		// query holds on to a goroutine for long.
+		var err error
+		if ms, err = strconv.ParseInt(labels[len(labels)-1], 10, 16); err != nil {
+			ms = -1
+		}
+	}
+	if ms < 0 {
+		txtError(w, q, "query <anything>.<ms>.latereply.<base>, with ms from 0 to 32767")
+		return
+	}
+	m := new(dns.Msg)
+	m.SetRcode(q, dns.RcodeSuccess)
+	healthyAnswer(m, q, zone("latereply"))
+	if lateReplyAttempts.incr(retryClient(w)+"|"+strings.ToLower(name), nthTryMemory) > 1 {
+		w.WriteMsg(m)
+		return
+	}
+
+	hdr := func(rrtype uint16) dns.RR_Header {
+		return dns.RR_Header{Name: name, Rrtype: rrtype, Class: dns.ClassINET, Ttl: 300}
+	}
+	switch q.Question[0].Qtype {
+	case dns.TypeA:
+		m.Answer = []dns.RR{&dns.A{Hdr: hdr(dns.TypeA), A: net.ParseIP("198.51.100.1")}}
+	case dns.TypeAAAA:
+		m.Ns = nil
+		m.Answer = []dns.RR{&dns.AAAA{Hdr: hdr(dns.TypeAAAA), AAAA: net.ParseIP("2001:db8::2")}}
+	case dns.TypeTXT:
+		m.Answer = []dns.RR{&dns.TXT{Hdr: hdr(dns.TypeTXT), Txt: []string{"late"}}}
+	}
+	time.Sleep(time.Duration(ms) * time.Millisecond)
+	w.WriteMsg(m)
+}
+
+// flakyAttempts counts the queries for each name under flaky.<base> with a
+// seed, per client and seed, so the drops can be replayed.
+var flakyAttempts = newCounters("flaky")
+
+// flakyHandler serves names of the form
+// [<anything>.][seed<N>.]<percent>.flaky.<base> with a healthy answer, except
+// that it drops percent percent of the queries, at random. With a seed
+// label the drops are instead a function of N, the name and how many times
+// the client (or session, as for nthtry.<base>) has asked for it, so a test
+// run is dropped the same way every time, as long as the names are new or
+// nthTryMemory has passed since the last run.
+func flakyHandler(w dns.ResponseWriter, q *dns.Msg) {
+	logQuery(w, q, "flakyHandler")
+	name := qname(q)
+	labels := subLabels(name, zone("flaky"))
+	percent := int64(-1)
+	if len(labels) > 0 {
+		if n, err := strconv.ParseInt(labels[len(labels)-1], 10, 32); err == nil && n <= 100 {
+			percent = n
+		}
+	}
+	if percent < 0 {
+		txtError(w, q, "query <anything>.<percent>.flaky.<base> with percent from 0 to 100")
+		return
+	}
+	roll := rand.Int64N(100)
+	for _, label := range labels[:len(labels)-1] {
+		label = strings.ToLower(label)
+		if !strings.HasPrefix(label, "seed") {
+			continue
+		}
+		seed, err := strconv.ParseUint(label[len("seed"):], 10, 64)
+		if err != nil {
+			continue
+		}
+		key := fmt.Sprintf("%s|%d|%s", retryClient(w), seed, strings.ToLower(name))
+		attempt := flakyAttempts.incr(key, nthTryMemory)
+		sum := sha256.Sum256(fmt.Appendf(nil, "%d|%s|%d", seed, strings.ToLower(name), attempt))
+		roll = int64(binary.BigEndian.Uint64(sum[:8]) % 100)
+	}
+	if roll < percent {
+		return
+	}
+	m := new(dns.Msg)
+	m.SetRcode(q, dns.RcodeSuccess)
+	healthyAnswer(m, q, zone("flaky"))
+	w.WriteMsg(m)
+}
+
+// parityHandler serves names under parity.<base> with an answer that depends
+// on whether the query's ID is even or odd: 192.0.2.0, 2001:db8:: and TXT
+// "even id" for even IDs, 192.0.2.1, 2001:db8::1 and TXT "odd id" for odd
+// ones. Resolvers pick their IDs at random, so repeated lookups through a
+// cache that keeps to one response get the same answer every time, while
+// one that mixes up responses across transactions, say by merging RRsets
+// from two of them, gives itself away with both addresses, or a mix.
+func parityHandler(w dns.ResponseWriter, q *dns.Msg) {
+	logQuery(w, q, "parityHandler")
+	name := qname(q)
+	odd := q.Id%2 == 1
+	m := new(dns.Msg)
+	m.SetRcode(q, dns.RcodeSuccess)
+	m.Authoritative = true
+	hdr := func(rrtype uint16) dns.RR_Header {
+		return dns.RR_Header{Name: name, Rrtype: rrtype, Class: dns.ClassINET, Ttl: 300}
+	}
+	last, txt := byte(0), "even id"
+	if odd {
+		last, txt = 1, "odd id"
+	}
+	switch q.Question[0].Qtype {
+	case dns.TypeA:
+		m.Answer = []dns.RR{&dns.A{Hdr: hdr(dns.TypeA), A: net.IPv4(192, 0, 2, last)}}
+	case dns.TypeAAAA:
+		aaaa := net.ParseIP("2001:db8::")
+		aaaa[15] = last
+		m.Answer = []dns.RR{&dns.AAAA{Hdr: hdr(dns.TypeAAAA), AAAA: aaaa}}
+	case dns.TypeTXT:
+		m.Answer = []dns.RR{&dns.TXT{Hdr: hdr(dns.TypeTXT), Txt: []string{txt}}}
+	default:
+		m.Ns = []dns.RR{soaRecord(zone("parity"))}
+	}
+	w.WriteMsg(m)
+}
+
+// rcodeHandler serves names of the form [<anything>.]<rcode>.rcode.<base>
+// with the given rcode, named as in the IANA registry (servfail, refused,
+// badcookie and so on) or as a number up to 4095. Rcodes above 15 only fit
+// with the extension in an OPT record, which is added to the response for
+// them, whether the query had EDNS or not. NOERROR comes with a healthy
+// answer, NXDOMAIN with the SOA record, and anything else with nothing.
+func rcodeHandler(w dns.ResponseWriter, q *dns.Msg) {
+	logQuery(w, q, "rcodeHandler")
+	labels := subLabels(qname(q), zone("rcode"))
+	if len(labels) == 0 {
+		txtError(w, q, "query <rcode>.rcode.<base> with rcode a name or number")
+		return
+	}
+	label := labels[len(labels)-1]
+	rcode, ok := dns.StringToRcode[strings.ToUpper(label)]
+	if n, err := strconv.ParseUint(label, 10, 12); err == nil {
+		rcode, ok = int(n), true
+	}
+	if !ok {
+		txtError(w, q, "unknown rcode "+label)
+		return
+	}
+	m := new(dns.Msg)
+	m.SetRcode(q, rcode)
+	switch rcode {
+	case dns.RcodeSuccess:
+		healthyAnswer(m, q, zone("rcode"))
+	case dns.RcodeNameError:
+		m.Authoritative = true
+		m.Ns = []dns.RR{soaRecord(zone("rcode"))}
+	}
+	if opt := q.IsEdns0(); opt != nil || rcode > 0xF {
+		m.SetEdns0(1232, opt != nil && opt.Do())
+	}
+	w.WriteMsg(m)
+}
+
+// inconsistentAddresses is the number of addresses, from 198.18.0.0 on,
+// that inconsistent.<base> picks from, and inconsistentMaxTTL the largest
+// TTL it gives them.
+const (
+	inconsistentAddresses = 1 << 17
+	inconsistentMaxTTL    = 3600
+)
+
+// inconsistentAnswers counts the seeded queries for each name under
+// inconsistent.<base>, per client and seed, and inconsistentLast remembers
+// the address and TTL last given for each name, so the next ones differ.
+var (
+	inconsistentAnswers = newCounters("inconsistent")
+	inconsistentLast    = newCounters("inconsistentlast")
+)
+
+// inconsistentHandler serves names of the form
+// [<anything>.][seed<N>.]inconsistent.<base>. A queries get an address in
+// 198.18.0.0/15 and a TTL from 1 to inconsistentMaxTTL, picked at random and
+// each different from the one before it for the name. With a seed label they
+// are instead a function of N, the name and how many times the client (or
+// session, as for nthtry.<base>) has asked for it, so a test run sees the
+// same sequence every time, as long as the names are new or nthTryMemory has
+// passed since the last run. Other types get a healthy answer.
+func inconsistentHandler(w dns.ResponseWriter, q *dns.Msg) {
+	logQuery(w, q, "inconsistentHandler")
+	name := qname(q)
+	m := new(dns.Msg)
+	m.SetRcode(q, dns.RcodeSuccess)
+	if q.Question[0].Qtype != dns.TypeA {
+		healthyAnswer(m, q, zone("inconsistent"))
+		w.WriteMsg(m)
+		return
+	}
+	lower := strings.ToLower(name)
+	key := lower
+	draw := rand.Uint64()
+	for _, label := range subLabels(name, zone("inconsistent")) {
+		label = strings.ToLower(label)
+		if !strings.HasPrefix(label, "seed") {
+			continue
+		}
+		seed, err := strconv.ParseUint(label[len("seed"):], 10, 64)
+		if err != nil {
+			continue
+		}
+		key = fmt.Sprintf("%s|%d|%s", retryClient(w), seed, lower)
+		attempt := inconsistentAnswers.incr(key, nthTryMemory)
+		sum := sha256.Sum256(fmt.Appendf(nil, "%d|%s|%d", seed, lower, attempt))
+		draw = binary.BigEndian.Uint64(sum[:8])
+	}
+	index := differentFromLast(key+"|a", int64(draw%inconsistentAddresses), inconsistentAddresses)
+	ttl := differentFromLast(key+"|ttl", int64(draw>>32%inconsistentMaxTTL), inconsistentMaxTTL)
+	m.Authoritative = true
+	m.Answer = []dns.RR{&dns.A{
+		Hdr: dns.RR_Header{Name: name, Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: uint32(ttl) + 1},
+		A:   net.IPv4(198, 18+byte(index>>16), byte(index>>8), byte(index)),
+	}}
+	w.WriteMsg(m)
+}
+
+// differentFromLast returns v, a number below n, or the one after it if v is
+// what was returned for key last time.
+func differentFromLast(key string, v, n int64) int64 {
+	if last, ok := inconsistentLast.get(key); ok && last == v {
+		v = (v + 1) % n
+	}
+	inconsistentLast.set(key, v, nthTryMemory)
+	return v
+}
+
+// ttlHandler serves names of the form [<anything>.][nx.]<ttl>.ttl.<base>
+// with a healthy answer in which every record has a TTL of ttl, which can be
+// anything a TTL field holds: 0, 1, 2147483647 (2^31-1, the most RFC 2181
+// allows) or anything above that up to 4294967295, which resolvers should
+// treat as 0 but often cap or take as is. Negative answers carry the same
+// TTL on the SOA and in its MINIMUM field, and with a label nx the name
+// doesn't exist, so negative caching can be tested the same way.
+func ttlHandler(w dns.ResponseWriter, q *dns.Msg) {
+	logQuery(w, q, "ttlHandler")
+	labels := subLabels(qname(q), zone("ttl"))
+	ttl := int64(-1)
+	if len(labels) > 0 {
+		if n, err := strconv.ParseUint(labels[len(labels)-1], 10, 32); err == nil {
+			ttl = int64(n)
+		}
+	}
+	if ttl < 0 {
+		txtError(w, q, "query <anything>.<ttl>.ttl.<base> with ttl from 0 to 4294967295")
+		return
+	}
+	nx := false
+	for _, label := range labels[:len(labels)-1] {
+		nx = nx || strings.EqualFold(label, "nx")
+	}
+	m := new(dns.Msg)
+	m.SetRcode(q, dns.RcodeSuccess)
+	if nx {
+		m.Rcode = dns.RcodeNameError
+		m.Authoritative = true
+		m.Ns = []dns.RR{soaRecord(zone("ttl"))}
+	} else {
+		healthyAnswer(m, q, zone("ttl"))
+	}
+	for _, rr := range append(m.Answer, m.Ns...) {
+		rr.Header().Ttl = uint32(ttl)
+		if soa, ok := rr.(*dns.SOA); ok {
+			soa.Minttl = uint32(ttl)
+		}
+	}
+	w.WriteMsg(m)
+}
+
+// wrongTypeHandler answers like a healthy zone, with NOERROR and a nonempty
+// answer section, except that the records in it are of a type other than
+// the one asked for: TXT, or A for TXT queries. A label anywhere below
+// wrongtype picks the type: a, aaaa (2001:db8::1 if there is no
+// -advertise-ip6), srv, txt, or type<N> for a record of type N, with empty
+// RDATA unless it is one of those. A label naming the type asked for is
+// ignored, so the answer is never right. Resolvers and stubs should treat the
+// answer as NODATA, and not hand the records to whoever asked for another
+// type.
+func wrongTypeHandler(w dns.ResponseWriter, q *dns.Msg) {
+	logQuery(w, q, "wrongTypeHandler")
+	name := qname(q)
+	fallback := uint16(dns.TypeTXT)
+	if q.Question[0].Qtype == dns.TypeTXT {
+		fallback = dns.TypeA
+	}
+	rrtype := fallback
+	for _, label := range subLabels(name, zone("wrongtype")) {
+		switch label = strings.ToLower(label); label {
+		case "a", "aaaa", "srv", "txt":
+			rrtype = dns.StringToType[strings.ToUpper(label)]
+		default:
+			if !strings.HasPrefix(label, "type") {
+				continue
+			}
+			if n, err := strconv.ParseUint(label[len("type"):], 10, 16); err == nil {
+				rrtype = uint16(n)
+			}
+		}
+	}
+	if rrtype == q.Question[0].Qtype {
+		rrtype = fallback
+	}
+
+	m := new(dns.Msg)
+	m.SetRcode(q, dns.RcodeSuccess)
+	asked := q.Copy()
+	asked.Question[0].Qtype = rrtype
+	healthyAnswer(m, asked, zone("wrongtype"))
+	if len(m.Answer) == 0 {
+		m.Ns = nil
+		hdr := dns.RR_Header{Name: name, Rrtype: rrtype, Class: dns.ClassINET}
+		if rrtype == dns.TypeAAAA {
+			m.Answer = []dns.RR{&dns.AAAA{Hdr: hdr, AAAA: net.ParseIP("2001:db8::1")}}
+		} else {
+			m.Answer = []dns.RR{&dns.RFC3597{Hdr: hdr}}
+		}
+	}
+	w.WriteMsg(m)
+}
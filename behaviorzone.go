@@ -0,0 +1,303 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+var behaviorPrimary = flag.String("behavior-primary", "", "host:port of a primary to transfer -behavior-zone from. Disabled if empty.")
+var behaviorZone = flag.String("behavior-zone", "", "behavior zone to transfer from -behavior-primary.")
+var behaviorRefresh = flag.Duration("behavior-refresh", 0, "how often to check -behavior-primary for a new serial. Defaults to the zone's SOA refresh.")
+
+// A behavior zone assigns behaviors to names under -base with TXT records,
+// so that the names a team tests against can be managed like any other zone,
+// with the usual tooling and review. For -behavior-zone behaviors.example.net
+// it looks like this:
+//
+//	shop.behaviors.example.net.  TXT "awful=800.sleep"
+//	api.behaviors.example.net.   TXT "awful=tc-txt.preset"
+//
+// With that, queries for shop.<base> and any name below it are served as if
+// they asked for 800.sleep.<base>, like an override that applies to every
+// client. TXT strings that don't start with "awful=" are ignored, so the
+// records can carry comments.
+//
+// The server acts as a secondary for the zone. It transfers it on startup,
+// then checks the primary's SOA serial every -behavior-refresh and transfers
+// again when it changes, with IXFR once it has a copy to apply the changes
+// to. A NOTIFY for the zone from the primary triggers a check right away.
+
+var (
+	behaviorsMu sync.Mutex
+	// behaviors maps fully qualified names under -base to the name, relative
+	// to -base, they are served as.
+	behaviors = make(map[string]string)
+	// behaviorSOA is the SOA of the copy of the zone, or nil before the
+	// first transfer.
+	behaviorSOA *dns.SOA
+	// behaviorRRs is the copy of the zone, keyed by behaviorKey.
+	behaviorRRs = make(map[string]dns.RR)
+)
+
+// behaviorNotify asks the refresh loop for an early check.
+var behaviorNotify = make(chan struct{}, 1)
+
+// behaviorRetry is how long to wait after a failed transfer when the zone
+// hasn't given us an SOA retry yet.
+const behaviorRetry = 30 * time.Second
+
+// behaviorMinWait is the shortest wait between checks of the primary.
+const behaviorMinWait = 5 * time.Second
+
+// behaviorFor returns the name q should be served as, if the behavior zone
+// assigns one to its name or the closest enclosing name that has one.
+func behaviorFor(q *dns.Msg) (string, bool) {
+	base := dns.Fqdn(*basename)
+	name := strings.ToLower(qname(q))
+	if !dns.IsSubDomain(base, name) {
+		return "", false
+	}
+	behaviorsMu.Lock()
+	defer behaviorsMu.Unlock()
+	if len(behaviors) == 0 {
+		return "", false
+	}
+	for off, end := 0, false; !end; off, end = dns.NextLabel(name, off) {
+		if dns.CountLabel(name[off:]) <= dns.CountLabel(base) {
+			break
+		}
+		if behavior, ok := behaviors[name[off:]]; ok {
+			return dns.Fqdn(behavior + "." + *basename), true
+		}
+	}
+	return "", false
+}
+
+// serveBehaviorZone starts transferring -behavior-zone, if it is set.
+func serveBehaviorZone() error {
+	if *behaviorPrimary == "" {
+		return nil
+	}
+	if *behaviorZone == "" {
+		return fmt.Errorf("-behavior-primary needs -behavior-zone")
+	}
+	if _, _, err := net.SplitHostPort(*behaviorPrimary); err != nil {
+		return fmt.Errorf("-behavior-primary: %s", err)
+	}
+	mux.HandleFunc(dns.Fqdn(*behaviorZone), behaviorNotifyHandler)
+	go refreshBehaviors()
+	return nil
+}
+
+// refreshBehaviors keeps the copy of the behavior zone up to date.
+func refreshBehaviors() {
+	for {
+		wait, err := checkBehaviors()
+		if err != nil {
+			log.Printf("behavior zone: %s", err)
+		}
+		select {
+		case <-time.After(wait):
+		case <-behaviorNotify:
+		}
+	}
+}
+
+// checkBehaviors transfers the zone if the primary has a new serial, and
+// returns how long to wait before the next check.
+func checkBehaviors() (time.Duration, error) {
+	zone := dns.Fqdn(*behaviorZone)
+	behaviorsMu.Lock()
+	soa := behaviorSOA
+	behaviorsMu.Unlock()
+	// A refresh or retry of 0 in the SOA would have the primary asked again
+	// at once, over and over, so the wait is never shorter than
+	// behaviorMinWait.
+	wait := func(soa *dns.SOA, failed bool) time.Duration {
+		switch {
+		case soa == nil:
+			return behaviorRetry
+		case failed:
+			return max(time.Duration(soa.Retry)*time.Second, behaviorMinWait)
+		case *behaviorRefresh > 0:
+			return max(*behaviorRefresh, behaviorMinWait)
+		}
+		return max(time.Duration(soa.Refresh)*time.Second, behaviorMinWait)
+	}
+
+	if soa != nil {
+		serial, err := primarySerial(zone)
+		if err != nil {
+			return wait(soa, true), err
+		}
+		if serial == soa.Serial {
+			return wait(soa, false), nil
+		}
+	}
+	rrs, err := transferBehaviors(zone, soa)
+	if err != nil {
+		return wait(soa, true), err
+	}
+	newSOA, err := applyTransfer(zone, soa, rrs)
+	if err != nil {
+		return wait(soa, true), err
+	}
+	return wait(newSOA, false), nil
+}
+
+// primarySerial asks the primary for the zone's SOA serial.
+func primarySerial(zone string) (uint32, error) {
+	m := new(dns.Msg)
+	m.SetQuestion(zone, dns.TypeSOA)
+	r, _, err := new(dns.Client).Exchange(m, *behaviorPrimary)
+	if err != nil {
+		return 0, err
+	}
+	for _, rr := range r.Answer {
+		if soa, ok := rr.(*dns.SOA); ok {
+			return soa.Serial, nil
+		}
+	}
+	return 0, fmt.Errorf("no SOA for %s from %s (%s)", zone, *behaviorPrimary, dns.RcodeToString[r.Rcode])
+}
+
+// transferBehaviors transfers the zone from the primary, with IXFR from soa
+// if there is one, and returns the records it sent.
+func transferBehaviors(zone string, soa *dns.SOA) ([]dns.RR, error) {
+	m := new(dns.Msg)
+	if soa != nil {
+		m.SetIxfr(zone, soa.Serial, soa.Ns, soa.Mbox)
+	} else {
+		m.SetAxfr(zone)
+	}
+	envelopes, err := new(dns.Transfer).In(m, *behaviorPrimary)
+	if err != nil {
+		return nil, err
+	}
+	var rrs []dns.RR
+	for e := range envelopes {
+		if e.Error != nil {
+			return nil, e.Error
+		}
+		rrs = append(rrs, e.RR...)
+	}
+	return rrs, nil
+}
+
+// applyTransfer updates the copy of the zone from what a transfer sent, which
+// is either a whole zone or, for IXFR, the differences from the serial in
+// soa. It returns the new SOA.
+func applyTransfer(zone string, soa *dns.SOA, rrs []dns.RR) (*dns.SOA, error) {
+	if len(rrs) == 0 {
+		return nil, fmt.Errorf("empty transfer of %s", zone)
+	}
+	newSOA, ok := rrs[0].(*dns.SOA)
+	if !ok {
+		return nil, fmt.Errorf("transfer of %s doesn't start with an SOA", zone)
+	}
+	if len(rrs) == 1 {
+		// An IXFR response saying we are up to date.
+		if soa != nil && newSOA.Serial == soa.Serial {
+			return soa, nil
+		}
+		return nil, fmt.Errorf("transfer of %s has nothing but an SOA", zone)
+	}
+	last, ok := rrs[len(rrs)-1].(*dns.SOA)
+	if !ok || last.Serial != newSOA.Serial {
+		return nil, fmt.Errorf("transfer of %s doesn't end with its SOA", zone)
+	}
+
+	behaviorsMu.Lock()
+	defer behaviorsMu.Unlock()
+	zoneRRs := make(map[string]dns.RR)
+	kind := "AXFR"
+	if _, incremental := rrs[1].(*dns.SOA); incremental && soa != nil {
+		// Sequences of an old SOA followed by the records deleted since,
+		// then a newer SOA followed by the records added.
+		kind = "IXFR"
+		for k, rr := range behaviorRRs {
+			zoneRRs[k] = rr
+		}
+		adding := true
+		for _, rr := range rrs[1 : len(rrs)-1] {
+			if _, ok := rr.(*dns.SOA); ok {
+				adding = !adding
+				continue
+			}
+			if adding {
+				zoneRRs[behaviorKey(rr)] = rr
+			} else {
+				delete(zoneRRs, behaviorKey(rr))
+			}
+		}
+	} else {
+		for _, rr := range rrs[1 : len(rrs)-1] {
+			zoneRRs[behaviorKey(rr)] = rr
+		}
+	}
+
+	assigned := make(map[string]string)
+	for _, rr := range zoneRRs {
+		txt, ok := rr.(*dns.TXT)
+		if !ok {
+			continue
+		}
+		owner := strings.ToLower(txt.Hdr.Name)
+		labels := subLabels(owner, zone)
+		if len(labels) == 0 || !dns.IsSubDomain(zone, owner) {
+			continue
+		}
+		for _, s := range txt.Txt {
+			if behavior, ok := strings.CutPrefix(s, "awful="); ok {
+				name := dns.Fqdn(strings.Join(labels, ".") + "." + *basename)
+				assigned[name] = strings.Trim(strings.ToLower(behavior), ".")
+			}
+		}
+	}
+	behaviorRRs = zoneRRs
+	behaviors = assigned
+	behaviorSOA = newSOA
+	log.Printf("behavior zone: %s of %s serial %d, %d names assigned", kind, zone, newSOA.Serial, len(assigned))
+	return newSOA, nil
+}
+
+// behaviorKey identifies a record regardless of its TTL, so that IXFR
+// deletions match the records they delete.
+func behaviorKey(rr dns.RR) string {
+	rr = dns.Copy(rr)
+	rr.Header().Ttl = 0
+	return strings.ToLower(rr.String())
+}
+
+// behaviorNotifyHandler answers NOTIFY messages for the behavior zone from
+// the primary by checking for a new serial, and anything else for the zone
+// like unknownHandler.
+func behaviorNotifyHandler(w dns.ResponseWriter, q *dns.Msg) {
+	if q.Opcode != dns.OpcodeNotify {
+		unknownHandler(w, q)
+		return
+	}
+	logQuery(w, q, "behaviorNotifyHandler")
+	m := new(dns.Msg)
+	primary, _, _ := net.SplitHostPort(*behaviorPrimary)
+	if addrs, err := net.LookupHost(primary); err != nil || !slices.Contains(addrs, clientIP(w)) {
+		m.SetRcode(q, dns.RcodeRefused)
+		w.WriteMsg(m)
+		return
+	}
+	m.SetReply(q)
+	m.Authoritative = true
+	w.WriteMsg(m)
+	select {
+	case behaviorNotify <- struct{}{}:
+	default:
+	}
+}
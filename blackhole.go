@@ -0,0 +1,39 @@
+package main
+
+import (
+	"flag"
+	"io"
+	"sync/atomic"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+var blackholeHold = flag.Duration("blackhole-hold", 10*time.Minute, "longest time blackhole.<base> holds a TCP connection open for.")
+var blackholeMax = flag.Int("blackhole-max", 1000, "most TCP connections blackhole.<base> holds open at once. Beyond that, connections are closed without a response.")
+
+// blackholeHeld counts the TCP connections blackhole.<base> is holding open.
+var blackholeHeld atomic.Int64
+
+// blackholeHandler never responds to queries under blackhole.<base>. Over
+// plain TCP it also keeps the connection open, reading and throwing away
+// whatever the client sends, until the client hangs up or -blackhole-hold
+// runs out. At most -blackhole-max connections are held like that, so that a
+// pile of clients can't run the server out of file descriptors; the rest are
+// closed straight away.
+func blackholeHandler(w dns.ResponseWriter, q *dns.Msg) {
+	logQuery(w, q, "blackholeHandler")
+	conn := tcpConnFor(w)
+	if conn == nil {
+		return
+	}
+	if blackholeHeld.Add(1) > int64(*blackholeMax) {
+		blackholeHeld.Add(-1)
+		w.Close()
+		return
+	}
+	defer blackholeHeld.Add(-1)
+	conn.SetReadDeadline(time.Now().Add(*blackholeHold))
+	io.Copy(io.Discard, conn)
+	w.Close()
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"log"
+	"net/http"
+	"net/netip"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+var capabilitiesLog = flag.Duration("capabilities-log", time.Hour, "how often to log a summary of the capabilities of the clients seen, such as EDNS and DO bit use. 0 disables it.")
+
+// capabilities counts what the queries from one population of clients
+// support.
+type capabilities struct {
+	Queries uint64 `json:"queries"`
+	EDNS    uint64 `json:"edns"`
+	DO      uint64 `json:"do"`
+	Cookies uint64 `json:"cookies"`
+	TCP     uint64 `json:"tcp"`
+	// BufferSizes counts EDNS queries by the UDP payload size they
+	// advertise.
+	BufferSizes map[uint16]uint64 `json:"buffer_sizes"`
+}
+
+func (c *capabilities) record(q *dns.Msg, tcp bool) {
+	c.Queries++
+	if tcp {
+		c.TCP++
+	}
+	opt := q.IsEdns0()
+	if opt == nil {
+		return
+	}
+	c.EDNS++
+	if opt.Do() {
+		c.DO++
+	}
+	for _, o := range opt.Option {
+		if _, ok := o.(*dns.EDNS0_COOKIE); ok {
+			c.Cookies++
+			break
+		}
+	}
+	if c.BufferSizes == nil {
+		c.BufferSizes = make(map[uint16]uint64)
+	}
+	c.BufferSizes[opt.UDPSize()]++
+}
+
+var (
+	capabilitiesMu sync.Mutex
+	// allCapabilities counts every query.
+	allCapabilities capabilities
+	// sourceCapabilities is keyed by the client's ASN if there is an
+	// -asn-db, and otherwise by its /24 or /48. Once it has
+	// capabilitiesMaxSources of them, queries from new sources are counted
+	// under "other".
+	sourceCapabilities = make(map[string]*capabilities)
+)
+
+// capabilitiesMaxSources bounds the number of sources in sourceCapabilities.
+const capabilitiesMaxSources = 10000
+
+// recordCapabilities accounts for the capabilities of q, which was sent to w.
+func recordCapabilities(w dns.ResponseWriter, q *dns.Msg) {
+	client := clientIP(w)
+	source := clientPrefix(client)
+	if asns != nil {
+		source = "AS" + asns.lookup(client)
+	}
+	tcp := strings.HasPrefix(w.RemoteAddr().Network(), "tcp")
+	capabilitiesMu.Lock()
+	defer capabilitiesMu.Unlock()
+	allCapabilities.record(q, tcp)
+	if sourceCapabilities[source] == nil {
+		if len(sourceCapabilities) >= capabilitiesMaxSources {
+			source = "other"
+		}
+		if sourceCapabilities[source] == nil {
+			sourceCapabilities[source] = new(capabilities)
+		}
+	}
+	sourceCapabilities[source].record(q, tcp)
+}
+
+// clientPrefix returns the /24 or /48 that client is in.
+func clientPrefix(client string) string {
+	addr, err := netip.ParseAddr(client)
+	if err != nil {
+		return "unknown"
+	}
+	addr = addr.Unmap()
+	bits := 24
+	if addr.Is6() {
+		bits = 48
+	}
+	prefix, _ := addr.Prefix(bits)
+	return prefix.String()
+}
+
+// capabilitiesAdminHandler exports the capabilities seen, in total and per
+// source, as JSON.
+func capabilitiesAdminHandler(w http.ResponseWriter, r *http.Request) {
+	capabilitiesMu.Lock()
+	body, err := json.MarshalIndent(struct {
+		Total   capabilities             `json:"total"`
+		Sources map[string]*capabilities `json:"sources"`
+	}{allCapabilities, sourceCapabilities}, "", "  ")
+	capabilitiesMu.Unlock()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(body)
+}
+
+// logCapabilities logs a summary of the capabilities seen every
+// -capabilities-log.
+func logCapabilities() {
+	for range time.Tick(*capabilitiesLog) {
+		capabilitiesMu.Lock()
+		c := allCapabilities
+		sizes := make([]uint16, 0, len(c.BufferSizes))
+		for size := range c.BufferSizes {
+			sizes = append(sizes, size)
+		}
+		sort.Slice(sizes, func(i, j int) bool { return c.BufferSizes[sizes[i]] > c.BufferSizes[sizes[j]] })
+		var common []string
+		for _, size := range sizes[:min(3, len(sizes))] {
+			common = append(common, percent(c.BufferSizes[size], c.EDNS)+" "+strconv.Itoa(int(size)))
+		}
+		sources := len(sourceCapabilities)
+		capabilitiesMu.Unlock()
+		if c.Queries == 0 {
+			continue
+		}
+		log.Printf("capabilities: %d queries from %d sources: %s EDNS, %s DO, %s cookies, %s TCP; buffer sizes %s",
+			c.Queries, sources, percent(c.EDNS, c.Queries), percent(c.DO, c.Queries),
+			percent(c.Cookies, c.Queries), percent(c.TCP, c.Queries), strings.Join(common, ", "))
+	}
+}
+
+// percent formats n as a percentage of total.
+func percent(n, total uint64) string {
+	if total == 0 {
+		return "0%"
+	}
+	return strconv.FormatFloat(100*float64(n)/float64(total), 'f', 1, 64) + "%"
+}
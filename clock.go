@@ -0,0 +1,47 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+var clockOffset = flag.Duration("clock-offset", 0, "amount to shift the clock by when generating RRSIG inception and expiration times, e.g. -48h, so that signatures can be made to look expired or not yet valid without touching the host clock.")
+var subtreeClockOffset = flag.String("subtree-clock-offset", "", "per-subtree overrides of -clock-offset, as comma separated name=duration pairs with names relative to -base, e.g. signed=-30h,bogus.signed=72h. The longest matching name wins.")
+
+// subtreeClockOffsets holds the parsed value of -subtree-clock-offset, keyed
+// by fully qualified name in lowercase.
+var subtreeClockOffsets map[string]time.Duration
+
+// parseClockOffsets fills in subtreeClockOffsets.
+func parseClockOffsets() error {
+	values, err := parseHandlerValues(*subtreeClockOffset)
+	if err != nil {
+		return err
+	}
+	subtreeClockOffsets = make(map[string]time.Duration)
+	for name, v := range values {
+		offset, err := time.ParseDuration(v)
+		if err != nil {
+			return fmt.Errorf("-subtree-clock-offset: bad offset %q for %s", v, name)
+		}
+		subtreeClockOffsets[strings.ToLower(dns.Fqdn(name+"."+*basename))] = offset
+	}
+	return nil
+}
+
+// signingTime returns the time to base the validity period of a signature
+// over records owned by name on: now, shifted by the offset for the closest
+// enclosing subtree in -subtree-clock-offset, or else by -clock-offset.
+func signingTime(name string) time.Time {
+	name = strings.ToLower(dns.Fqdn(name))
+	for off, end := 0, false; !end; off, end = dns.NextLabel(name, off) {
+		if offset, ok := subtreeClockOffsets[name[off:]]; ok {
+			return time.Now().Add(offset)
+		}
+	}
+	return time.Now().Add(*clockOffset)
+}
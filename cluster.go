@@ -0,0 +1,295 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+var clusterCoordinator = flag.String("cluster-coordinator", "", "base URL of the admin API of the instance coordinating a cluster, e.g. http://10.0.0.1:8053. This instance joins the cluster if set.")
+var clusterName = flag.String("cluster-name", "", "single label naming this instance in the cluster, e.g. ns2. It serves cluster.<base> as <label>.cluster.<base>.")
+
+// In cluster mode, instances on different hosts serve cluster.<base>
+// together, so that resolvers see several authoritative servers that each
+// behave differently. Every member registers with a coordinator, which can
+// be any instance with an admin API, and learns about the others from it.
+// The coordinator assigns each member a role through its admin API:
+//
+//	healthy   answers normally
+//	lame      answers REFUSED
+//	slow      answers after clusterSlowDelay
+//	servfail  answers SERVFAIL
+//	drop      doesn't answer
+//
+// Every member serves the NS RRset of cluster.<base> naming all the live
+// members, as <label>.cluster.<base>, with glue for them. For resolvers to
+// use them all, cluster.<base> has to be delegated to the same set in the
+// parent.
+
+const (
+	// clusterHeartbeat is how often members register with the
+	// coordinator and pick up the cluster's membership.
+	clusterHeartbeat = 15 * time.Second
+	// clusterMemberTTL is how long the coordinator keeps a member that
+	// stopped registering.
+	clusterMemberTTL = 3 * clusterHeartbeat
+	// clusterSlowDelay is how long members with role slow wait.
+	clusterSlowDelay = 2 * time.Second
+)
+
+// A clusterMember is one instance in the cluster.
+type clusterMember struct {
+	Name string    `json:"name"`
+	IPv4 string    `json:"ipv4"`
+	IPv6 string    `json:"ipv6,omitempty"`
+	Role string    `json:"role"`
+	Seen time.Time `json:"seen"`
+}
+
+var (
+	clusterMu sync.Mutex
+	// clusterRegistry holds the members that registered with this
+	// instance, if it is a coordinator, keyed by name.
+	clusterRegistry = make(map[string]*clusterMember)
+	// clusterView is the membership as last heard from the coordinator.
+	clusterView []clusterMember
+)
+
+// joinCluster starts registering with -cluster-coordinator, if it is set.
+func joinCluster() error {
+	if *clusterCoordinator == "" {
+		return nil
+	}
+	if *clusterName == "" || strings.Contains(*clusterName, ".") {
+		return fmt.Errorf("-cluster-coordinator needs -cluster-name to be a single label")
+	}
+	if _, err := url.Parse(*clusterCoordinator); err != nil {
+		return fmt.Errorf("-cluster-coordinator: %s", err)
+	}
+	go func() {
+		for {
+			if err := registerWithCoordinator(); err != nil {
+				log.Printf("cluster: registering with %s: %s", *clusterCoordinator, err)
+			}
+			time.Sleep(clusterHeartbeat)
+		}
+	}()
+	return nil
+}
+
+// registerWithCoordinator registers this instance and updates clusterView
+// with the membership the coordinator sends back.
+func registerWithCoordinator() error {
+	form := url.Values{
+		"action": {"register"},
+		"name":   {*clusterName},
+		"ipv4":   {advertise4.String()},
+	}
+	if advertise6 != nil {
+		form.Set("ipv6", advertise6.String())
+	}
+	resp, err := webhookClient.PostForm(strings.TrimSuffix(*clusterCoordinator, "/")+"/cluster", form)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s", resp.Status)
+	}
+	var members []clusterMember
+	if err := json.NewDecoder(resp.Body).Decode(&members); err != nil {
+		return err
+	}
+	clusterMu.Lock()
+	clusterView = members
+	clusterMu.Unlock()
+	return nil
+}
+
+// clusterAdminHandler lists the live members as JSON on GET. On POST it
+// registers a member with ?action=register&name=<label>&ipv4=<addr>, and
+// optionally &ipv6=<addr>, responding with the list, or sets a member's role
+// with ?action=assign&name=<label>&role=<role>.
+func clusterAdminHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		if !requirePost(w, r) {
+			return
+		}
+		name := strings.ToLower(r.FormValue("name"))
+		if name == "" || strings.Contains(name, ".") {
+			http.Error(w, "name must be a single label", http.StatusBadRequest)
+			return
+		}
+		switch action := r.FormValue("action"); action {
+		case "register":
+			ip4 := net.ParseIP(r.FormValue("ipv4")).To4()
+			if ip4 == nil {
+				http.Error(w, "ipv4 must be an IPv4 address", http.StatusBadRequest)
+				return
+			}
+			var ip6 string
+			if s := r.FormValue("ipv6"); s != "" {
+				if addr := net.ParseIP(s); addr == nil || addr.To4() != nil {
+					http.Error(w, "ipv6 must be an IPv6 address", http.StatusBadRequest)
+					return
+				}
+				ip6 = s
+			}
+			clusterMu.Lock()
+			m := clusterRegistry[name]
+			if m == nil {
+				m = &clusterMember{Name: name, Role: "healthy"}
+				clusterRegistry[name] = m
+				log.Printf("cluster: %s joined from %s", name, ip4)
+			}
+			m.IPv4, m.IPv6, m.Seen = ip4.String(), ip6, time.Now()
+			clusterMu.Unlock()
+		case "assign":
+			role := r.FormValue("role")
+			switch role {
+			case "healthy", "lame", "slow", "servfail", "drop":
+			default:
+				http.Error(w, fmt.Sprintf("unknown role %q", role), http.StatusBadRequest)
+				return
+			}
+			clusterMu.Lock()
+			m := clusterRegistry[name]
+			if m != nil {
+				m.Role = role
+			}
+			clusterMu.Unlock()
+			if m == nil {
+				http.Error(w, fmt.Sprintf("no member %q", name), http.StatusNotFound)
+				return
+			}
+			log.Printf("cluster: %s assigned role %s", name, role)
+		default:
+			http.Error(w, fmt.Sprintf("unknown action %q", action), http.StatusBadRequest)
+			return
+		}
+	}
+	body, err := json.MarshalIndent(liveClusterMembers(), "", "  ")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(body)
+}
+
+// liveClusterMembers returns the members registered with this instance that
+// haven't timed out, sorted by name.
+func liveClusterMembers() []clusterMember {
+	clusterMu.Lock()
+	defer clusterMu.Unlock()
+	members := []clusterMember{}
+	for name, m := range clusterRegistry {
+		if time.Since(m.Seen) > clusterMemberTTL {
+			delete(clusterRegistry, name)
+			continue
+		}
+		members = append(members, *m)
+	}
+	sort.Slice(members, func(i, j int) bool { return members[i].Name < members[j].Name })
+	return members
+}
+
+// clusterHandler serves cluster.<base> according to this instance's role,
+// as described above. <label>.cluster.<base> resolves to the addresses of
+// the member called label.
+func clusterHandler(w dns.ResponseWriter, q *dns.Msg) {
+	logQuery(w, q, "clusterHandler")
+	clusterMu.Lock()
+	members := clusterView
+	clusterMu.Unlock()
+	if len(members) == 0 {
+		txtError(w, q, "this instance is not part of a cluster (-cluster-coordinator).")
+		return
+	}
+	apex := zone("cluster")
+	name := qname(q)
+	var self *clusterMember
+	var ns, extra []dns.RR
+	for i, member := range members {
+		if member.Name == strings.ToLower(*clusterName) {
+			self = &members[i]
+		}
+		host := member.Name + "." + apex
+		ns = append(ns, &dns.NS{
+			Hdr: dns.RR_Header{Name: apex, Rrtype: dns.TypeNS, Class: dns.ClassINET, Ttl: 300},
+			Ns:  host,
+		})
+		extra = append(extra, memberAddresses(member, host)...)
+	}
+
+	m := new(dns.Msg)
+	m.SetRcode(q, dns.RcodeSuccess)
+	if self != nil {
+		switch self.Role {
+		case "drop":
+			return
+		case "lame":
+			m.Rcode = dns.RcodeRefused
+			w.WriteMsg(m)
+			return
+		case "servfail":
+			m.Rcode = dns.RcodeServerFailure
+			w.WriteMsg(m)
+			return
+		case "slow":
+			time.Sleep(clusterSlowDelay)
+		}
+	}
+	m.Authoritative = true
+	qtype := q.Question[0].Qtype
+	if qtype == dns.TypeNS && strings.EqualFold(name, apex) {
+		m.Answer, m.Extra = ns, extra
+		w.WriteMsg(m)
+		return
+	}
+	for _, member := range members {
+		if !strings.EqualFold(name, member.Name+"."+apex) {
+			continue
+		}
+		for _, rr := range memberAddresses(member, name) {
+			if rr.Header().Rrtype == qtype {
+				m.Answer = append(m.Answer, rr)
+			}
+		}
+		if len(m.Answer) == 0 {
+			m.Ns = []dns.RR{soaRecord(apex)}
+		}
+		w.WriteMsg(m)
+		return
+	}
+	healthyAnswer(m, q, apex)
+	if len(m.Answer) > 0 {
+		m.Ns, m.Extra = ns, extra
+	}
+	w.WriteMsg(m)
+}
+
+// memberAddresses returns the A and AAAA records of member, owned by host.
+func memberAddresses(member clusterMember, host string) []dns.RR {
+	rrs := []dns.RR{&dns.A{
+		Hdr: dns.RR_Header{Name: host, Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 300},
+		A:   net.ParseIP(member.IPv4),
+	}}
+	if member.IPv6 != "" {
+		rrs = append(rrs, &dns.AAAA{
+			Hdr:  dns.RR_Header{Name: host, Rrtype: dns.TypeAAAA, Class: dns.ClassINET, Ttl: 300},
+			AAAA: net.ParseIP(member.IPv6),
+		})
+	}
+	return rrs
+}
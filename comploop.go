@@ -0,0 +1,114 @@
+package main
+
+import (
+	"encoding/binary"
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// compLoopKinds describe the ways comploop.<base> abuses compression
+// pointers. miekg/dns only ever writes pointers to earlier names, so these
+// responses are put together byte by byte.
+var compLoopKinds = map[string]string{
+	"self":     "the answer's owner name is a pointer to itself",
+	"loop":     "the answer is a CNAME whose owner name ends in a pointer to its target, which ends in a pointer back to the owner",
+	"question": "the question name is a pointer to itself",
+	"forward":  "the answer's owner name is a pointer forward, to the owner of a record in the additional section",
+}
+
+// compLoopHandler serves names of the form <kind>.comploop.<base>, with a
+// response whose compression pointers are broken as described in
+// compLoopKinds. Pointers that loop have hung and crashed resolvers, so
+// clients must give up on them; forward pointers are not allowed by RFC 1035
+// section 4.1.4, though some parsers follow them anyway.
+func compLoopHandler(w dns.ResponseWriter, q *dns.Msg) {
+	logQuery(w, q, "compLoopHandler")
+	name := qname(q)
+	labels := subLabels(name, zone("comploop"))
+	var kind string
+	if len(labels) > 0 {
+		kind = strings.ToLower(labels[len(labels)-1])
+	}
+	if _, ok := compLoopKinds[kind]; !ok {
+		var kinds []string
+		for k := range compLoopKinds {
+			kinds = append(kinds, k)
+		}
+		sort.Strings(kinds)
+		txtError(w, q, "query <kind>.comploop.<base> with kind one of "+strings.Join(kinds, ", "))
+		return
+	}
+
+	question := packName(name)
+	additional := uint16(0)
+	if kind == "forward" {
+		additional = 1
+	}
+	wire := make([]byte, 12, 512)
+	binary.BigEndian.PutUint16(wire[0:], q.Id)
+	flags := uint16(1<<15 | 1<<10) // QR, AA
+	if q.RecursionDesired {
+		flags |= 1 << 8
+	}
+	binary.BigEndian.PutUint16(wire[2:], flags)
+	binary.BigEndian.PutUint16(wire[4:], 1)
+	binary.BigEndian.PutUint16(wire[6:], 1)
+	binary.BigEndian.PutUint16(wire[10:], additional)
+	if kind == "question" {
+		question = pointerTo(12)
+	}
+	wire = append(wire, question...)
+	wire = binary.BigEndian.AppendUint16(wire, q.Question[0].Qtype)
+	wire = binary.BigEndian.AppendUint16(wire, q.Question[0].Qclass)
+
+	// owner is where the answer starts, and target where its RDATA starts.
+	owner := len(wire)
+	switch kind {
+	case "self":
+		wire = append(wire, pointerTo(owner)...)
+		wire = appendA(wire)
+	case "question":
+		wire = append(wire, pointerTo(12)...)
+		wire = appendA(wire)
+	case "loop":
+		target := owner + 4 + 10
+		wire = append(wire, 1, 'a')
+		wire = append(wire, pointerTo(target)...)
+		wire = appendHeader(wire, dns.TypeCNAME, 4)
+		wire = append(wire, 1, 'b')
+		wire = append(wire, pointerTo(owner)...)
+	case "forward":
+		wire = append(wire, pointerTo(owner+2+14)...)
+		wire = appendA(wire)
+		text := "the owner of the answer points here"
+		wire = append(wire, packName(name)...)
+		wire = appendHeader(wire, dns.TypeTXT, 1+len(text))
+		wire = append(wire, byte(len(text)))
+		wire = append(wire, text...)
+	}
+	if _, err := w.Write(wire); err != nil {
+		log.Printf("writing comploop response: %s", err)
+	}
+}
+
+// pointerTo returns a compression pointer to off.
+func pointerTo(off int) []byte {
+	return []byte{0xc0 | byte(off>>8), byte(off)}
+}
+
+// appendHeader appends the type, class, TTL and RDLENGTH of a record.
+func appendHeader(wire []byte, rrtype uint16, rdlen int) []byte {
+	wire = binary.BigEndian.AppendUint16(wire, rrtype)
+	wire = binary.BigEndian.AppendUint16(wire, dns.ClassINET)
+	wire = binary.BigEndian.AppendUint32(wire, 0)
+	return binary.BigEndian.AppendUint16(wire, uint16(rdlen))
+}
+
+// appendA appends the rest of an A record pointing at this server.
+func appendA(wire []byte) []byte {
+	wire = appendHeader(wire, dns.TypeA, 4)
+	return append(wire, advertise4.To4()...)
+}
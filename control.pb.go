@@ -0,0 +1,1324 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.11
+// 	protoc        (unknown)
+// source: control.proto
+
+package main
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	durationpb "google.golang.org/protobuf/types/known/durationpb"
+	timestamppb "google.golang.org/protobuf/types/known/timestamppb"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type WatchQueriesRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// If set, only queries for names at or below this one are sent.
+	Name string `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	// If set, only queries in this session are sent.
+	Session       string `protobuf:"bytes,2,opt,name=session,proto3" json:"session,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *WatchQueriesRequest) Reset() {
+	*x = WatchQueriesRequest{}
+	mi := &file_control_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *WatchQueriesRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*WatchQueriesRequest) ProtoMessage() {}
+
+func (x *WatchQueriesRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_control_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use WatchQueriesRequest.ProtoReflect.Descriptor instead.
+func (*WatchQueriesRequest) Descriptor() ([]byte, []int) {
+	return file_control_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *WatchQueriesRequest) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *WatchQueriesRequest) GetSession() string {
+	if x != nil {
+		return x.Session
+	}
+	return ""
+}
+
+type QueryEvent struct {
+	state     protoimpl.MessageState `protogen:"open.v1"`
+	Time      *timestamppb.Timestamp `protobuf:"bytes,1,opt,name=time,proto3" json:"time,omitempty"`
+	Client    string                 `protobuf:"bytes,2,opt,name=client,proto3" json:"client,omitempty"`
+	Transport string                 `protobuf:"bytes,3,opt,name=transport,proto3" json:"transport,omitempty"`
+	// The name and type asked for, without option labels and session token.
+	Name    string `protobuf:"bytes,4,opt,name=name,proto3" json:"name,omitempty"`
+	Type    string `protobuf:"bytes,5,opt,name=type,proto3" json:"type,omitempty"`
+	Handler string `protobuf:"bytes,6,opt,name=handler,proto3" json:"handler,omitempty"`
+	// The rcode of the first response, or empty if there was none.
+	Rcode   string               `protobuf:"bytes,7,opt,name=rcode,proto3" json:"rcode,omitempty"`
+	Elapsed *durationpb.Duration `protobuf:"bytes,8,opt,name=elapsed,proto3" json:"elapsed,omitempty"`
+	Session string               `protobuf:"bytes,9,opt,name=session,proto3" json:"session,omitempty"`
+	// The query and everything written in response, in wire format.
+	Query         []byte   `protobuf:"bytes,10,opt,name=query,proto3" json:"query,omitempty"`
+	Responses     [][]byte `protobuf:"bytes,11,rep,name=responses,proto3" json:"responses,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *QueryEvent) Reset() {
+	*x = QueryEvent{}
+	mi := &file_control_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *QueryEvent) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*QueryEvent) ProtoMessage() {}
+
+func (x *QueryEvent) ProtoReflect() protoreflect.Message {
+	mi := &file_control_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use QueryEvent.ProtoReflect.Descriptor instead.
+func (*QueryEvent) Descriptor() ([]byte, []int) {
+	return file_control_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *QueryEvent) GetTime() *timestamppb.Timestamp {
+	if x != nil {
+		return x.Time
+	}
+	return nil
+}
+
+func (x *QueryEvent) GetClient() string {
+	if x != nil {
+		return x.Client
+	}
+	return ""
+}
+
+func (x *QueryEvent) GetTransport() string {
+	if x != nil {
+		return x.Transport
+	}
+	return ""
+}
+
+func (x *QueryEvent) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *QueryEvent) GetType() string {
+	if x != nil {
+		return x.Type
+	}
+	return ""
+}
+
+func (x *QueryEvent) GetHandler() string {
+	if x != nil {
+		return x.Handler
+	}
+	return ""
+}
+
+func (x *QueryEvent) GetRcode() string {
+	if x != nil {
+		return x.Rcode
+	}
+	return ""
+}
+
+func (x *QueryEvent) GetElapsed() *durationpb.Duration {
+	if x != nil {
+		return x.Elapsed
+	}
+	return nil
+}
+
+func (x *QueryEvent) GetSession() string {
+	if x != nil {
+		return x.Session
+	}
+	return ""
+}
+
+func (x *QueryEvent) GetQuery() []byte {
+	if x != nil {
+		return x.Query
+	}
+	return nil
+}
+
+func (x *QueryEvent) GetResponses() [][]byte {
+	if x != nil {
+		return x.Responses
+	}
+	return nil
+}
+
+type ListRevokedGhostsRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListRevokedGhostsRequest) Reset() {
+	*x = ListRevokedGhostsRequest{}
+	mi := &file_control_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListRevokedGhostsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListRevokedGhostsRequest) ProtoMessage() {}
+
+func (x *ListRevokedGhostsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_control_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListRevokedGhostsRequest.ProtoReflect.Descriptor instead.
+func (*ListRevokedGhostsRequest) Descriptor() ([]byte, []int) {
+	return file_control_proto_rawDescGZIP(), []int{2}
+}
+
+type ListRevokedGhostsResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Zones         []string               `protobuf:"bytes,1,rep,name=zones,proto3" json:"zones,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListRevokedGhostsResponse) Reset() {
+	*x = ListRevokedGhostsResponse{}
+	mi := &file_control_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListRevokedGhostsResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListRevokedGhostsResponse) ProtoMessage() {}
+
+func (x *ListRevokedGhostsResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_control_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListRevokedGhostsResponse.ProtoReflect.Descriptor instead.
+func (*ListRevokedGhostsResponse) Descriptor() ([]byte, []int) {
+	return file_control_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *ListRevokedGhostsResponse) GetZones() []string {
+	if x != nil {
+		return x.Zones
+	}
+	return nil
+}
+
+type SetGhostRevokedRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// The label of the child zone below ghost.<base>.
+	Zone          string `protobuf:"bytes,1,opt,name=zone,proto3" json:"zone,omitempty"`
+	Revoked       bool   `protobuf:"varint,2,opt,name=revoked,proto3" json:"revoked,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SetGhostRevokedRequest) Reset() {
+	*x = SetGhostRevokedRequest{}
+	mi := &file_control_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SetGhostRevokedRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SetGhostRevokedRequest) ProtoMessage() {}
+
+func (x *SetGhostRevokedRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_control_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SetGhostRevokedRequest.ProtoReflect.Descriptor instead.
+func (*SetGhostRevokedRequest) Descriptor() ([]byte, []int) {
+	return file_control_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *SetGhostRevokedRequest) GetZone() string {
+	if x != nil {
+		return x.Zone
+	}
+	return ""
+}
+
+func (x *SetGhostRevokedRequest) GetRevoked() bool {
+	if x != nil {
+		return x.Revoked
+	}
+	return false
+}
+
+type SetGhostRevokedResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SetGhostRevokedResponse) Reset() {
+	*x = SetGhostRevokedResponse{}
+	mi := &file_control_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SetGhostRevokedResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SetGhostRevokedResponse) ProtoMessage() {}
+
+func (x *SetGhostRevokedResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_control_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SetGhostRevokedResponse.ProtoReflect.Descriptor instead.
+func (*SetGhostRevokedResponse) Descriptor() ([]byte, []int) {
+	return file_control_proto_rawDescGZIP(), []int{5}
+}
+
+type GetStatsRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetStatsRequest) Reset() {
+	*x = GetStatsRequest{}
+	mi := &file_control_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetStatsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetStatsRequest) ProtoMessage() {}
+
+func (x *GetStatsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_control_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetStatsRequest.ProtoReflect.Descriptor instead.
+func (*GetStatsRequest) Descriptor() ([]byte, []int) {
+	return file_control_proto_rawDescGZIP(), []int{6}
+}
+
+type Usage struct {
+	state   protoimpl.MessageState `protogen:"open.v1"`
+	Queries uint64                 `protobuf:"varint,1,opt,name=queries,proto3" json:"queries,omitempty"`
+	Retries uint64                 `protobuf:"varint,2,opt,name=retries,proto3" json:"retries,omitempty"`
+	// Responses by time taken, using Stats.histogram_bounds_ms.
+	Histogram     []uint64 `protobuf:"varint,3,rep,packed,name=histogram,proto3" json:"histogram,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Usage) Reset() {
+	*x = Usage{}
+	mi := &file_control_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Usage) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Usage) ProtoMessage() {}
+
+func (x *Usage) ProtoReflect() protoreflect.Message {
+	mi := &file_control_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Usage.ProtoReflect.Descriptor instead.
+func (*Usage) Descriptor() ([]byte, []int) {
+	return file_control_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *Usage) GetQueries() uint64 {
+	if x != nil {
+		return x.Queries
+	}
+	return 0
+}
+
+func (x *Usage) GetRetries() uint64 {
+	if x != nil {
+		return x.Retries
+	}
+	return 0
+}
+
+func (x *Usage) GetHistogram() []uint64 {
+	if x != nil {
+		return x.Histogram
+	}
+	return nil
+}
+
+type HandlerUsage struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Handlers      map[string]*Usage      `protobuf:"bytes,1,rep,name=handlers,proto3" json:"handlers,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *HandlerUsage) Reset() {
+	*x = HandlerUsage{}
+	mi := &file_control_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *HandlerUsage) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*HandlerUsage) ProtoMessage() {}
+
+func (x *HandlerUsage) ProtoReflect() protoreflect.Message {
+	mi := &file_control_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use HandlerUsage.ProtoReflect.Descriptor instead.
+func (*HandlerUsage) Descriptor() ([]byte, []int) {
+	return file_control_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *HandlerUsage) GetHandlers() map[string]*Usage {
+	if x != nil {
+		return x.Handlers
+	}
+	return nil
+}
+
+type Stats struct {
+	state             protoimpl.MessageState   `protogen:"open.v1"`
+	HistogramBoundsMs []float64                `protobuf:"fixed64,1,rep,packed,name=histogram_bounds_ms,json=histogramBoundsMs,proto3" json:"histogram_bounds_ms,omitempty"`
+	Handlers          map[string]*Usage        `protobuf:"bytes,2,rep,name=handlers,proto3" json:"handlers,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	Asns              map[string]*HandlerUsage `protobuf:"bytes,3,rep,name=asns,proto3" json:"asns,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	// Handlers that panicked, as under /quarantine.
+	Quarantine    map[string]*Quarantine `protobuf:"bytes,4,rep,name=quarantine,proto3" json:"quarantine,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Stats) Reset() {
+	*x = Stats{}
+	mi := &file_control_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Stats) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Stats) ProtoMessage() {}
+
+func (x *Stats) ProtoReflect() protoreflect.Message {
+	mi := &file_control_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Stats.ProtoReflect.Descriptor instead.
+func (*Stats) Descriptor() ([]byte, []int) {
+	return file_control_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *Stats) GetHistogramBoundsMs() []float64 {
+	if x != nil {
+		return x.HistogramBoundsMs
+	}
+	return nil
+}
+
+func (x *Stats) GetHandlers() map[string]*Usage {
+	if x != nil {
+		return x.Handlers
+	}
+	return nil
+}
+
+func (x *Stats) GetAsns() map[string]*HandlerUsage {
+	if x != nil {
+		return x.Asns
+	}
+	return nil
+}
+
+func (x *Stats) GetQuarantine() map[string]*Quarantine {
+	if x != nil {
+		return x.Quarantine
+	}
+	return nil
+}
+
+type Quarantine struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Panics        uint64                 `protobuf:"varint,1,opt,name=panics,proto3" json:"panics,omitempty"`
+	LastPanic     string                 `protobuf:"bytes,2,opt,name=last_panic,json=lastPanic,proto3" json:"last_panic,omitempty"`
+	LastAt        *timestamppb.Timestamp `protobuf:"bytes,3,opt,name=last_at,json=lastAt,proto3" json:"last_at,omitempty"`
+	Disabled      bool                   `protobuf:"varint,4,opt,name=disabled,proto3" json:"disabled,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Quarantine) Reset() {
+	*x = Quarantine{}
+	mi := &file_control_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Quarantine) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Quarantine) ProtoMessage() {}
+
+func (x *Quarantine) ProtoReflect() protoreflect.Message {
+	mi := &file_control_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Quarantine.ProtoReflect.Descriptor instead.
+func (*Quarantine) Descriptor() ([]byte, []int) {
+	return file_control_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *Quarantine) GetPanics() uint64 {
+	if x != nil {
+		return x.Panics
+	}
+	return 0
+}
+
+func (x *Quarantine) GetLastPanic() string {
+	if x != nil {
+		return x.LastPanic
+	}
+	return ""
+}
+
+func (x *Quarantine) GetLastAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.LastAt
+	}
+	return nil
+}
+
+func (x *Quarantine) GetDisabled() bool {
+	if x != nil {
+		return x.Disabled
+	}
+	return false
+}
+
+type Override struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// A prefix in CIDR notation, or cookie:<hex client cookie>.
+	Match string `protobuf:"bytes,1,opt,name=match,proto3" json:"match,omitempty"`
+	// The name relative to the base that matching queries are served as.
+	Behavior      string                 `protobuf:"bytes,2,opt,name=behavior,proto3" json:"behavior,omitempty"`
+	Expires       *timestamppb.Timestamp `protobuf:"bytes,3,opt,name=expires,proto3" json:"expires,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Override) Reset() {
+	*x = Override{}
+	mi := &file_control_proto_msgTypes[11]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Override) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Override) ProtoMessage() {}
+
+func (x *Override) ProtoReflect() protoreflect.Message {
+	mi := &file_control_proto_msgTypes[11]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Override.ProtoReflect.Descriptor instead.
+func (*Override) Descriptor() ([]byte, []int) {
+	return file_control_proto_rawDescGZIP(), []int{11}
+}
+
+func (x *Override) GetMatch() string {
+	if x != nil {
+		return x.Match
+	}
+	return ""
+}
+
+func (x *Override) GetBehavior() string {
+	if x != nil {
+		return x.Behavior
+	}
+	return ""
+}
+
+func (x *Override) GetExpires() *timestamppb.Timestamp {
+	if x != nil {
+		return x.Expires
+	}
+	return nil
+}
+
+type ListOverridesRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListOverridesRequest) Reset() {
+	*x = ListOverridesRequest{}
+	mi := &file_control_proto_msgTypes[12]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListOverridesRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListOverridesRequest) ProtoMessage() {}
+
+func (x *ListOverridesRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_control_proto_msgTypes[12]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListOverridesRequest.ProtoReflect.Descriptor instead.
+func (*ListOverridesRequest) Descriptor() ([]byte, []int) {
+	return file_control_proto_rawDescGZIP(), []int{12}
+}
+
+type ListOverridesResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Overrides     []*Override            `protobuf:"bytes,1,rep,name=overrides,proto3" json:"overrides,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListOverridesResponse) Reset() {
+	*x = ListOverridesResponse{}
+	mi := &file_control_proto_msgTypes[13]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListOverridesResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListOverridesResponse) ProtoMessage() {}
+
+func (x *ListOverridesResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_control_proto_msgTypes[13]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListOverridesResponse.ProtoReflect.Descriptor instead.
+func (*ListOverridesResponse) Descriptor() ([]byte, []int) {
+	return file_control_proto_rawDescGZIP(), []int{13}
+}
+
+func (x *ListOverridesResponse) GetOverrides() []*Override {
+	if x != nil {
+		return x.Overrides
+	}
+	return nil
+}
+
+type SetOverrideRequest struct {
+	state    protoimpl.MessageState `protogen:"open.v1"`
+	Match    string                 `protobuf:"bytes,1,opt,name=match,proto3" json:"match,omitempty"`
+	Behavior string                 `protobuf:"bytes,2,opt,name=behavior,proto3" json:"behavior,omitempty"`
+	// Defaults to an hour.
+	Ttl           *durationpb.Duration `protobuf:"bytes,3,opt,name=ttl,proto3" json:"ttl,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SetOverrideRequest) Reset() {
+	*x = SetOverrideRequest{}
+	mi := &file_control_proto_msgTypes[14]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SetOverrideRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SetOverrideRequest) ProtoMessage() {}
+
+func (x *SetOverrideRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_control_proto_msgTypes[14]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SetOverrideRequest.ProtoReflect.Descriptor instead.
+func (*SetOverrideRequest) Descriptor() ([]byte, []int) {
+	return file_control_proto_rawDescGZIP(), []int{14}
+}
+
+func (x *SetOverrideRequest) GetMatch() string {
+	if x != nil {
+		return x.Match
+	}
+	return ""
+}
+
+func (x *SetOverrideRequest) GetBehavior() string {
+	if x != nil {
+		return x.Behavior
+	}
+	return ""
+}
+
+func (x *SetOverrideRequest) GetTtl() *durationpb.Duration {
+	if x != nil {
+		return x.Ttl
+	}
+	return nil
+}
+
+type ClearOverrideRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Match         string                 `protobuf:"bytes,1,opt,name=match,proto3" json:"match,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ClearOverrideRequest) Reset() {
+	*x = ClearOverrideRequest{}
+	mi := &file_control_proto_msgTypes[15]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ClearOverrideRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ClearOverrideRequest) ProtoMessage() {}
+
+func (x *ClearOverrideRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_control_proto_msgTypes[15]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ClearOverrideRequest.ProtoReflect.Descriptor instead.
+func (*ClearOverrideRequest) Descriptor() ([]byte, []int) {
+	return file_control_proto_rawDescGZIP(), []int{15}
+}
+
+func (x *ClearOverrideRequest) GetMatch() string {
+	if x != nil {
+		return x.Match
+	}
+	return ""
+}
+
+type ClearOverrideResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ClearOverrideResponse) Reset() {
+	*x = ClearOverrideResponse{}
+	mi := &file_control_proto_msgTypes[16]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ClearOverrideResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ClearOverrideResponse) ProtoMessage() {}
+
+func (x *ClearOverrideResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_control_proto_msgTypes[16]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ClearOverrideResponse.ProtoReflect.Descriptor instead.
+func (*ClearOverrideResponse) Descriptor() ([]byte, []int) {
+	return file_control_proto_rawDescGZIP(), []int{16}
+}
+
+type CreateSessionRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Defaults to a day.
+	Ttl           *durationpb.Duration `protobuf:"bytes,1,opt,name=ttl,proto3" json:"ttl,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CreateSessionRequest) Reset() {
+	*x = CreateSessionRequest{}
+	mi := &file_control_proto_msgTypes[17]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CreateSessionRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CreateSessionRequest) ProtoMessage() {}
+
+func (x *CreateSessionRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_control_proto_msgTypes[17]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CreateSessionRequest.ProtoReflect.Descriptor instead.
+func (*CreateSessionRequest) Descriptor() ([]byte, []int) {
+	return file_control_proto_rawDescGZIP(), []int{17}
+}
+
+func (x *CreateSessionRequest) GetTtl() *durationpb.Duration {
+	if x != nil {
+		return x.Ttl
+	}
+	return nil
+}
+
+type GetSessionRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Token         string                 `protobuf:"bytes,1,opt,name=token,proto3" json:"token,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetSessionRequest) Reset() {
+	*x = GetSessionRequest{}
+	mi := &file_control_proto_msgTypes[18]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetSessionRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetSessionRequest) ProtoMessage() {}
+
+func (x *GetSessionRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_control_proto_msgTypes[18]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetSessionRequest.ProtoReflect.Descriptor instead.
+func (*GetSessionRequest) Descriptor() ([]byte, []int) {
+	return file_control_proto_rawDescGZIP(), []int{18}
+}
+
+func (x *GetSessionRequest) GetToken() string {
+	if x != nil {
+		return x.Token
+	}
+	return ""
+}
+
+type Session struct {
+	state    protoimpl.MessageState `protogen:"open.v1"`
+	Token    string                 `protobuf:"bytes,1,opt,name=token,proto3" json:"token,omitempty"`
+	Created  *timestamppb.Timestamp `protobuf:"bytes,2,opt,name=created,proto3" json:"created,omitempty"`
+	Expires  *timestamppb.Timestamp `protobuf:"bytes,3,opt,name=expires,proto3" json:"expires,omitempty"`
+	Handlers map[string]*Usage      `protobuf:"bytes,4,rep,name=handlers,proto3" json:"handlers,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	Queries  []*QueryEvent          `protobuf:"bytes,5,rep,name=queries,proto3" json:"queries,omitempty"`
+	// Queries beyond the number a session keeps, which only count towards
+	// handlers.
+	QueriesNotLogged uint64 `protobuf:"varint,6,opt,name=queries_not_logged,json=queriesNotLogged,proto3" json:"queries_not_logged,omitempty"`
+	unknownFields    protoimpl.UnknownFields
+	sizeCache        protoimpl.SizeCache
+}
+
+func (x *Session) Reset() {
+	*x = Session{}
+	mi := &file_control_proto_msgTypes[19]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Session) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Session) ProtoMessage() {}
+
+func (x *Session) ProtoReflect() protoreflect.Message {
+	mi := &file_control_proto_msgTypes[19]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Session.ProtoReflect.Descriptor instead.
+func (*Session) Descriptor() ([]byte, []int) {
+	return file_control_proto_rawDescGZIP(), []int{19}
+}
+
+func (x *Session) GetToken() string {
+	if x != nil {
+		return x.Token
+	}
+	return ""
+}
+
+func (x *Session) GetCreated() *timestamppb.Timestamp {
+	if x != nil {
+		return x.Created
+	}
+	return nil
+}
+
+func (x *Session) GetExpires() *timestamppb.Timestamp {
+	if x != nil {
+		return x.Expires
+	}
+	return nil
+}
+
+func (x *Session) GetHandlers() map[string]*Usage {
+	if x != nil {
+		return x.Handlers
+	}
+	return nil
+}
+
+func (x *Session) GetQueries() []*QueryEvent {
+	if x != nil {
+		return x.Queries
+	}
+	return nil
+}
+
+func (x *Session) GetQueriesNotLogged() uint64 {
+	if x != nil {
+		return x.QueriesNotLogged
+	}
+	return 0
+}
+
+var File_control_proto protoreflect.FileDescriptor
+
+const file_control_proto_rawDesc = "" +
+	"\n" +
+	"\rcontrol.proto\x12\x10awful.control.v1\x1a\x1egoogle/protobuf/duration.proto\x1a\x1fgoogle/protobuf/timestamp.proto\"C\n" +
+	"\x13WatchQueriesRequest\x12\x12\n" +
+	"\x04name\x18\x01 \x01(\tR\x04name\x12\x18\n" +
+	"\asession\x18\x02 \x01(\tR\asession\"\xcd\x02\n" +
+	"\n" +
+	"QueryEvent\x12.\n" +
+	"\x04time\x18\x01 \x01(\v2\x1a.google.protobuf.TimestampR\x04time\x12\x16\n" +
+	"\x06client\x18\x02 \x01(\tR\x06client\x12\x1c\n" +
+	"\ttransport\x18\x03 \x01(\tR\ttransport\x12\x12\n" +
+	"\x04name\x18\x04 \x01(\tR\x04name\x12\x12\n" +
+	"\x04type\x18\x05 \x01(\tR\x04type\x12\x18\n" +
+	"\ahandler\x18\x06 \x01(\tR\ahandler\x12\x14\n" +
+	"\x05rcode\x18\a \x01(\tR\x05rcode\x123\n" +
+	"\aelapsed\x18\b \x01(\v2\x19.google.protobuf.DurationR\aelapsed\x12\x18\n" +
+	"\asession\x18\t \x01(\tR\asession\x12\x14\n" +
+	"\x05query\x18\n" +
+	" \x01(\fR\x05query\x12\x1c\n" +
+	"\tresponses\x18\v \x03(\fR\tresponses\"\x1a\n" +
+	"\x18ListRevokedGhostsRequest\"1\n" +
+	"\x19ListRevokedGhostsResponse\x12\x14\n" +
+	"\x05zones\x18\x01 \x03(\tR\x05zones\"F\n" +
+	"\x16SetGhostRevokedRequest\x12\x12\n" +
+	"\x04zone\x18\x01 \x01(\tR\x04zone\x12\x18\n" +
+	"\arevoked\x18\x02 \x01(\bR\arevoked\"\x19\n" +
+	"\x17SetGhostRevokedResponse\"\x11\n" +
+	"\x0fGetStatsRequest\"Y\n" +
+	"\x05Usage\x12\x18\n" +
+	"\aqueries\x18\x01 \x01(\x04R\aqueries\x12\x18\n" +
+	"\aretries\x18\x02 \x01(\x04R\aretries\x12\x1c\n" +
+	"\thistogram\x18\x03 \x03(\x04R\thistogram\"\xae\x01\n" +
+	"\fHandlerUsage\x12H\n" +
+	"\bhandlers\x18\x01 \x03(\v2,.awful.control.v1.HandlerUsage.HandlersEntryR\bhandlers\x1aT\n" +
+	"\rHandlersEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12-\n" +
+	"\x05value\x18\x02 \x01(\v2\x17.awful.control.v1.UsageR\x05value:\x028\x01\"\x86\x04\n" +
+	"\x05Stats\x12.\n" +
+	"\x13histogram_bounds_ms\x18\x01 \x03(\x01R\x11histogramBoundsMs\x12A\n" +
+	"\bhandlers\x18\x02 \x03(\v2%.awful.control.v1.Stats.HandlersEntryR\bhandlers\x125\n" +
+	"\x04asns\x18\x03 \x03(\v2!.awful.control.v1.Stats.AsnsEntryR\x04asns\x12G\n" +
+	"\n" +
+	"quarantine\x18\x04 \x03(\v2'.awful.control.v1.Stats.QuarantineEntryR\n" +
+	"quarantine\x1aT\n" +
+	"\rHandlersEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12-\n" +
+	"\x05value\x18\x02 \x01(\v2\x17.awful.control.v1.UsageR\x05value:\x028\x01\x1aW\n" +
+	"\tAsnsEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x124\n" +
+	"\x05value\x18\x02 \x01(\v2\x1e.awful.control.v1.HandlerUsageR\x05value:\x028\x01\x1a[\n" +
+	"\x0fQuarantineEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x122\n" +
+	"\x05value\x18\x02 \x01(\v2\x1c.awful.control.v1.QuarantineR\x05value:\x028\x01\"\x94\x01\n" +
+	"\n" +
+	"Quarantine\x12\x16\n" +
+	"\x06panics\x18\x01 \x01(\x04R\x06panics\x12\x1d\n" +
+	"\n" +
+	"last_panic\x18\x02 \x01(\tR\tlastPanic\x123\n" +
+	"\alast_at\x18\x03 \x01(\v2\x1a.google.protobuf.TimestampR\x06lastAt\x12\x1a\n" +
+	"\bdisabled\x18\x04 \x01(\bR\bdisabled\"r\n" +
+	"\bOverride\x12\x14\n" +
+	"\x05match\x18\x01 \x01(\tR\x05match\x12\x1a\n" +
+	"\bbehavior\x18\x02 \x01(\tR\bbehavior\x124\n" +
+	"\aexpires\x18\x03 \x01(\v2\x1a.google.protobuf.TimestampR\aexpires\"\x16\n" +
+	"\x14ListOverridesRequest\"Q\n" +
+	"\x15ListOverridesResponse\x128\n" +
+	"\toverrides\x18\x01 \x03(\v2\x1a.awful.control.v1.OverrideR\toverrides\"s\n" +
+	"\x12SetOverrideRequest\x12\x14\n" +
+	"\x05match\x18\x01 \x01(\tR\x05match\x12\x1a\n" +
+	"\bbehavior\x18\x02 \x01(\tR\bbehavior\x12+\n" +
+	"\x03ttl\x18\x03 \x01(\v2\x19.google.protobuf.DurationR\x03ttl\",\n" +
+	"\x14ClearOverrideRequest\x12\x14\n" +
+	"\x05match\x18\x01 \x01(\tR\x05match\"\x17\n" +
+	"\x15ClearOverrideResponse\"C\n" +
+	"\x14CreateSessionRequest\x12+\n" +
+	"\x03ttl\x18\x01 \x01(\v2\x19.google.protobuf.DurationR\x03ttl\")\n" +
+	"\x11GetSessionRequest\x12\x14\n" +
+	"\x05token\x18\x01 \x01(\tR\x05token\"\x8c\x03\n" +
+	"\aSession\x12\x14\n" +
+	"\x05token\x18\x01 \x01(\tR\x05token\x124\n" +
+	"\acreated\x18\x02 \x01(\v2\x1a.google.protobuf.TimestampR\acreated\x124\n" +
+	"\aexpires\x18\x03 \x01(\v2\x1a.google.protobuf.TimestampR\aexpires\x12C\n" +
+	"\bhandlers\x18\x04 \x03(\v2'.awful.control.v1.Session.HandlersEntryR\bhandlers\x126\n" +
+	"\aqueries\x18\x05 \x03(\v2\x1c.awful.control.v1.QueryEventR\aqueries\x12,\n" +
+	"\x12queries_not_logged\x18\x06 \x01(\x04R\x10queriesNotLogged\x1aT\n" +
+	"\rHandlersEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12-\n" +
+	"\x05value\x18\x02 \x01(\v2\x17.awful.control.v1.UsageR\x05value:\x028\x012\xb5\x06\n" +
+	"\aControl\x12U\n" +
+	"\fWatchQueries\x12%.awful.control.v1.WatchQueriesRequest\x1a\x1c.awful.control.v1.QueryEvent0\x01\x12l\n" +
+	"\x11ListRevokedGhosts\x12*.awful.control.v1.ListRevokedGhostsRequest\x1a+.awful.control.v1.ListRevokedGhostsResponse\x12f\n" +
+	"\x0fSetGhostRevoked\x12(.awful.control.v1.SetGhostRevokedRequest\x1a).awful.control.v1.SetGhostRevokedResponse\x12F\n" +
+	"\bGetStats\x12!.awful.control.v1.GetStatsRequest\x1a\x17.awful.control.v1.Stats\x12`\n" +
+	"\rListOverrides\x12&.awful.control.v1.ListOverridesRequest\x1a'.awful.control.v1.ListOverridesResponse\x12O\n" +
+	"\vSetOverride\x12$.awful.control.v1.SetOverrideRequest\x1a\x1a.awful.control.v1.Override\x12`\n" +
+	"\rClearOverride\x12&.awful.control.v1.ClearOverrideRequest\x1a'.awful.control.v1.ClearOverrideResponse\x12R\n" +
+	"\rCreateSession\x12&.awful.control.v1.CreateSessionRequest\x1a\x19.awful.control.v1.Session\x12L\n" +
+	"\n" +
+	"GetSession\x12#.awful.control.v1.GetSessionRequest\x1a\x19.awful.control.v1.SessionB!Z\x1fgithub.com/jsha/awful.zone;mainb\x06proto3"
+
+var (
+	file_control_proto_rawDescOnce sync.Once
+	file_control_proto_rawDescData []byte
+)
+
+func file_control_proto_rawDescGZIP() []byte {
+	file_control_proto_rawDescOnce.Do(func() {
+		file_control_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_control_proto_rawDesc), len(file_control_proto_rawDesc)))
+	})
+	return file_control_proto_rawDescData
+}
+
+var file_control_proto_msgTypes = make([]protoimpl.MessageInfo, 25)
+var file_control_proto_goTypes = []any{
+	(*WatchQueriesRequest)(nil),       // 0: awful.control.v1.WatchQueriesRequest
+	(*QueryEvent)(nil),                // 1: awful.control.v1.QueryEvent
+	(*ListRevokedGhostsRequest)(nil),  // 2: awful.control.v1.ListRevokedGhostsRequest
+	(*ListRevokedGhostsResponse)(nil), // 3: awful.control.v1.ListRevokedGhostsResponse
+	(*SetGhostRevokedRequest)(nil),    // 4: awful.control.v1.SetGhostRevokedRequest
+	(*SetGhostRevokedResponse)(nil),   // 5: awful.control.v1.SetGhostRevokedResponse
+	(*GetStatsRequest)(nil),           // 6: awful.control.v1.GetStatsRequest
+	(*Usage)(nil),                     // 7: awful.control.v1.Usage
+	(*HandlerUsage)(nil),              // 8: awful.control.v1.HandlerUsage
+	(*Stats)(nil),                     // 9: awful.control.v1.Stats
+	(*Quarantine)(nil),                // 10: awful.control.v1.Quarantine
+	(*Override)(nil),                  // 11: awful.control.v1.Override
+	(*ListOverridesRequest)(nil),      // 12: awful.control.v1.ListOverridesRequest
+	(*ListOverridesResponse)(nil),     // 13: awful.control.v1.ListOverridesResponse
+	(*SetOverrideRequest)(nil),        // 14: awful.control.v1.SetOverrideRequest
+	(*ClearOverrideRequest)(nil),      // 15: awful.control.v1.ClearOverrideRequest
+	(*ClearOverrideResponse)(nil),     // 16: awful.control.v1.ClearOverrideResponse
+	(*CreateSessionRequest)(nil),      // 17: awful.control.v1.CreateSessionRequest
+	(*GetSessionRequest)(nil),         // 18: awful.control.v1.GetSessionRequest
+	(*Session)(nil),                   // 19: awful.control.v1.Session
+	nil,                               // 20: awful.control.v1.HandlerUsage.HandlersEntry
+	nil,                               // 21: awful.control.v1.Stats.HandlersEntry
+	nil,                               // 22: awful.control.v1.Stats.AsnsEntry
+	nil,                               // 23: awful.control.v1.Stats.QuarantineEntry
+	nil,                               // 24: awful.control.v1.Session.HandlersEntry
+	(*timestamppb.Timestamp)(nil),     // 25: google.protobuf.Timestamp
+	(*durationpb.Duration)(nil),       // 26: google.protobuf.Duration
+}
+var file_control_proto_depIdxs = []int32{
+	25, // 0: awful.control.v1.QueryEvent.time:type_name -> google.protobuf.Timestamp
+	26, // 1: awful.control.v1.QueryEvent.elapsed:type_name -> google.protobuf.Duration
+	20, // 2: awful.control.v1.HandlerUsage.handlers:type_name -> awful.control.v1.HandlerUsage.HandlersEntry
+	21, // 3: awful.control.v1.Stats.handlers:type_name -> awful.control.v1.Stats.HandlersEntry
+	22, // 4: awful.control.v1.Stats.asns:type_name -> awful.control.v1.Stats.AsnsEntry
+	23, // 5: awful.control.v1.Stats.quarantine:type_name -> awful.control.v1.Stats.QuarantineEntry
+	25, // 6: awful.control.v1.Quarantine.last_at:type_name -> google.protobuf.Timestamp
+	25, // 7: awful.control.v1.Override.expires:type_name -> google.protobuf.Timestamp
+	11, // 8: awful.control.v1.ListOverridesResponse.overrides:type_name -> awful.control.v1.Override
+	26, // 9: awful.control.v1.SetOverrideRequest.ttl:type_name -> google.protobuf.Duration
+	26, // 10: awful.control.v1.CreateSessionRequest.ttl:type_name -> google.protobuf.Duration
+	25, // 11: awful.control.v1.Session.created:type_name -> google.protobuf.Timestamp
+	25, // 12: awful.control.v1.Session.expires:type_name -> google.protobuf.Timestamp
+	24, // 13: awful.control.v1.Session.handlers:type_name -> awful.control.v1.Session.HandlersEntry
+	1,  // 14: awful.control.v1.Session.queries:type_name -> awful.control.v1.QueryEvent
+	7,  // 15: awful.control.v1.HandlerUsage.HandlersEntry.value:type_name -> awful.control.v1.Usage
+	7,  // 16: awful.control.v1.Stats.HandlersEntry.value:type_name -> awful.control.v1.Usage
+	8,  // 17: awful.control.v1.Stats.AsnsEntry.value:type_name -> awful.control.v1.HandlerUsage
+	10, // 18: awful.control.v1.Stats.QuarantineEntry.value:type_name -> awful.control.v1.Quarantine
+	7,  // 19: awful.control.v1.Session.HandlersEntry.value:type_name -> awful.control.v1.Usage
+	0,  // 20: awful.control.v1.Control.WatchQueries:input_type -> awful.control.v1.WatchQueriesRequest
+	2,  // 21: awful.control.v1.Control.ListRevokedGhosts:input_type -> awful.control.v1.ListRevokedGhostsRequest
+	4,  // 22: awful.control.v1.Control.SetGhostRevoked:input_type -> awful.control.v1.SetGhostRevokedRequest
+	6,  // 23: awful.control.v1.Control.GetStats:input_type -> awful.control.v1.GetStatsRequest
+	12, // 24: awful.control.v1.Control.ListOverrides:input_type -> awful.control.v1.ListOverridesRequest
+	14, // 25: awful.control.v1.Control.SetOverride:input_type -> awful.control.v1.SetOverrideRequest
+	15, // 26: awful.control.v1.Control.ClearOverride:input_type -> awful.control.v1.ClearOverrideRequest
+	17, // 27: awful.control.v1.Control.CreateSession:input_type -> awful.control.v1.CreateSessionRequest
+	18, // 28: awful.control.v1.Control.GetSession:input_type -> awful.control.v1.GetSessionRequest
+	1,  // 29: awful.control.v1.Control.WatchQueries:output_type -> awful.control.v1.QueryEvent
+	3,  // 30: awful.control.v1.Control.ListRevokedGhosts:output_type -> awful.control.v1.ListRevokedGhostsResponse
+	5,  // 31: awful.control.v1.Control.SetGhostRevoked:output_type -> awful.control.v1.SetGhostRevokedResponse
+	9,  // 32: awful.control.v1.Control.GetStats:output_type -> awful.control.v1.Stats
+	13, // 33: awful.control.v1.Control.ListOverrides:output_type -> awful.control.v1.ListOverridesResponse
+	11, // 34: awful.control.v1.Control.SetOverride:output_type -> awful.control.v1.Override
+	16, // 35: awful.control.v1.Control.ClearOverride:output_type -> awful.control.v1.ClearOverrideResponse
+	19, // 36: awful.control.v1.Control.CreateSession:output_type -> awful.control.v1.Session
+	19, // 37: awful.control.v1.Control.GetSession:output_type -> awful.control.v1.Session
+	29, // [29:38] is the sub-list for method output_type
+	20, // [20:29] is the sub-list for method input_type
+	20, // [20:20] is the sub-list for extension type_name
+	20, // [20:20] is the sub-list for extension extendee
+	0,  // [0:20] is the sub-list for field type_name
+}
+
+func init() { file_control_proto_init() }
+func file_control_proto_init() {
+	if File_control_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_control_proto_rawDesc), len(file_control_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   25,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_control_proto_goTypes,
+		DependencyIndexes: file_control_proto_depIdxs,
+		MessageInfos:      file_control_proto_msgTypes,
+	}.Build()
+	File_control_proto = out.File
+	file_control_proto_goTypes = nil
+	file_control_proto_depIdxs = nil
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// denial.<base> is a signed zone, like signed.<base>, whose negative answers
+// are lies that a validator can catch out. Every name under
+// <kind>.denial.<base> is denied, in the way the kind says:
+//
+//	nsecmiss   NXDOMAIN, with an NSEC record that doesn't cover the name
+//	nsec3iter  NXDOMAIN, proven with NSEC3 records of 2500 iterations
+//	optout     NXDOMAIN, proven with an NSEC3 record that has Opt-Out set
+//	bitmap     NODATA, with an NSEC record whose bitmap has the type asked for
+//
+// The signatures are all valid. It's the proofs that don't hold.
+
+// denialIterations is the NSEC3 iteration count nsec3iter uses. RFC 9276
+// allows validators to treat anything over 100 as insecure, or as bogus past
+// a limit of their own.
+const denialIterations = 2500
+
+// serveDenial answers q, for a name under <kind>.denial.<base>, with the lie
+// the kind calls for. It reports false for unknown kinds.
+func serveDenial(w dns.ResponseWriter, q *dns.Msg, kind string) bool {
+	apex := zone("denial")
+	name := qname(q)
+	m := new(dns.Msg)
+	m.SetRcode(q, dns.RcodeNameError)
+	m.Authoritative = true
+	m.Ns = []dns.RR{soaRecord(apex)}
+	var proof []dns.RR
+	switch kind {
+	case "nsecmiss":
+		proof = []dns.RR{&dns.NSEC{
+			Hdr:        dns.RR_Header{Name: apex, Rrtype: dns.TypeNSEC, Class: dns.ClassINET},
+			NextDomain: `\000.` + apex,
+			TypeBitMap: apexTypes(dns.TypeNSEC),
+		}}
+	case "nsec3iter":
+		proof = []dns.RR{nsec3Ring(apex, denialIterations, false)}
+	case "optout":
+		proof = []dns.RR{nsec3Ring(apex, 0, true)}
+	case "bitmap":
+		m.Rcode = dns.RcodeSuccess
+		types := []uint16{q.Question[0].Qtype, dns.TypeRRSIG, dns.TypeNSEC}
+		sort.Slice(types, func(i, j int) bool { return types[i] < types[j] })
+		proof = []dns.RR{&dns.NSEC{
+			Hdr:        dns.RR_Header{Name: name, Rrtype: dns.TypeNSEC, Class: dns.ClassINET},
+			NextDomain: `\000.` + name,
+			TypeBitMap: types,
+		}}
+	default:
+		return false
+	}
+	if opt := q.IsEdns0(); opt != nil && opt.Do() {
+		m.Ns = signSection(append(m.Ns, proof...), apex, "denial")
+		m.SetEdns0(1232, true)
+	}
+	w.WriteMsg(m)
+	return true
+}
+
+// apexTypes returns the types at the apex of a signed zone, as nodataNSEC
+// lists them, with the NSEC type replaced by extra.
+func apexTypes(extra ...uint16) []uint16 {
+	var types []uint16
+	for _, t := range nodataNSEC(".", true).(*dns.NSEC).TypeBitMap {
+		if t != dns.TypeNSEC {
+			types = append(types, t)
+		}
+	}
+	types = append(types, extra...)
+	sort.Slice(types, func(i, j int) bool { return types[i] < types[j] })
+	return types
+}
+
+// nsec3Ring returns the only NSEC3 record of a zone made of nothing but its
+// apex. It matches the apex and, since the next hashed owner name is its
+// own, covers every other hash, which proves that any name below the apex
+// doesn't exist, and that there is no wildcard.
+func nsec3Ring(apex string, iterations uint16, optOut bool) dns.RR {
+	hash := strings.ToLower(dns.HashName(apex, dns.SHA1, iterations, ""))
+	var flags uint8
+	if optOut {
+		flags = 1
+	}
+	return &dns.NSEC3{
+		Hdr:        dns.RR_Header{Name: hash + "." + apex, Rrtype: dns.TypeNSEC3, Class: dns.ClassINET},
+		Hash:       dns.SHA1,
+		Flags:      flags,
+		Iterations: iterations,
+		HashLength: 20,
+		NextDomain: strings.ToUpper(hash),
+		TypeBitMap: apexTypes(),
+	}
+}
@@ -0,0 +1,349 @@
+package main
+
+import (
+	"crypto"
+	"encoding/base64"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+var dnssecKey = flag.String("dnssec-key", "", "path of a key pair in BIND's format to sign zones with, without the .key and .private suffixes, e.g. Kexample.com.+013+12345. Its owner name doesn't matter. A key is generated at startup if empty.")
+var infWildSignRate = flag.Int64("infwild-sign-rate", 1000, "most answers per second, across all clients, that infwild.signed.<base> signs; DO queries beyond that get SERVFAIL.")
+
+// The signed zones below -base are signed on the fly, all with the same key,
+// each being broken in its own way:
+//
+//	signed        not at all
+//	expiredrrsig  every signature expired a day ago
+//	badsig        every signature has been tampered with
+//	nods          the DS served for the zone is for another key
+//	missingrrsig  there are no signatures, though the DNSKEY is served
+//	denial        its negative answers are lies, as described in denial.go
+//
+// -base itself isn't signed, so no DS leads to them: a validator only treats
+// them as secure when given the DS records logged at startup as trust
+// anchors. The DS record for each zone is also served by the zone itself, as
+// the parent, which is played by this process too, would. Names under
+// bogus.signed.<base> get signatures that don't verify. Signatures, and the
+// NSEC records proving NODATA, are only sent to queries with the DO bit set.
+var signedZones = []string{"signed", "expiredrrsig", "badsig", "nods", "missingrrsig", "denial"}
+
+// signedKeyTTL is the TTL of the DNSKEY and DS RRsets of the signed zones.
+const signedKeyTTL = 3600
+
+var (
+	// zoneKey is the key the signed zones are signed with, owned by the
+	// root; copies of it are given the owner name of each zone.
+	zoneKey    *dns.DNSKEY
+	zoneSigner crypto.Signer
+	// decoyKey is the key the DS served for nods.<base> is for. Nothing is
+	// signed with it.
+	decoyKey *dns.DNSKEY
+)
+
+// generateZoneKey loads the -dnssec-key or generates one, and logs the DS
+// records to use as trust anchors for the signed zones.
+func generateZoneKey() error {
+	var err error
+	if *dnssecKey != "" {
+		zoneKey, zoneSigner, err = loadKey(*dnssecKey)
+	} else {
+		zoneKey, zoneSigner, err = newKey()
+	}
+	if err != nil {
+		return err
+	}
+	if decoyKey, _, err = newKey(); err != nil {
+		return err
+	}
+	for _, name := range signedZones {
+		log.Printf("signed zone trust anchor: %s", signedZoneDS(zone(name)))
+	}
+	log.Printf("signed zone trust anchor: %s", signedZoneDS(zone("broken-but-monitored")))
+	return nil
+}
+
+// newKey generates an ECDSAP256SHA256 key signing key.
+func newKey() (*dns.DNSKEY, crypto.Signer, error) {
+	key := &dns.DNSKEY{
+		Hdr:       dns.RR_Header{Name: ".", Rrtype: dns.TypeDNSKEY, Class: dns.ClassINET, Ttl: signedKeyTTL},
+		Flags:     257,
+		Protocol:  3,
+		Algorithm: dns.ECDSAP256SHA256,
+	}
+	priv, err := key.Generate(256)
+	if err != nil {
+		return nil, nil, fmt.Errorf("generating key: %s", err)
+	}
+	return key, priv.(crypto.Signer), nil
+}
+
+// loadKey reads the key pair in path+".key" and path+".private".
+func loadKey(path string) (*dns.DNSKEY, crypto.Signer, error) {
+	f, err := os.Open(path + ".key")
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+	rr, err := dns.ReadRR(f, path+".key")
+	if err != nil {
+		return nil, nil, fmt.Errorf("-dnssec-key: %s", err)
+	}
+	key, ok := rr.(*dns.DNSKEY)
+	if !ok {
+		return nil, nil, fmt.Errorf("-dnssec-key: %s.key doesn't hold a DNSKEY", path)
+	}
+	p, err := os.Open(path + ".private")
+	if err != nil {
+		return nil, nil, err
+	}
+	defer p.Close()
+	priv, err := key.ReadPrivateKey(p, path+".private")
+	if err != nil {
+		return nil, nil, fmt.Errorf("-dnssec-key: %s", err)
+	}
+	signer, ok := priv.(crypto.Signer)
+	if !ok {
+		return nil, nil, fmt.Errorf("-dnssec-key: unsupported algorithm %s", dns.AlgorithmToString[key.Algorithm])
+	}
+	key.Hdr.Name, key.Hdr.Ttl = ".", signedKeyTTL
+	return key, signer, nil
+}
+
+// keyFor returns a copy of key owned by apex.
+func keyFor(key *dns.DNSKEY, apex string) *dns.DNSKEY {
+	k := dns.Copy(key).(*dns.DNSKEY)
+	k.Hdr.Name = apex
+	return k
+}
+
+// signedZoneDS returns the DS record served for apex, the apex of one of the
+// signed zones.
+func signedZoneDS(apex string) *dns.DS {
+	key := zoneKey
+	if apex == zone("nods") {
+		key = decoyKey
+	}
+	ds := keyFor(key, apex).ToDS(dns.SHA256)
+	ds.Hdr.Ttl = signedKeyTTL
+	return ds
+}
+
+// infWildSignatures counts the answers signed for infwild.signed.<base>,
+// per second, under "<Unix second>".
+var infWildSignatures = newCounters("infwildsign")
+
+// signedZoneHandler returns a handler serving the signed zone name like a
+// healthy zone, signed and broken as described above. Under signed.<base>
+// there are a few more variations: <anything>.tobogus.signed.<base> is a
+// CNAME to <anything>.bogus.signed.<base>, names under selfcut.signed.<base>
+// are served by serveSelfCut, and A, AAAA and TXT queries under
+// unordered.signed.<base> get RRsets of four records put on the wire in the
+// reverse of canonical order. Signatures are always made over the canonical
+// order, so validators that check them over the order the records arrive in
+// find them bogus. Names under infwild.signed.<base> are answered like those
+// under infwild.<base>, each with signatures of its own for validators to
+// check, at up to -infwild-sign-rate answers a second.
+func signedZoneHandler(name string) dns.HandlerFunc {
+	return func(w dns.ResponseWriter, q *dns.Msg) {
+		logQuery(w, q, "signedZoneHandler")
+		apex := zone(name)
+		qname := qname(q)
+		labels := subLabels(qname, apex)
+		qtype := q.Question[0].Qtype
+		m := new(dns.Msg)
+		m.SetRcode(q, dns.RcodeSuccess)
+		m.Authoritative = true
+		signed := name == "signed"
+		do := false
+		if opt := q.IsEdns0(); opt != nil && opt.Do() {
+			do = true
+		}
+		var nsec dns.RR
+		if name == "denial" && len(labels) > 0 && serveDenial(w, q, strings.ToLower(labels[len(labels)-1])) {
+			return
+		}
+		switch {
+		case len(labels) == 0 && qtype == dns.TypeDNSKEY:
+			m.Answer = []dns.RR{keyFor(zoneKey, apex)}
+		case len(labels) == 0 && qtype == dns.TypeDS:
+			m.Answer = []dns.RR{signedZoneDS(apex)}
+			w.WriteMsg(m)
+			return
+		case len(labels) == 0 && qtype == dns.TypeSOA:
+			m.Answer = []dns.RR{soaRecord(apex)}
+		case signed && len(labels) > 0 && strings.EqualFold(labels[len(labels)-1], "tobogus"):
+			target := "bogus." + apex
+			if len(labels) > 1 {
+				target = strings.Join(labels[:len(labels)-1], ".") + "." + target
+			}
+			m.Answer = []dns.RR{&dns.CNAME{
+				Hdr:    dns.RR_Header{Name: qname, Rrtype: dns.TypeCNAME, Class: dns.ClassINET},
+				Target: target,
+			}}
+		case signed && len(labels) > 1 && strings.EqualFold(labels[len(labels)-1], "selfcut"):
+			serveSelfCut(w, q, "selfcut."+apex, true)
+			return
+		case signed && len(labels) > 0 && strings.EqualFold(labels[len(labels)-1], "unordered") && unorderedRRset(qname, qtype) != nil:
+			m.Answer = unorderedRRset(qname, qtype)
+		case signed && len(labels) > 0 && strings.EqualFold(labels[len(labels)-1], "infwild"):
+			second := strconv.FormatInt(time.Now().Unix(), 10)
+			if do && infWildSignatures.incr(second, 2*time.Second) > *infWildSignRate {
+				m.SetRcode(q, dns.RcodeServerFailure)
+				m.Authoritative = false
+				w.WriteMsg(m)
+				return
+			}
+			infWildAnswer(m, q, "infwild."+apex, apex)
+			nsec = &dns.NSEC{
+				Hdr:        dns.RR_Header{Name: qname, Rrtype: dns.TypeNSEC, Class: dns.ClassINET},
+				NextDomain: `\000.` + qname,
+				TypeBitMap: []uint16{dns.TypeA, dns.TypeTXT, dns.TypeAAAA, dns.TypeRRSIG, dns.TypeNSEC},
+			}
+		default:
+			healthyAnswer(m, q, apex)
+		}
+		if do {
+			if len(m.Answer) == 0 {
+				if nsec == nil {
+					nsec = nodataNSEC(qname, len(labels) == 0)
+				}
+				m.Ns = append(m.Ns, nsec)
+			}
+			if name != "missingrrsig" {
+				m.Answer = signSection(m.Answer, apex, name)
+				m.Ns = signSection(m.Ns, apex, name)
+			}
+			m.SetEdns0(1232, true)
+		}
+		w.WriteMsg(m)
+	}
+}
+
+// unorderedRRset returns an RRset of type rrtype for name in descending
+// canonical order, or nil for types other than A, AAAA and TXT.
+func unorderedRRset(name string, rrtype uint16) []dns.RR {
+	var rrs []dns.RR
+	for i := 4; i >= 1; i-- {
+		hdr := dns.RR_Header{Name: name, Rrtype: rrtype, Class: dns.ClassINET}
+		switch rrtype {
+		case dns.TypeA:
+			rrs = append(rrs, &dns.A{Hdr: hdr, A: net.IPv4(192, 0, 2, byte(10*i))})
+		case dns.TypeAAAA:
+			rrs = append(rrs, &dns.AAAA{Hdr: hdr, AAAA: net.ParseIP(fmt.Sprintf("2001:db8::%d", 10*i))})
+		case dns.TypeTXT:
+			rrs = append(rrs, &dns.TXT{Hdr: hdr, Txt: []string{fmt.Sprintf("record %d", i)}})
+		default:
+			return nil
+		}
+	}
+	return rrs
+}
+
+// nodataNSEC returns an NSEC record proving that name, which exists, has none
+// of the types healthyAnswer doesn't serve. It covers nothing but name.
+func nodataNSEC(name string, apex bool) dns.RR {
+	types := []uint16{dns.TypeA}
+	if apex {
+		types = append(types, dns.TypeSOA)
+	}
+	types = append(types, dns.TypeTXT)
+	if advertise6 != nil {
+		types = append(types, dns.TypeAAAA)
+	}
+	types = append(types, dns.TypeSRV, dns.TypeRRSIG, dns.TypeNSEC)
+	if apex {
+		types = append(types, dns.TypeDNSKEY)
+	}
+	return &dns.NSEC{
+		Hdr:        dns.RR_Header{Name: name, Rrtype: dns.TypeNSEC, Class: dns.ClassINET},
+		NextDomain: `\000.` + name,
+		TypeBitMap: types,
+	}
+}
+
+// signSection returns rrs with an RRSIG by the zone key added after each
+// RRset, as the zone apex, which is or is below the signed zone name, signs
+// them. RRsets under bogus.signed.<base>, and all of them in badsig.<base>,
+// get an RRSIG whose signature has been tampered with. In
+// expiredrrsig.<base> the RRSIGs expired a day ago.
+func signSection(rrs []dns.RR, apex, name string) []dns.RR {
+	var out []dns.RR
+	for len(rrs) > 0 {
+		hdr := rrs[0].Header()
+		n := 1
+		for n < len(rrs) && rrs[n].Header().Rrtype == hdr.Rrtype && strings.EqualFold(rrs[n].Header().Name, hdr.Name) {
+			n++
+		}
+		rrset := rrs[:n]
+		rrs = rrs[n:]
+		out = append(out, rrset...)
+		now := signingTime(hdr.Name)
+		inception, expiration := now.Add(-time.Hour), now.Add(24*time.Hour)
+		if name == "expiredrrsig" {
+			inception, expiration = now.Add(-30*24*time.Hour), now.Add(-24*time.Hour)
+		}
+		sig := &dns.RRSIG{
+			Hdr:        dns.RR_Header{Ttl: hdr.Ttl},
+			Algorithm:  zoneKey.Algorithm,
+			Expiration: uint32(expiration.Unix()),
+			Inception:  uint32(inception.Unix()),
+			KeyTag:     zoneKey.KeyTag(),
+			SignerName: apex,
+		}
+		if err := sig.Sign(zoneSigner, rrset); err != nil {
+			log.Printf("signing %s/%s: %s", hdr.Name, dns.TypeToString[hdr.Rrtype], err)
+			continue
+		}
+		if name == "badsig" || dns.IsSubDomain("bogus."+zone("signed"), hdr.Name) {
+			if b, err := base64.StdEncoding.DecodeString(sig.Signature); err == nil && len(b) > 0 {
+				b[len(b)/2] ^= 0xff
+				sig.Signature = base64.StdEncoding.EncodeToString(b)
+			}
+		}
+		out = append(out, sig)
+	}
+	return out
+}
+
+// crossSignHandler serves names of the form <anything>.<variant>.crosssign.<base>,
+// which isn't signed, with a CNAME into signed.<base>. With variant valid the
+// target is <anything>.signed.<base>, which answers securely. With bogus it is
+// <anything>.tobogus.signed.<base>, a securely signed CNAME to a bogus answer,
+// so resolving a single name goes from insecure to secure to bogus.
+func crossSignHandler(w dns.ResponseWriter, q *dns.Msg) {
+	logQuery(w, q, "crossSignHandler")
+	name := qname(q)
+	labels := subLabels(name, zone("crosssign"))
+	if len(labels) < 2 {
+		txtError(w, q, "query <anything>.valid.crosssign.<base> or <anything>.bogus.crosssign.<base>")
+		return
+	}
+	prefix := strings.Join(labels[:len(labels)-1], ".")
+	var target string
+	switch variant := strings.ToLower(labels[len(labels)-1]); variant {
+	case "valid":
+		target = prefix + "." + zone("signed")
+	case "bogus":
+		target = prefix + ".tobogus." + zone("signed")
+	default:
+		txtError(w, q, "unknown variant "+variant)
+		return
+	}
+	m := new(dns.Msg)
+	m.SetRcode(q, dns.RcodeSuccess)
+	m.Authoritative = true
+	m.Answer = []dns.RR{&dns.CNAME{
+		Hdr:    dns.RR_Header{Name: name, Rrtype: dns.TypeCNAME, Class: dns.ClassINET},
+		Target: target,
+	}}
+	w.WriteMsg(m)
+}
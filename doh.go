@@ -0,0 +1,180 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+var httpsListen = flag.String("https-listen", "", "address for a DNS over HTTPS listener, e.g. :443. Disabled if empty. Uses -tls-cert and -tls-key.")
+var dohProtocols = flag.String("doh-protocols", "both", "HTTP versions the DoH listener speaks: both, http1 or http2.")
+
+// dohPath is where DoH queries are served, as suggested by RFC 8484.
+const dohPath = "/dns-query"
+
+// dohNoAnswerWait is how long a DoH request is held open when the handler
+// chose not to answer, standing in for the timeout a UDP client would hit.
+const dohNoAnswerWait = 30 * time.Second
+
+// dohServer returns an HTTPS server for DNS over HTTPS on addr.
+func dohServer(addr string) (*http.Server, error) {
+	config, err := tlsConfig()
+	if err != nil {
+		return nil, err
+	}
+	protocols := new(http.Protocols)
+	switch *dohProtocols {
+	case "both":
+		protocols.SetHTTP1(true)
+		protocols.SetHTTP2(true)
+	case "http1":
+		protocols.SetHTTP1(true)
+	case "http2":
+		protocols.SetHTTP2(true)
+	default:
+		return nil, fmt.Errorf("unknown -doh-protocols %q", *dohProtocols)
+	}
+	if err := checkDoHRedirect(); err != nil {
+		return nil, err
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc(dohPath, dohRedirector(dohHandler))
+	if *dohRedirect != "" {
+		mux.HandleFunc(dohPath+"/", dohRedirector(dohHandler))
+	}
+	mux.HandleFunc("/resolve", dohJSONHandler)
+	if odoh, err = newODoHTarget(); err != nil {
+		return nil, err
+	}
+	mux.HandleFunc("/.well-known/odohconfigs", odohConfigsHandler)
+	if *odohRelay {
+		mux.HandleFunc("/proxy", odohRelayHandler)
+	}
+	return &http.Server{
+		Addr:      addr,
+		Handler:   mux,
+		TLSConfig: config,
+		Protocols: protocols,
+	}, nil
+}
+
+// dohHandler implements RFC 8484: GET requests carry the query base64url
+// encoded in the dns parameter, POST requests carry it as the body.
+func dohHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Content-Type") == odohContentType {
+		odohQueryHandler(w, r)
+		return
+	}
+	if strings.Contains(r.Header.Get("Accept"), "application/dns-json") {
+		dohJSONHandler(w, r)
+		return
+	}
+	var wire []byte
+	var err error
+	switch r.Method {
+	case http.MethodGet:
+		wire, err = base64.RawURLEncoding.DecodeString(r.URL.Query().Get("dns"))
+	case http.MethodPost:
+		if r.Header.Get("Content-Type") != "application/dns-message" {
+			http.Error(w, "expected application/dns-message", http.StatusUnsupportedMediaType)
+			return
+		}
+		wire, err = io.ReadAll(io.LimitReader(r.Body, dns.MaxMsgSize))
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		http.Error(w, fmt.Sprintf("%s not allowed", r.Method), http.StatusMethodNotAllowed)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	q := new(dns.Msg)
+	if err := q.Unpack(wire); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	response, ok := serveHTTPQuery(r, q)
+	if !ok {
+		ctx, cancel := context.WithTimeout(r.Context(), dohNoAnswerWait)
+		defer cancel()
+		<-ctx.Done()
+		http.Error(w, "no answer", http.StatusGatewayTimeout)
+		return
+	}
+	w.Header().Set("Content-Type", "application/dns-message")
+	w.Write(response)
+}
+
+// serveHTTPQuery runs q, which arrived in r, through the handlers and returns
+// the first message they wrote. It returns false if they wrote nothing.
+func serveHTTPQuery(r *http.Request, q *dns.Msg) ([]byte, bool) {
+	hw := &httpResponseWriter{
+		local:  localAddr(r),
+		remote: remoteAddr(r),
+	}
+	serveQuery(hw, q)
+	if len(hw.written) == 0 {
+		return nil, false
+	}
+	if len(hw.written) > 1 {
+		log.Printf("dropping %d extra messages for %s over HTTP", len(hw.written)-1, hw.remote)
+	}
+	return hw.written[0], true
+}
+
+// localAddr returns the address r was received on.
+func localAddr(r *http.Request) net.Addr {
+	if addr, ok := r.Context().Value(http.LocalAddrContextKey).(net.Addr); ok {
+		return addr
+	}
+	return &net.TCPAddr{}
+}
+
+// remoteAddr returns the address r came from.
+func remoteAddr(r *http.Request) net.Addr {
+	addr, err := net.ResolveTCPAddr("tcp", r.RemoteAddr)
+	if err != nil {
+		return &net.TCPAddr{}
+	}
+	return addr
+}
+
+// httpResponseWriter is a dns.ResponseWriter that collects the messages
+// written to it, for transports where they are sent by other means.
+type httpResponseWriter struct {
+	local, remote net.Addr
+	written       [][]byte
+}
+
+func (w *httpResponseWriter) LocalAddr() net.Addr  { return w.local }
+func (w *httpResponseWriter) RemoteAddr() net.Addr { return w.remote }
+
+func (w *httpResponseWriter) WriteMsg(m *dns.Msg) error {
+	wire, err := m.Pack()
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(wire)
+	return err
+}
+
+func (w *httpResponseWriter) Write(b []byte) (int, error) {
+	w.written = append(w.written, append([]byte(nil), b...))
+	return len(b), nil
+}
+
+func (w *httpResponseWriter) Close() error        { return nil }
+func (w *httpResponseWriter) TsigStatus() error   { return nil }
+func (w *httpResponseWriter) TsigTimersOnly(bool) {}
+func (w *httpResponseWriter) Hijack()             {}
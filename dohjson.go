@@ -0,0 +1,158 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/miekg/dns"
+)
+
+var dohJSONQuirks = flag.String("doh-json-quirks", "", "comma separated misbehaviors of the JSON DoH API: wrong-cors, flip-types, wrong-content-type.")
+
+// dohJSONResponses counts JSON responses, so flip-types can alternate.
+var dohJSONResponses atomic.Uint64
+
+// dohJSON is a response in the JSON format popularized by Google and
+// Cloudflare.
+type dohJSON struct {
+	Status    int             `json:"Status"`
+	TC        bool            `json:"TC"`
+	RD        bool            `json:"RD"`
+	RA        bool            `json:"RA"`
+	AD        bool            `json:"AD"`
+	CD        bool            `json:"CD"`
+	Question  []dohJSONRecord `json:"Question"`
+	Answer    []dohJSONRecord `json:"Answer,omitempty"`
+	Authority []dohJSONRecord `json:"Authority,omitempty"`
+	Extra     []dohJSONRecord `json:"Additional,omitempty"`
+	Comment   string          `json:"Comment,omitempty"`
+}
+
+type dohJSONRecord struct {
+	Name string `json:"name"`
+	// Type is a number, except with the flip-types quirk, where every other
+	// response uses mnemonics instead.
+	Type any     `json:"type"`
+	TTL  *uint32 `json:"TTL,omitempty"`
+	Data string  `json:"data,omitempty"`
+}
+
+// hasQuirk reports whether the comma separated list quirks contains quirk.
+func hasQuirk(quirks, quirk string) bool {
+	for _, q := range strings.Split(quirks, ",") {
+		if q == quirk {
+			return true
+		}
+	}
+	return false
+}
+
+// dohJSONHandler serves JSON DoH queries of the form
+// ?name=example.com&type=AAAA&cd=1&do=1 on /resolve, and on /dns-query for
+// clients that ask for application/dns-json.
+func dohJSONHandler(w http.ResponseWriter, r *http.Request) {
+	name := r.FormValue("name")
+	if name == "" {
+		http.Error(w, "missing name parameter", http.StatusBadRequest)
+		return
+	}
+	qtype := dns.TypeA
+	if t := r.FormValue("type"); t != "" {
+		if n, err := strconv.ParseUint(t, 10, 16); err == nil {
+			qtype = uint16(n)
+		} else if n, ok := dns.StringToType[strings.ToUpper(t)]; ok {
+			qtype = n
+		} else {
+			http.Error(w, fmt.Sprintf("unknown type %q", t), http.StatusBadRequest)
+			return
+		}
+	}
+	q := new(dns.Msg)
+	q.SetQuestion(dns.Fqdn(name), qtype)
+	q.CheckingDisabled = isTrue(r.FormValue("cd"))
+	if isTrue(r.FormValue("do")) {
+		q.SetEdns0(dns.DefaultMsgSize, true)
+	}
+
+	wire, ok := serveHTTPQuery(r, q)
+	if !ok {
+		http.Error(w, "no answer", http.StatusGatewayTimeout)
+		return
+	}
+	m := new(dns.Msg)
+	if err := m.Unpack(wire); err != nil {
+		http.Error(w, "unparseable answer from handler: "+err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	mnemonics := hasQuirk(*dohJSONQuirks, "flip-types") && dohJSONResponses.Add(1)%2 == 0
+	resp := dohJSON{
+		Status: m.Rcode,
+		TC:     m.Truncated,
+		RD:     m.RecursionDesired,
+		RA:     m.RecursionAvailable,
+		AD:     m.AuthenticatedData,
+		CD:     m.CheckingDisabled,
+	}
+	for _, question := range m.Question {
+		resp.Question = append(resp.Question, dohJSONRecord{
+			Name: question.Name,
+			Type: jsonType(question.Qtype, mnemonics),
+		})
+	}
+	resp.Answer = jsonRecords(m.Answer, mnemonics)
+	resp.Authority = jsonRecords(m.Ns, mnemonics)
+	resp.Extra = jsonRecords(m.Extra, mnemonics)
+
+	body, err := json.Marshal(resp)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if hasQuirk(*dohJSONQuirks, "wrong-cors") {
+		w.Header().Set("Access-Control-Allow-Origin", "https://cors.invalid")
+		w.Header().Set("Access-Control-Allow-Methods", "PUT")
+	} else {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+	}
+	if hasQuirk(*dohJSONQuirks, "wrong-content-type") {
+		w.Header().Set("Content-Type", "text/html")
+	} else {
+		w.Header().Set("Content-Type", "application/dns-json")
+	}
+	w.Write(body)
+}
+
+func isTrue(s string) bool {
+	return s == "1" || strings.EqualFold(s, "true")
+}
+
+func jsonType(t uint16, mnemonic bool) any {
+	if mnemonic {
+		return dns.Type(t).String()
+	}
+	return t
+}
+
+func jsonRecords(rrs []dns.RR, mnemonics bool) []dohJSONRecord {
+	var records []dohJSONRecord
+	for _, rr := range rrs {
+		hdr := rr.Header()
+		if hdr.Rrtype == dns.TypeOPT {
+			continue
+		}
+		ttl := hdr.Ttl
+		records = append(records, dohJSONRecord{
+			Name: hdr.Name,
+			Type: jsonType(hdr.Rrtype, mnemonics),
+			TTL:  &ttl,
+			Data: strings.TrimPrefix(rr.String(), hdr.String()),
+		})
+	}
+	return records
+}
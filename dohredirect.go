@@ -0,0 +1,98 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+var dohRedirect = flag.String("doh-redirect", "", "how the DoH listener redirects queries to /dns-query: path, to another path; host, to the same path on another name for this server; loop, around a circle of paths back to /dns-query. Empty answers them.")
+
+// dohMovedPath is where the path and host modes of -doh-redirect send
+// clients, and where they are answered.
+const dohMovedPath = dohPath + "/moved"
+
+// dohLoopPath is the prefix of the paths the loop mode of -doh-redirect
+// sends clients around, and dohLoopLength how many of them there are before
+// it comes back to dohPath.
+const (
+	dohLoopPath   = dohPath + "/loop/"
+	dohLoopLength = 3
+)
+
+// checkDoHRedirect reports an error if -doh-redirect is not a known mode.
+func checkDoHRedirect() error {
+	switch *dohRedirect {
+	case "", "path", "host", "loop":
+		return nil
+	}
+	return fmt.Errorf("unknown -doh-redirect %q", *dohRedirect)
+}
+
+// dohRedirector wraps the DoH handler next with the redirects of
+// -doh-redirect. They are all 307s, so that the method and body of POST
+// requests are kept, and keep the query string of GET requests. How many
+// of them a client follows, and whether it follows them to another host at
+// all, is up to it: RFC 8484 doesn't say.
+func dohRedirector(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		target := dohRedirectTarget(r)
+		if target == "" {
+			next(w, r)
+			return
+		}
+		if r.URL.RawQuery != "" {
+			target += "?" + r.URL.RawQuery
+		}
+		http.Redirect(w, r, target, http.StatusTemporaryRedirect)
+	}
+}
+
+// dohRedirectTarget returns where to redirect r to, or "" if it is to be
+// answered.
+func dohRedirectTarget(r *http.Request) string {
+	switch *dohRedirect {
+	case "path":
+		if r.URL.Path == dohPath {
+			return dohMovedPath
+		}
+	case "host":
+		if r.URL.Path == dohPath {
+			return "https://" + otherDoHHost(r.Host) + dohMovedPath
+		}
+	case "loop":
+		if r.URL.Path == dohPath {
+			return dohLoopPath + "1"
+		}
+		n, err := strconv.Atoi(strings.TrimPrefix(r.URL.Path, dohLoopPath))
+		if err != nil || n < 1 {
+			return ""
+		}
+		if n < dohLoopLength {
+			return dohLoopPath + strconv.Itoa(n+1)
+		}
+		return dohPath
+	}
+	return ""
+}
+
+// otherDoHHost returns a host, with the port of host, that leads to this
+// server like host does, but by another name: ns.<base>, or the advertised
+// address if host is ns.<base> already.
+func otherDoHHost(host string) string {
+	name, port, err := net.SplitHostPort(host)
+	if err != nil {
+		name, port = host, ""
+	}
+	other := strings.TrimSuffix(zone("ns"), ".")
+	if strings.EqualFold(name, other) {
+		other = advertise4.String()
+	}
+	if port == "" {
+		return other
+	}
+	return net.JoinHostPort(other, port)
+}
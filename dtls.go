@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/pion/dtls/v2"
+	"github.com/pion/transport/v2/udp"
+)
+
+var dtlsListen = flag.String("dtls-listen", "", "address for an experimental DNS over DTLS (RFC 8094) listener, e.g. :853. Disabled if empty. Uses -tls-cert and -tls-key.")
+var dtlsQuirks = flag.String("dtls-quirks", "", "comma separated handshake misbehaviors of the DTLS listener: no-cookie (skip the HelloVerifyRequest), tiny-mtu (fragment the handshake into 200 byte datagrams), stall (never answer a ClientHello). -tls-handshake-delay applies to each handshake datagram.")
+
+const (
+	// dtlsHandshakeTimeout is how long a DTLS handshake may take.
+	dtlsHandshakeTimeout = 30 * time.Second
+	// dtlsIdleTimeout is how long a DTLS association is kept without
+	// queries.
+	dtlsIdleTimeout = time.Minute
+)
+
+// A dtlsServer serves DNS over DTLS. Each DNS message travels in a DTLS
+// record of its own, without a length prefix.
+type dtlsServer struct {
+	listener net.Listener
+	config   *dtls.Config
+	stall    bool
+}
+
+// newDTLSServer returns a DNS over DTLS server listening on addr.
+func newDTLSServer(addr string) (*dtlsServer, error) {
+	tlsConf, err := tlsConfig()
+	if err != nil {
+		return nil, err
+	}
+	for _, quirk := range strings.Split(*dtlsQuirks, ",") {
+		switch quirk {
+		case "", "no-cookie", "tiny-mtu", "stall":
+		default:
+			return nil, fmt.Errorf("unknown -dtls-quirks %q", quirk)
+		}
+	}
+	config := &dtls.Config{
+		Certificates: tlsConf.Certificates,
+		ConnectContextMaker: func() (context.Context, func()) {
+			return context.WithTimeout(context.Background(), dtlsHandshakeTimeout)
+		},
+		InsecureSkipVerifyHello: hasQuirk(*dtlsQuirks, "no-cookie"),
+	}
+	if hasQuirk(*dtlsQuirks, "tiny-mtu") {
+		config.MTU = 200
+	}
+	laddr, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	l, err := (&udp.ListenConfig{}).Listen("udp", laddr)
+	if err != nil {
+		return nil, err
+	}
+	return &dtlsServer{listener: l, config: config, stall: hasQuirk(*dtlsQuirks, "stall")}, nil
+}
+
+// serve accepts associations until the listener fails.
+func (s *dtlsServer) serve() error {
+	for {
+		c, err := s.listener.Accept()
+		if err != nil {
+			return err
+		}
+		go s.serveConn(c)
+	}
+}
+
+// serveConn does the handshake on c, which carries the datagrams of one
+// client, and then serves the queries that come in on it one at a time.
+func (s *dtlsServer) serveConn(c net.Conn) {
+	if s.stall {
+		c.SetReadDeadline(time.Now().Add(dtlsHandshakeTimeout))
+		io.Copy(io.Discard, c)
+		c.Close()
+		return
+	}
+	conn, err := dtls.Server(dtlsJitterConn{c}, s.config)
+	if err != nil {
+		log.Printf("DTLS handshake with %s: %s", c.RemoteAddr(), err)
+		c.Close()
+		return
+	}
+	defer conn.Close()
+	buf := make([]byte, dns.MaxMsgSize)
+	for {
+		conn.SetReadDeadline(time.Now().Add(dtlsIdleTimeout))
+		n, err := conn.Read(buf)
+		if err != nil {
+			return
+		}
+		q := new(dns.Msg)
+		if err := q.Unpack(buf[:n]); err != nil {
+			log.Printf("bad DTLS query from %s: %s", conn.RemoteAddr(), err)
+			continue
+		}
+		serveQuery(dtlsResponseWriter{conn}, q)
+	}
+}
+
+// A dtlsJitterConn delays each handshake datagram it writes by a handshake
+// delay.
+type dtlsJitterConn struct {
+	net.Conn
+}
+
+func (c dtlsJitterConn) Write(b []byte) (int, error) {
+	if len(b) > 0 && (b[0] == tlsHandshake || b[0] == tlsChangeCipherSpec) {
+		time.Sleep(handshakeDelays.pick())
+	}
+	return c.Conn.Write(b)
+}
+
+// dtlsResponseWriter is a dns.ResponseWriter for a DTLS association.
+type dtlsResponseWriter struct {
+	*dtls.Conn
+}
+
+func (w dtlsResponseWriter) WriteMsg(m *dns.Msg) error {
+	wire, err := m.Pack()
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(wire)
+	return err
+}
+
+func (w dtlsResponseWriter) TsigStatus() error   { return nil }
+func (w dtlsResponseWriter) TsigTimersOnly(bool) {}
+func (w dtlsResponseWriter) Hijack()             {}
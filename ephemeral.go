@@ -0,0 +1,130 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// Ephemeral names give each test its own name to query, so that tests
+// sharing a resolver can't see each other's cached answers. A tester
+// provisions one through the admin API with a chain of scenario steps, and
+// gets back a name <id>.ephemeral.<base>. Queries for it and any name below
+// it are answered by the steps, counting queries per exact name as under
+// scenario.<base>, until the name expires.
+
+// ephemeralDefaultTTL is how long an ephemeral name lasts if the tester
+// doesn't say.
+const ephemeralDefaultTTL = time.Hour
+
+// An ephemeral is a provisioned name and the steps it is served with.
+type ephemeral struct {
+	scenario
+	expires time.Time
+}
+
+var (
+	ephemeralsMu sync.Mutex
+	// ephemerals are keyed by the label directly below ephemeral.<base>.
+	ephemerals = make(map[string]*ephemeral)
+)
+
+// ephemeralPositions counts queries for each name under ephemeral.<base>.
+var ephemeralPositions = newCounters("ephemeral")
+
+// ephemeralHandler serves the names provisioned under ephemeral.<base>, and
+// NXDOMAIN for any others.
+func ephemeralHandler(w dns.ResponseWriter, q *dns.Msg) {
+	logQuery(w, q, "ephemeralHandler")
+	name := qname(q)
+	labels := subLabels(name, zone("ephemeral"))
+	var e *ephemeral
+	var id string
+	if len(labels) > 0 {
+		id = strings.ToLower(labels[len(labels)-1])
+		e = lookupEphemeral(id)
+	}
+	if e == nil {
+		m := new(dns.Msg)
+		m.SetRcode(q, dns.RcodeNameError)
+		m.Authoritative = true
+		m.Ns = []dns.RR{soaRecord(zone("ephemeral"))}
+		w.WriteMsg(m)
+		return
+	}
+	n := int(ephemeralPositions.incr(strings.ToLower(name), scenarioMemory)) - 1
+	serveStep(w, q, e.step(n), id+"."+zone("ephemeral"))
+}
+
+// lookupEphemeral returns the live ephemeral name with the given id, or nil.
+func lookupEphemeral(id string) *ephemeral {
+	ephemeralsMu.Lock()
+	defer ephemeralsMu.Unlock()
+	e := ephemerals[id]
+	if e == nil || !time.Now().Before(e.expires) {
+		return nil
+	}
+	return e
+}
+
+// ephemeralAdminHandler provisions a name on POST with
+// ?steps=<step>,<step>,...&then=<stay or restart>&ttl=<duration>, where
+// then and ttl are optional, and responds with the name.
+func ephemeralAdminHandler(w http.ResponseWriter, r *http.Request) {
+	if !requirePost(w, r) {
+		return
+	}
+	var steps []string
+	for _, step := range strings.Split(r.FormValue("steps"), ",") {
+		if step = strings.Trim(strings.TrimSpace(step), "."); step != "" {
+			steps = append(steps, step)
+		}
+	}
+	if len(steps) == 0 {
+		http.Error(w, "steps must list at least one step", http.StatusBadRequest)
+		return
+	}
+	then := r.FormValue("then")
+	switch then {
+	case "", "stay", "restart":
+	default:
+		http.Error(w, fmt.Sprintf("unknown then %q", then), http.StatusBadRequest)
+		return
+	}
+	ttl := ephemeralDefaultTTL
+	if s := r.FormValue("ttl"); s != "" {
+		var err error
+		if ttl, err = time.ParseDuration(s); err != nil || ttl <= 0 {
+			http.Error(w, fmt.Sprintf("bad ttl %q", s), http.StatusBadRequest)
+			return
+		}
+	}
+	fmt.Fprintln(w, newEphemeral(scenario{Steps: steps, Then: then}, ttl))
+}
+
+// newEphemeral provisions a name served with the steps of s for ttl, and
+// returns it.
+func newEphemeral(s scenario, ttl time.Duration) string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	id := hex.EncodeToString(b)
+	now := time.Now()
+	ephemeralsMu.Lock()
+	defer ephemeralsMu.Unlock()
+	for old, e := range ephemerals {
+		if !now.Before(e.expires) {
+			delete(ephemerals, old)
+		}
+	}
+	ephemerals[id] = &ephemeral{scenario: s, expires: now.Add(ttl)}
+	name := id + "." + zone("ephemeral")
+	log.Printf("ephemeral: %s served with %s for %s", name, strings.Join(s.Steps, ","), ttl)
+	return name
+}
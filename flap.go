@@ -0,0 +1,78 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+var flapProfiles = flag.String("flap", "", "two behavior profiles the whole instance switches between every -flap-period, emulating an anycast site flap, e.g. healthy,lame. A profile is healthy, lame (REFUSED to everything), servfail, drop, or a name relative to -base, such as 800.sleep, that every query is served as. Disabled if empty.")
+var flapPeriod = flag.Duration("flap-period", 30*time.Second, "how long each -flap profile lasts.")
+
+// flapSet holds the parsed value of -flap, or nothing if it is disabled.
+var flapSet []string
+
+// flapLast is the index in flapSet of the profile the last query was served
+// with, plus one, so that switches can be logged.
+var flapLast atomic.Int64
+
+// parseFlap sets flapSet from the flags.
+func parseFlap() error {
+	if *flapProfiles == "" {
+		return nil
+	}
+	profiles := strings.Split(*flapProfiles, ",")
+	if len(profiles) != 2 {
+		return fmt.Errorf("-flap: expected two profiles, got %q", *flapProfiles)
+	}
+	if *flapPeriod <= 0 {
+		return fmt.Errorf("-flap-period must be positive")
+	}
+	for _, p := range profiles {
+		p = strings.Trim(strings.ToLower(strings.TrimSpace(p)), ".")
+		if p == "" {
+			return fmt.Errorf("-flap: empty profile in %q", *flapProfiles)
+		}
+		flapSet = append(flapSet, p)
+	}
+	return nil
+}
+
+// flapProfile returns the -flap profile in effect now.
+func flapProfile() string {
+	if len(flapSet) == 0 {
+		return "healthy"
+	}
+	i := time.Now().UnixNano() / int64(*flapPeriod) % 2
+	if old := flapLast.Swap(i + 1); old != i+1 {
+		log.Printf("flap: switched to %s", flapSet[i])
+	}
+	return flapSet[i]
+}
+
+// flap applies the current -flap profile to q. It returns the query to hand
+// to the handlers, or false if the profile already took care of it.
+func (rw *responseWriter) flap(q *dns.Msg) (*dns.Msg, bool) {
+	profile := flapProfile()
+	switch profile {
+	case "healthy":
+		return q, true
+	case "drop":
+	case "lame", "servfail":
+		m := new(dns.Msg)
+		m.SetRcode(q, dns.RcodeRefused)
+		if profile == "servfail" {
+			m.Rcode = dns.RcodeServerFailure
+		}
+		rw.WriteMsg(m)
+	default:
+		return rw.serveAs(q, dns.Fqdn(profile+"."+*basename)), true
+	}
+	rw.handler = "flap"
+	return q, false
+}
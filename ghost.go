@@ -0,0 +1,133 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// Under ghost.<base>, every label directly below ghost is a delegated child
+// zone, e.g. www.z1.ghost.<base> is in the child zone z1.ghost.<base>. This
+// process plays both the parent and the child. A client that hasn't been
+// handed a referral for a zone within the last ghostParentTTL is talking to
+// the parent; otherwise it is talking to the child.
+//
+// Through the admin API the parent's delegation can be revoked, after which
+// the parent answers NXDOMAIN for the zone. The child carries on as if nothing
+// happened and keeps handing out its NS RRset with a long TTL, which is how
+// ghost domains stay resolvable in resolvers that let child data refresh
+// their cached delegation.
+const (
+	ghostParentTTL = 60 * time.Second
+	ghostChildTTL  = 86400
+)
+
+var (
+	// ghostReferrals remembers when each client was last referred to each
+	// child zone.
+	ghostReferrals = newCounters("ghost")
+
+	ghostMu      sync.Mutex
+	ghostRevoked = make(map[string]bool)
+)
+
+// ghostHandler serves ghost.<base> and all the child zones under it.
+func ghostHandler(w dns.ResponseWriter, q *dns.Msg) {
+	logQuery(w, q, "ghostHandler")
+	labels := subLabels(qname(q), zone("ghost"))
+	if len(labels) == 0 {
+		txtError(w, q, "query a name under <zone>.ghost.<base>")
+		return
+	}
+	child := strings.ToLower(labels[len(labels)-1])
+	childZone := child + "." + zone("ghost")
+	key := clientIP(w) + "|" + child
+	m := new(dns.Msg)
+	m.SetRcode(q, dns.RcodeSuccess)
+
+	if _, ok := ghostReferrals.get(key); !ok {
+		if ghostIsRevoked(child) {
+			m.SetRcode(q, dns.RcodeNameError)
+			m.Authoritative = true
+			m.Ns = []dns.RR{soaRecord(zone("ghost"))}
+			w.WriteMsg(m)
+			return
+		}
+		ghostReferrals.set(key, 1, ghostParentTTL)
+		m.Ns, m.Extra = delegation(childZone, uint32(ghostParentTTL/time.Second))
+		w.WriteMsg(m)
+		return
+	}
+
+	healthyAnswer(m, q, childZone)
+	if len(m.Answer) > 0 {
+		m.Ns, m.Extra = delegation(childZone, ghostChildTTL)
+	}
+	w.WriteMsg(m)
+}
+
+func ghostIsRevoked(child string) bool {
+	ghostMu.Lock()
+	defer ghostMu.Unlock()
+	return ghostRevoked[child]
+}
+
+// ghostAdminHandler lists revoked ghost zones on GET, and on POST revokes or
+// restores the parent's delegation for a zone:
+//
+//	POST /ghost?zone=z1&action=revoke
+//	POST /ghost?zone=z1&action=restore
+func ghostAdminHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodGet {
+		for _, child := range revokedGhosts() {
+			fmt.Fprintln(w, child)
+		}
+		return
+	}
+	if !requirePost(w, r) {
+		return
+	}
+	child := strings.ToLower(r.FormValue("zone"))
+	if child == "" || strings.Contains(child, ".") {
+		http.Error(w, "zone must be a single label", http.StatusBadRequest)
+		return
+	}
+	switch action := r.FormValue("action"); action {
+	case "revoke":
+		setGhostRevoked(child, true)
+	case "restore":
+		setGhostRevoked(child, false)
+	default:
+		http.Error(w, fmt.Sprintf("unknown action %q", action), http.StatusBadRequest)
+		return
+	}
+	fmt.Fprintf(w, "%s: %s\n", child, r.FormValue("action"))
+}
+
+// revokedGhosts returns the child zones whose delegation is revoked, sorted.
+func revokedGhosts() []string {
+	ghostMu.Lock()
+	var revoked []string
+	for child := range ghostRevoked {
+		revoked = append(revoked, child)
+	}
+	ghostMu.Unlock()
+	sort.Strings(revoked)
+	return revoked
+}
+
+// setGhostRevoked revokes or restores the delegation of a child zone.
+func setGhostRevoked(child string, revoked bool) {
+	ghostMu.Lock()
+	defer ghostMu.Unlock()
+	if revoked {
+		ghostRevoked[child] = true
+	} else {
+		delete(ghostRevoked, child)
+	}
+}
@@ -0,0 +1,250 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// giantChunk is the RDATA size of each but the last record in a giant
+// response.
+const giantChunk = 1024
+
+// giantHandler serves names of the form <size>.giant.<base>, whose responses
+// are as large as a DNS message over TCP can be, or larger:
+//
+//   - max.giant.<base> gets a response of exactly 65535 bytes, the most the
+//     two byte length prefix of DNS over TCP can describe.
+//   - over.giant.<base> gets a response of 65536 bytes. Its length doesn't fit
+//     the prefix, so it is sent with the length modulo 65536, which is zero,
+//     followed by all of the message, and the connection is closed.
+//
+// TXT and ANY queries are answered with a set of TXT records, RRSIG queries
+// with a set of RRSIGs. Over UDP the response is empty and truncated, sending
+// the client to TCP. Over DoT over.giant.<base> is framed like over TCP, and
+// over DoH, which has no length prefix, both sizes are sent as they are.
+func giantHandler(w dns.ResponseWriter, q *dns.Msg) {
+	logQuery(w, q, "giantHandler")
+	name := qname(q)
+	labels := subLabels(name, zone("giant"))
+	var size int
+	if len(labels) == 1 {
+		switch strings.ToLower(labels[0]) {
+		case "max":
+			size = dns.MaxMsgSize
+		case "over":
+			size = dns.MaxMsgSize + 1
+		}
+	}
+	if size == 0 {
+		txtError(w, q, "use max.giant or over.giant")
+		return
+	}
+
+	m := new(dns.Msg)
+	m.SetRcode(q, dns.RcodeSuccess)
+	m.Authoritative = true
+	if _, ok := w.RemoteAddr().(*net.UDPAddr); ok {
+		m.Truncated = true
+		w.WriteMsg(m)
+		return
+	}
+
+	var mk func(n int) dns.RR
+	switch q.Question[0].Qtype {
+	case dns.TypeTXT, dns.TypeANY:
+		mk = func(n int) dns.RR {
+			return &dns.TXT{
+				Hdr: dns.RR_Header{Name: name, Rrtype: dns.TypeTXT, Class: dns.ClassINET},
+				Txt: txtOfSize(n),
+			}
+		}
+	case dns.TypeRRSIG:
+		mk = func(n int) dns.RR {
+			now := signingTime(name)
+			return &dns.RRSIG{
+				Hdr:         dns.RR_Header{Name: name, Rrtype: dns.TypeRRSIG, Class: dns.ClassINET},
+				TypeCovered: dns.TypeTXT,
+				Algorithm:   dns.ECDSAP256SHA256,
+				Labels:      uint8(dns.CountLabel(name)),
+				Expiration:  uint32(now.Add(24 * time.Hour).Unix()),
+				Inception:   uint32(now.Add(-time.Hour).Unix()),
+				KeyTag:      1,
+				SignerName:  zone("giant"),
+				Signature:   base64.StdEncoding.EncodeToString(make([]byte, n)),
+			}
+		}
+	default:
+		m.Ns = []dns.RR{soaRecord(zone("giant"))}
+		w.WriteMsg(m)
+		return
+	}
+
+	wire, err := fillTo(w, m, size, mk)
+	if err != nil {
+		log.Printf("building giant response: %s", err)
+		return
+	}
+	conn := tcpConnFor(w)
+	if conn == nil {
+		conn = dotConnFor(w)
+	}
+	if len(wire) <= dns.MaxMsgSize || conn == nil {
+		if _, err := w.Write(wire); err != nil {
+			log.Printf("writing giant response: %s", err)
+		}
+		return
+	}
+	prefix := binary.BigEndian.AppendUint16(nil, uint16(len(wire)))
+	if _, err := conn.Write(append(prefix, wire...)); err != nil {
+		log.Printf("writing giant response: %s", err)
+	}
+	w.Close()
+}
+
+// fillTo sets m's answer section to records made by mk so that m, packed for
+// w, is exactly size bytes long, and returns it packed. mk makes a record
+// with n bytes of variable RDATA, as much of it as it needs.
+func fillTo(w dns.ResponseWriter, m *dns.Msg, size int, mk func(n int) dns.RR) ([]byte, error) {
+	m.Answer = nil
+	empty, err := packed(w, m)
+	if err != nil {
+		return nil, err
+	}
+	m.Answer = []dns.RR{mk(giantChunk)}
+	one, err := packed(w, m)
+	if err != nil {
+		return nil, err
+	}
+	perRecord := len(one) - len(empty)
+	room := size - len(empty)
+	if room <= 0 {
+		return nil, fmt.Errorf("response is already %d bytes without any records, leaving no room in %d", len(empty), size)
+	}
+	count := (room + perRecord - 1) / perRecord
+
+	// All records but the last get a full chunk. The last gets the rest,
+	// and if that is too little for a record, the one before it gives some up.
+	// A lone record has no one before it, so it has to fit on its own.
+	sizes := make([]int, count)
+	for i := range sizes {
+		sizes[i] = giantChunk
+	}
+	sizes[count-1] = room - count*perRecord + giantChunk
+	if short := 1 - sizes[count-1]; short > 0 {
+		if count == 1 {
+			return nil, fmt.Errorf("response is %d bytes with the smallest record, more than %d", len(empty)+perRecord-giantChunk+1, size)
+		}
+		sizes[count-1] += short
+		sizes[count-2] -= short
+	}
+	m.Answer = nil
+	for _, n := range sizes {
+		m.Answer = append(m.Answer, mk(n))
+	}
+	wire, err := packed(w, m)
+	if err != nil {
+		return nil, err
+	}
+	if len(wire) != size {
+		return nil, fmt.Errorf("response is %d bytes, not %d", len(wire), size)
+	}
+	return wire, nil
+}
+
+// txtOfSize returns character-strings that take exactly n bytes on the wire,
+// which must be at least 1.
+func txtOfSize(n int) []string {
+	var strs []string
+	for ; n >= 256; n -= 256 {
+		strs = append(strs, strings.Repeat("x", 255))
+	}
+	if n > 0 {
+		strs = append(strs, strings.Repeat("x", n-1))
+	}
+	return strs
+}
+
+// bigUDPExcess is how much larger than the client's buffer size
+// bigUDPHandler makes responses by default.
+const bigUDPExcess = 1024
+
+// maxUDPPayload is the most a UDP datagram over IPv4 can carry.
+const maxUDPPayload = 65507
+
+// bigUDPHandler serves names of the form [<anything>.]<size>.bigudp.<base>
+// with a response of size bytes, or, if there is no size label, one
+// bigUDPExcess bytes over the buffer size the query advertised (512 without
+// EDNS). Either way TC is never set, even where the response doesn't fit the
+// client's buffer: a client has to cope with the fragments, or drop what it
+// said it couldn't take. TXT and ANY queries are answered with a set of TXT
+// records, anything else with a healthy answer and an OPT record padded out
+// with an EDNS padding option.
+func bigUDPHandler(w dns.ResponseWriter, q *dns.Msg) {
+	logQuery(w, q, "bigUDPHandler")
+	name := qname(q)
+	opt := q.IsEdns0()
+	size := dns.MinMsgSize + bigUDPExcess
+	if opt != nil {
+		size = int(max(opt.UDPSize(), dns.MinMsgSize)) + bigUDPExcess
+	}
+	if labels := subLabels(name, zone("bigudp")); len(labels) > 0 {
+		if n, err := strconv.Atoi(labels[len(labels)-1]); err == nil {
+			if n < dns.MinMsgSize || n > maxUDPPayload {
+				txtError(w, q, fmt.Sprintf("size must be between %d and %d", dns.MinMsgSize, maxUDPPayload))
+				return
+			}
+			size = n
+		}
+	}
+
+	m := new(dns.Msg)
+	m.SetRcode(q, dns.RcodeSuccess)
+	m.Authoritative = true
+	var wire []byte
+	var err error
+	switch q.Question[0].Qtype {
+	case dns.TypeTXT, dns.TypeANY:
+		wire, err = fillTo(w, m, size, func(n int) dns.RR {
+			return &dns.TXT{
+				Hdr: dns.RR_Header{Name: name, Rrtype: dns.TypeTXT, Class: dns.ClassINET},
+				Txt: txtOfSize(n),
+			}
+		})
+	default:
+		healthyAnswer(m, q, zone("bigudp"))
+		wire, err = padTo(w, m, size)
+	}
+	if err != nil {
+		txtError(w, q, fmt.Sprintf("can't make a response of %d bytes: %s", size, err))
+		return
+	}
+	if _, err := w.Write(wire); err != nil {
+		log.Printf("writing bigudp response: %s", err)
+	}
+}
+
+// padTo adds an OPT record to m with a padding option that makes m, packed
+// for w, exactly size bytes long, and returns it packed.
+func padTo(w dns.ResponseWriter, m *dns.Msg, size int) ([]byte, error) {
+	padding := &dns.EDNS0_PADDING{}
+	m.SetEdns0(dns.DefaultMsgSize, false)
+	opt := m.IsEdns0()
+	opt.Option = append(opt.Option, padding)
+	wire, err := packed(w, m)
+	if err != nil {
+		return nil, err
+	}
+	if len(wire) > size {
+		return nil, fmt.Errorf("response is %d bytes before padding, more than %d", len(wire), size)
+	}
+	padding.Padding = make([]byte, size-len(wire))
+	return packed(w, m)
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+func TestFillTo(t *testing.T) {
+	label := strings.Repeat("a", 60)
+	name := label + "." + label + "." + label + ".expect-txt.512.bigudp.example."
+	q := new(dns.Msg)
+	q.SetQuestion(name, dns.TypeTXT)
+	m := new(dns.Msg)
+	m.SetRcode(q, dns.RcodeSuccess)
+	mk := func(n int) dns.RR {
+		return &dns.TXT{
+			Hdr: dns.RR_Header{Name: name, Rrtype: dns.TypeTXT, Class: dns.ClassINET},
+			Txt: txtOfSize(n),
+		}
+	}
+	empty, err := m.Pack()
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.Answer = []dns.RR{mk(1)}
+	smallest, err := m.Pack()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		size int
+		ok   bool
+	}{
+		{len(empty) - 1, false},
+		{len(empty), false},
+		{len(empty) + 1, false},
+		{len(smallest) - 1, false},
+		{len(smallest), true},
+		{len(smallest) + 1, true},
+		{len(smallest) + giantChunk, true},
+		{512, true},
+		{4096, true},
+		{maxUDPPayload, true},
+	}
+	for _, tt := range tests {
+		wire, err := fillTo(nil, m, tt.size, mk)
+		if !tt.ok {
+			if err == nil {
+				t.Errorf("fillTo(%d) = %d bytes, want an error", tt.size, len(wire))
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("fillTo(%d): %s", tt.size, err)
+			continue
+		}
+		if len(wire) != tt.size {
+			t.Errorf("fillTo(%d) = %d bytes", tt.size, len(wire))
+		}
+	}
+}
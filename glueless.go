@@ -0,0 +1,64 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// Under glueless.<base>, as under ghost.<base>, every label directly below
+// glueless is a delegated child zone, played by this process along with the
+// parent. The parent's referrals carry no glue, and name a name server
+// outside the child zone, so a resolver has to look up its address before it
+// can carry on. For a child zone <N>.glueless.<base> with N above 1, the name
+// server is ns.<N-1>.glueless.<base>, which is glueless in turn, so the
+// resolver chases N delegations before it gets to ns.<base>. Other child
+// zones are delegated to ns.<base> directly.
+
+// gluelessParentTTL is the TTL of the parent's delegations, and how long a
+// client is taken to be talking to a child zone after being referred to it.
+const gluelessParentTTL = 60 * time.Second
+
+// gluelessReferrals remembers when each client was last referred to each
+// child zone.
+var gluelessReferrals = newCounters("glueless")
+
+// gluelessHandler serves glueless.<base> and all the child zones under it.
+func gluelessHandler(w dns.ResponseWriter, q *dns.Msg) {
+	logQuery(w, q, "gluelessHandler")
+	labels := subLabels(qname(q), zone("glueless"))
+	if len(labels) == 0 {
+		txtError(w, q, "query a name under <zone>.glueless.<base>, or <N>.glueless.<base> for a chain of N")
+		return
+	}
+	child := strings.ToLower(labels[len(labels)-1])
+	childZone := child + "." + zone("glueless")
+	host := zone("ns")
+	if n, err := strconv.Atoi(child); err == nil && n > 1 {
+		host = "ns." + strconv.Itoa(n-1) + "." + zone("glueless")
+	}
+	ns := []dns.RR{&dns.NS{
+		Hdr: dns.RR_Header{Name: childZone, Rrtype: dns.TypeNS, Class: dns.ClassINET, Ttl: uint32(gluelessParentTTL / time.Second)},
+		Ns:  host,
+	}}
+	key := clientIP(w) + "|" + child
+	m := new(dns.Msg)
+	m.SetRcode(q, dns.RcodeSuccess)
+
+	if _, ok := gluelessReferrals.get(key); !ok {
+		gluelessReferrals.set(key, 1, gluelessParentTTL)
+		m.Ns = ns
+		w.WriteMsg(m)
+		return
+	}
+
+	healthyAnswer(m, q, childZone)
+	if q.Question[0].Qtype == dns.TypeNS && strings.EqualFold(qname(q), childZone) {
+		m.Answer, m.Ns = ns, nil
+	} else if len(m.Answer) > 0 {
+		m.Ns = ns
+	}
+	w.WriteMsg(m)
+}
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+var grpcListen = flag.String("grpc-listen", "", "address for the gRPC control service (see control.proto), e.g. 127.0.0.1:8054. Like the admin API, it should only be reachable by the people running tests. Disabled if empty.")
+
+// watcherBacklog is how many events a WatchQueries stream can fall behind by
+// before events are dropped for it.
+const watcherBacklog = 1024
+
+// A watcher is a WatchQueries stream.
+type watcher struct {
+	name, session string
+	events        chan *QueryEvent
+}
+
+var (
+	watchersMu sync.Mutex
+	watchers   = make(map[*watcher]bool)
+)
+
+// watching reports whether there is anyone to publish queries to.
+func watching() bool {
+	watchersMu.Lock()
+	defer watchersMu.Unlock()
+	return len(watchers) > 0
+}
+
+// publishQuery sends a query to the WatchQueries streams that want it. asked
+// is the query as it arrived, and named the one with the option labels and
+// session token taken out.
+func publishQuery(rw *responseWriter, asked, named *dns.Msg, start time.Time, elapsed time.Duration) {
+	r := newQueryRecord(rw, named, start, elapsed)
+	event := &QueryEvent{
+		Time:      timestamppb.New(r.Time),
+		Client:    r.Client,
+		Transport: r.Transport,
+		Name:      r.Name,
+		Type:      r.Type,
+		Handler:   r.Handler,
+		Rcode:     r.Rcode,
+		Elapsed:   durationpb.New(elapsed),
+	}
+	if rw.session != nil {
+		event.Session = rw.session.token
+	}
+	if wire, err := asked.Pack(); err == nil {
+		event.Query = wire
+	}
+	for _, write := range rw.written {
+		event.Responses = append(event.Responses, write.wire)
+	}
+
+	watchersMu.Lock()
+	defer watchersMu.Unlock()
+	for w := range watchers {
+		if w.name != "" && !dns.IsSubDomain(w.name, strings.ToLower(r.Name)) {
+			continue
+		}
+		if w.session != "" && w.session != event.Session {
+			continue
+		}
+		select {
+		case w.events <- event:
+		default:
+		}
+	}
+}
+
+// serveGRPC runs the control service on addr.
+func serveGRPC(addr string) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	s := grpc.NewServer()
+	RegisterControlServer(s, controlServer{})
+	return s.Serve(l)
+}
+
+// controlServer implements the Control service on top of the same functions
+// as the admin API.
+type controlServer struct {
+	UnimplementedControlServer
+}
+
+func (controlServer) WatchQueries(req *WatchQueriesRequest, stream grpc.ServerStreamingServer[QueryEvent]) error {
+	w := &watcher{
+		session: strings.ToLower(req.Session),
+		events:  make(chan *QueryEvent, watcherBacklog),
+	}
+	if req.Name != "" {
+		w.name = dns.Fqdn(strings.ToLower(req.Name))
+	}
+	watchersMu.Lock()
+	watchers[w] = true
+	watchersMu.Unlock()
+	defer func() {
+		watchersMu.Lock()
+		delete(watchers, w)
+		watchersMu.Unlock()
+	}()
+	for {
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case event := <-w.events:
+			if err := stream.Send(event); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func (controlServer) ListRevokedGhosts(context.Context, *ListRevokedGhostsRequest) (*ListRevokedGhostsResponse, error) {
+	return &ListRevokedGhostsResponse{Zones: revokedGhosts()}, nil
+}
+
+func (controlServer) SetGhostRevoked(_ context.Context, req *SetGhostRevokedRequest) (*SetGhostRevokedResponse, error) {
+	child := strings.ToLower(req.Zone)
+	if child == "" || strings.Contains(child, ".") {
+		return nil, status.Error(codes.InvalidArgument, "zone must be a single label")
+	}
+	setGhostRevoked(child, req.Revoked)
+	return &SetGhostRevokedResponse{}, nil
+}
+
+func (controlServer) GetStats(context.Context, *GetStatsRequest) (*Stats, error) {
+	statsMu.Lock()
+	defer statsMu.Unlock()
+	stats := &Stats{
+		HistogramBoundsMs: histogramBounds,
+		Handlers:          usageMessages(handlerStats),
+		Asns:              make(map[string]*HandlerUsage),
+	}
+	for asn, handlers := range asnStats {
+		stats.Asns[asn] = &HandlerUsage{Handlers: usageMessages(handlers)}
+	}
+	stats.Quarantine = make(map[string]*Quarantine)
+	for name, r := range quarantineSnapshot() {
+		stats.Quarantine[name] = &Quarantine{
+			Panics:    uint64(r.Panics),
+			LastPanic: r.LastPanic,
+			LastAt:    timestamppb.New(r.LastAt),
+			Disabled:  r.Disabled,
+		}
+	}
+	return stats, nil
+}
+
+// usageMessages converts usage by handler, which must be locked, for gRPC.
+func usageMessages(handlers map[string]*usage) map[string]*Usage {
+	m := make(map[string]*Usage)
+	for handler, u := range handlers {
+		m[handler] = &Usage{
+			Queries:   u.Queries,
+			Retries:   u.Retries,
+			Histogram: append([]uint64(nil), u.Histogram...),
+		}
+	}
+	return m
+}
+
+func (controlServer) ListOverrides(context.Context, *ListOverridesRequest) (*ListOverridesResponse, error) {
+	resp := &ListOverridesResponse{}
+	for _, o := range liveOverrides() {
+		resp.Overrides = append(resp.Overrides, overrideMessage(o))
+	}
+	return resp, nil
+}
+
+func (controlServer) SetOverride(_ context.Context, req *SetOverrideRequest) (*Override, error) {
+	match, err := parseOverrideMatch(req.Match)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	ttl := overrideDefaultTTL
+	if req.Ttl != nil {
+		if ttl = req.Ttl.AsDuration(); ttl <= 0 {
+			return nil, status.Error(codes.InvalidArgument, "ttl must be positive")
+		}
+	}
+	o, err := setOverride(match, req.Behavior, ttl)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	return overrideMessage(o), nil
+}
+
+func overrideMessage(o override) *Override {
+	return &Override{Match: o.match, Behavior: o.name, Expires: timestamppb.New(o.expires)}
+}
+
+func (controlServer) ClearOverride(_ context.Context, req *ClearOverrideRequest) (*ClearOverrideResponse, error) {
+	match, err := parseOverrideMatch(req.Match)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	clearOverride(match)
+	return &ClearOverrideResponse{}, nil
+}
+
+func (controlServer) CreateSession(_ context.Context, req *CreateSessionRequest) (*Session, error) {
+	ttl := sessionDefaultTTL
+	if req.Ttl != nil {
+		if ttl = req.Ttl.AsDuration(); ttl <= 0 {
+			return nil, status.Error(codes.InvalidArgument, "ttl must be positive")
+		}
+	}
+	s := newSession(ttl)
+	return &Session{
+		Token:   s.token,
+		Created: timestamppb.New(s.created),
+		Expires: timestamppb.New(s.expires),
+	}, nil
+}
+
+func (controlServer) GetSession(_ context.Context, req *GetSessionRequest) (*Session, error) {
+	s := knownSession(strings.ToLower(req.Token))
+	if s == nil {
+		return nil, status.Error(codes.NotFound, "no such session")
+	}
+	sessionsMu.Lock()
+	defer sessionsMu.Unlock()
+	resp := &Session{
+		Token:            s.token,
+		Created:          timestamppb.New(s.created),
+		Expires:          timestamppb.New(s.expires),
+		Handlers:         usageMessages(s.stats),
+		QueriesNotLogged: uint64(s.dropped),
+	}
+	for _, r := range s.queries {
+		resp.Queries = append(resp.Queries, &QueryEvent{
+			Time:      timestamppb.New(r.Time),
+			Client:    r.Client,
+			Transport: r.Transport,
+			Name:      r.Name,
+			Type:      r.Type,
+			Handler:   r.Handler,
+			Rcode:     r.Rcode,
+			Elapsed:   durationpb.New(time.Duration(r.ElapsedMS * float64(time.Millisecond))),
+			Session:   s.token,
+		})
+	}
+	return resp, nil
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"encoding/binary"
+	"log"
+	"strconv"
+
+	"github.com/miekg/dns"
+)
+
+// interleaveHandler serves names of the form [<n>.]interleave.<base> over TCP
+// like a broken proxy multiplexing two responses onto one connection: it
+// frames a healthy answer and a SERVFAIL for the next message ID each with
+// their length prefix, and sends them interleaved, n bytes at a time
+// (default 1). The client can't make sense of either, and should drop the
+// connection rather than accept a mix of the two. Over UDP the response is
+// empty and truncated, sending the client to TCP.
+func interleaveHandler(w dns.ResponseWriter, q *dns.Msg) {
+	logQuery(w, q, "interleaveHandler")
+	chunk := 1
+	if labels := subLabels(qname(q), zone("interleave")); len(labels) > 0 {
+		if n, err := strconv.ParseUint(labels[len(labels)-1], 10, 16); err == nil && n > 0 {
+			chunk = int(n)
+		}
+	}
+	m := new(dns.Msg)
+	m.SetRcode(q, dns.RcodeSuccess)
+	conn := tcpConnFor(w)
+	if conn == nil {
+		m.Truncated = true
+		w.WriteMsg(m)
+		return
+	}
+	healthyAnswer(m, q, zone("interleave"))
+	other := new(dns.Msg)
+	other.SetRcode(q, dns.RcodeServerFailure)
+	other.Id = q.Id + 1
+
+	var framed [2][]byte
+	for i, msg := range []*dns.Msg{m, other} {
+		wire, err := packed(w, msg)
+		if err != nil {
+			log.Printf("packing response: %s", err)
+			return
+		}
+		framed[i] = append(binary.BigEndian.AppendUint16(nil, uint16(len(wire))), wire...)
+	}
+	var out []byte
+	a, b := framed[0], framed[1]
+	for len(a) > 0 || len(b) > 0 {
+		n := min(chunk, len(a))
+		out, a = append(out, a[:n]...), a[n:]
+		n = min(chunk, len(b))
+		out, b = append(out, b[:n]...), b[n:]
+	}
+	if _, err := conn.Write(out); err != nil {
+		log.Printf("writing interleaved responses: %s", err)
+	}
+	w.Close()
+}
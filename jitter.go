@@ -0,0 +1,182 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"math/rand/v2"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var acceptDelay = flag.String("accept-delay", "0", "delay before anything is read from a new TCP, DoT or DoH connection, as a duration or a min-max range to pick from at random, e.g. 200ms-2s. The kernel completes the TCP handshake regardless, so this is seen as a connection that stays silent.")
+var tlsHandshakeDelay = flag.String("tls-handshake-delay", "0", "delay before each TLS handshake record sent on DoT and DoH connections, as a duration or a min-max range.")
+
+// A delayRange is a range of durations to pick delays from.
+type delayRange struct {
+	min, max time.Duration
+}
+
+// Parsed values of -accept-delay and -tls-handshake-delay.
+var acceptDelays, handshakeDelays delayRange
+
+// parseDelayRange parses a duration or a min-max range of durations.
+func parseDelayRange(s string) (delayRange, error) {
+	lo, hi, isRange := strings.Cut(s, "-")
+	min, err := time.ParseDuration(lo)
+	if err != nil {
+		return delayRange{}, err
+	}
+	max := min
+	if isRange {
+		if max, err = time.ParseDuration(hi); err != nil {
+			return delayRange{}, err
+		}
+	}
+	if min < 0 || max < min {
+		return delayRange{}, fmt.Errorf("bad delay range %q", s)
+	}
+	return delayRange{min, max}, nil
+}
+
+// parseJitterFlags sets acceptDelays and handshakeDelays from the flags.
+func parseJitterFlags() error {
+	var err error
+	if acceptDelays, err = parseDelayRange(*acceptDelay); err != nil {
+		return fmt.Errorf("-accept-delay: %s", err)
+	}
+	if handshakeDelays, err = parseDelayRange(*tlsHandshakeDelay); err != nil {
+		return fmt.Errorf("-tls-handshake-delay: %s", err)
+	}
+	return nil
+}
+
+// pick returns a delay from the range.
+func (d delayRange) pick() time.Duration {
+	if d.max == d.min {
+		return d.min
+	}
+	return d.min + rand.N(d.max-d.min)
+}
+
+// A latencyTarget is a distribution of response delays given by three of
+// its percentiles.
+type latencyTarget struct {
+	p50, p95, p99 time.Duration
+}
+
+// parseLatency parses a distribution written as p50-p95-p99, in
+// milliseconds. The empty string is a distribution that is always zero.
+func parseLatency(s string) (latencyTarget, error) {
+	if s == "" {
+		return latencyTarget{}, nil
+	}
+	parts := strings.Split(s, "-")
+	if len(parts) != 3 {
+		return latencyTarget{}, fmt.Errorf("latency %q is not of the form p50-p95-p99", s)
+	}
+	var ms [3]time.Duration
+	for i, part := range parts {
+		n, err := strconv.ParseUint(part, 10, 32)
+		if err != nil {
+			return latencyTarget{}, fmt.Errorf("bad latency %q", s)
+		}
+		ms[i] = time.Duration(n) * time.Millisecond
+	}
+	if ms[0] > ms[1] || ms[1] > ms[2] {
+		return latencyTarget{}, fmt.Errorf("latency %q is not increasing", s)
+	}
+	return latencyTarget{ms[0], ms[1], ms[2]}, nil
+}
+
+// sample picks a delay from the distribution. Its quantile function is
+// linear between the given percentiles, from zero at the bottom, and up to
+// twice p99 at the top.
+func (l latencyTarget) sample() time.Duration {
+	points := []struct {
+		q float64
+		d time.Duration
+	}{{0, 0}, {0.50, l.p50}, {0.95, l.p95}, {0.99, l.p99}, {1, 2 * l.p99}}
+	u := rand.Float64()
+	for i := 1; i < len(points); i++ {
+		lo, hi := points[i-1], points[i]
+		if u <= hi.q {
+			return lo.d + time.Duration((u-lo.q)/(hi.q-lo.q)*float64(hi.d-lo.d))
+		}
+	}
+	return 2 * l.p99
+}
+
+// listenTCP listens on addr for a TCP based transport, applying the accept
+// and handshake delays to the connections. For transports without TLS, the
+// handshake delay never kicks in.
+func listenTCP(addr string) (net.Listener, error) {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	return jitterListener{l}, nil
+}
+
+type jitterListener struct {
+	net.Listener
+}
+
+func (l jitterListener) Accept() (net.Conn, error) {
+	c, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return &jitterConn{Conn: c}, nil
+}
+
+// A jitterConn delays its first read by an accept delay, and each TLS
+// handshake record it writes by a handshake delay.
+type jitterConn struct {
+	net.Conn
+	once sync.Once
+}
+
+// NetConn returns the connection c wraps.
+func (c *jitterConn) NetConn() net.Conn {
+	return c.Conn
+}
+
+func (c *jitterConn) Read(b []byte) (int, error) {
+	c.once.Do(func() {
+		time.Sleep(acceptDelays.pick())
+	})
+	return c.Conn.Read(b)
+}
+
+// TLS record content types.
+const (
+	tlsChangeCipherSpec = 20
+	tlsHandshake        = 22
+)
+
+// Write sends writes that start with a TLS handshake flight one record at a
+// time, sleeping before each. Anything else, including application data, is
+// sent as is.
+func (c *jitterConn) Write(b []byte) (int, error) {
+	if handshakeDelays.max == 0 || len(b) == 0 || (b[0] != tlsHandshake && b[0] != tlsChangeCipherSpec) {
+		return c.Conn.Write(b)
+	}
+	written := 0
+	for len(b) > 0 {
+		n := len(b)
+		if len(b) >= 5 {
+			n = min(5+(int(b[3])<<8|int(b[4])), len(b))
+		}
+		time.Sleep(handshakeDelays.pick())
+		m, err := c.Conn.Write(b[:n])
+		written += m
+		if err != nil {
+			return written, err
+		}
+		b = b[n:]
+	}
+	return written, nil
+}
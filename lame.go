@@ -0,0 +1,76 @@
+package main
+
+import (
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// Under lame.<base>, as under ghost.<base>, the label directly below lame
+// names a child zone, and this process plays both the parent and the child.
+// The parent hands out a proper referral, but the child is lame: it doesn't
+// consider itself authoritative, and answers the queries for its zone in the
+// way the label says:
+//
+//	refused   REFUSED
+//	servfail  SERVFAIL
+//	upward    a referral to the root, as old BIND versions used to send
+//	noaa      the right answer, but without the AA bit
+//
+// A client is talking to the child for lameParentTTL after being referred to
+// it, so a resolver that retries elsewhere and comes back is sent the
+// referral again.
+
+// lameParentTTL is the TTL of the parent's delegations.
+const lameParentTTL = 60 * time.Second
+
+// lameReferrals remembers when each client was last referred to each child
+// zone.
+var lameReferrals = newCounters("lame")
+
+// lameHandler serves lame.<base> and all the child zones under it.
+func lameHandler(w dns.ResponseWriter, q *dns.Msg) {
+	logQuery(w, q, "lameHandler")
+	labels := subLabels(qname(q), zone("lame"))
+	if len(labels) == 0 {
+		txtError(w, q, "query a name under <variant>.lame.<base> with variant refused, servfail, upward or noaa")
+		return
+	}
+	child := strings.ToLower(labels[len(labels)-1])
+	switch child {
+	case "refused", "servfail", "upward", "noaa":
+	default:
+		txtError(w, q, "unknown variant "+child)
+		return
+	}
+	childZone := child + "." + zone("lame")
+	key := clientIP(w) + "|" + child
+	m := new(dns.Msg)
+	m.SetRcode(q, dns.RcodeSuccess)
+
+	if _, ok := lameReferrals.get(key); !ok {
+		lameReferrals.set(key, 1, lameParentTTL)
+		m.Ns, m.Extra = delegation(childZone, uint32(lameParentTTL/time.Second))
+		w.WriteMsg(m)
+		return
+	}
+
+	switch child {
+	case "refused":
+		m.Rcode = dns.RcodeRefused
+	case "servfail":
+		m.Rcode = dns.RcodeServerFailure
+	case "upward":
+		for _, server := range []string{"a", "b", "c"} {
+			m.Ns = append(m.Ns, &dns.NS{
+				Hdr: dns.RR_Header{Name: ".", Rrtype: dns.TypeNS, Class: dns.ClassINET, Ttl: 518400},
+				Ns:  server + ".root-servers.net.",
+			})
+		}
+	case "noaa":
+		healthyAnswer(m, q, childZone)
+		m.Authoritative = false
+	}
+	w.WriteMsg(m)
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// malformedKinds describe the ways malformed.<base> breaks its responses.
+var malformedKinds = map[string]string{
+	"truncheader": "the message ends in the middle of the header",
+	"badlabel":    "a label in the answer claims to be 63 bytes long, running into what follows",
+	"labeltype":   "a label in the answer has the reserved extended label type 01",
+	"badrdlen":    "the answer's RDLENGTH runs far past the end of the message",
+	"counts":      "the header claims 5 answers, but there is only one",
+	"trailing":    "a valid message followed by 16 bytes of garbage",
+	"empty":       "no bytes at all",
+}
+
+// malformedHandler serves names of the form <kind>.malformed.<base>. It packs
+// an answer with an A record for the name, whatever the query type, breaks
+// it as described in malformedKinds, and writes the bytes out as they are.
+// Clients must reject the response, and not crash or hang doing so.
+func malformedHandler(w dns.ResponseWriter, q *dns.Msg) {
+	logQuery(w, q, "malformedHandler")
+	name := qname(q)
+	labels := subLabels(name, zone("malformed"))
+	var kind string
+	if len(labels) > 0 {
+		kind = strings.ToLower(labels[len(labels)-1])
+	}
+	if _, ok := malformedKinds[kind]; !ok {
+		var kinds []string
+		for k := range malformedKinds {
+			kinds = append(kinds, k)
+		}
+		sort.Strings(kinds)
+		txtError(w, q, "query <kind>.malformed.<base> with kind one of "+strings.Join(kinds, ", "))
+		return
+	}
+	m := new(dns.Msg)
+	m.SetRcode(q, dns.RcodeSuccess)
+	m.Authoritative = true
+	m.Answer = []dns.RR{aRecord(name)}
+	wire, err := m.Pack()
+	if err != nil {
+		log.Printf("packing response: %s", err)
+		return
+	}
+	// Without compression the answer's owner name is packed in full, right
+	// after the question.
+	owner := 12 + len(packName(name)) + 4
+	rdlen := owner + len(packName(name)) + 8
+	switch kind {
+	case "truncheader":
+		wire = wire[:7]
+	case "badlabel":
+		wire[owner] = 63
+	case "labeltype":
+		wire[owner] |= 0x40
+	case "badrdlen":
+		wire[rdlen], wire[rdlen+1] = 0xff, 0xf0
+	case "counts":
+		wire[6], wire[7] = 0, 5
+	case "trailing":
+		wire = append(wire, []byte(strings.Repeat("\xff", 16))...)
+	case "empty":
+		wire = nil
+	}
+	if _, err := w.Write(wire); err != nil {
+		log.Printf("writing malformed response: %s", err)
+	}
+}
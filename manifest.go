@@ -0,0 +1,268 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+
+	"gopkg.in/yaml.v3"
+)
+
+// The manifest describes every behavior in a form conformance suites can
+// iterate over, without scraping the documentation. It is printed by
+// running "awful [flags] manifest [-format yaml]". Whenever a handler is
+// added or its grammar changes, its entry here has to follow.
+
+// A behaviorEntry describes one handler.
+type behaviorEntry struct {
+	// Zone is the label the handler is registered on under -base.
+	Zone string `json:"zone" yaml:"zone"`
+	// Grammar is the form of the names it serves, relative to <base>.
+	Grammar string `json:"grammar" yaml:"grammar"`
+	// Parameters describe the variable parts of Grammar.
+	Parameters map[string]string `json:"parameters,omitempty" yaml:"parameters,omitempty"`
+	// Outcome is what a correct resolver should make of the responses.
+	Outcome string `json:"outcome" yaml:"outcome"`
+	// Lab is set for handlers that only work with -lab.
+	Lab bool `json:"lab,omitempty" yaml:"lab,omitempty"`
+	// Stateful is set for handlers whose answers depend on earlier queries.
+	Stateful bool `json:"stateful,omitempty" yaml:"stateful,omitempty"`
+}
+
+// An optionEntry describes one option label.
+type optionEntry struct {
+	Label   string `json:"label" yaml:"label"`
+	Flag    string `json:"flag" yaml:"flag"`
+	Meaning string `json:"meaning" yaml:"meaning"`
+}
+
+var manifestBehaviors = []behaviorEntry{
+	{Zone: "cnamepit", Grammar: "<anything>.cnamepit.<base>",
+		Outcome: "endless CNAME chain; resolver gives up with SERVFAIL after its chain limit"},
+	{Zone: "manycuts", Grammar: "<anything>[.<depth>].manycuts.<base>",
+		Parameters: map[string]string{"depth": "number of delegations, each to a name server under depth-1, before the name server's address is answered; endless without it"},
+		Outcome:    "resolver gives up with SERVFAIL after its delegation limit; the name server is found if depth is within it"},
+	{Zone: "sleep", Grammar: "<ms>.sleep.<base>",
+		Parameters: map[string]string{"ms": "milliseconds to wait before an empty NOERROR answer"},
+		Outcome:    "NODATA, or a timeout if ms exceeds the resolver's patience"},
+	{Zone: "preset", Grammar: "<anything>.<preset>.preset.<base>",
+		Parameters: map[string]string{"preset": "pre-edns, v4-only-lb, nxdomain-aaaa, tc-txt or kitchen-sink"},
+		Outcome:    "answers despite the quirks of the preset, or the failure they force"},
+	{Zone: "matrix", Grammar: "<anything>.matrix.<base>",
+		Outcome: "healthy answers, each qtype delayed as set with -matrix-delays"},
+	{Zone: "splitudp", Grammar: "<anything>.splitudp.<base>",
+		Outcome: "neither half of the split response parses; timeout, then SERVFAIL"},
+	{Zone: "wrongport", Grammar: "[<port>.]wrongport.<base>", Lab: true,
+		Parameters: map[string]string{"port": "UDP port to send the response to instead"},
+		Outcome:    "response to the wrong port is ignored; timeout"},
+	{Zone: "stalens", Grammar: "<anything>.stalens.<base>", Stateful: true,
+		Outcome: "answers, while the NS RRset changes on every response"},
+	{Zone: "ghost", Grammar: "<anything>.<zone>.ghost.<base>", Stateful: true,
+		Parameters: map[string]string{"zone": "child zone, whose delegation can be revoked through the admin API"},
+		Outcome:    "NXDOMAIN once the delegation is revoked and the parent's NS TTL has passed"},
+	{Zone: "entbug", Grammar: "[a.[b.[c.]]]entbug.<base>",
+		Outcome: "a.b.c.entbug.<base> answers, but its empty non-terminals are NXDOMAIN"},
+	{Zone: "crossdup", Grammar: "<anything>.crossdup.<base>", Lab: true,
+		Outcome: "TCP answer accepted; the UDP copy sent to port 53 is ignored"},
+	{Zone: "adaptive", Grammar: "<anything>.adaptive.<base>", Stateful: true,
+		Outcome: "each retry gets a nastier behavior; how far the resolver goes is logged"},
+	{Zone: "ttlskew", Grammar: "<anything>.<parent>-<child>.ttlskew.<base>", Stateful: true,
+		Parameters: map[string]string{"parent": "NS TTL in the parent's referral", "child": "NS TTL in the child's answers"},
+		Outcome:    "answers; the delegation is cached for the TTL the resolver prefers"},
+	{Zone: "occluded", Grammar: "<anything>.<cut>.occluded.<base>",
+		Parameters: map[string]string{"cut": "child zone the parent delegates"},
+		Outcome:    "the answer below the cut is not trusted; the referral is followed"},
+	{Zone: "disagree", Grammar: "<anything>.<child>.disagree.<base>", Stateful: true,
+		Outcome: "answers; parent NS p1/p2 and child NS c1/c2 differ"},
+	{Zone: "infwild", Grammar: "<anything>[.t<ttl>][.s<size>].infwild.<base>",
+		Parameters: map[string]string{"ttl": "TTL in seconds", "size": "bytes of RDATA per answer"},
+		Outcome:    "a distinct answer for every name"},
+	{Zone: "giant", Grammar: "<size>.giant.<base>",
+		Parameters: map[string]string{"size": "max (65535 bytes) or over (65536 bytes)"},
+		Outcome:    "max is accepted over TCP; over cannot be framed and fails"},
+	{Zone: "lenbug", Grammar: "<anything>[.l<length>][.<failure>].lenbug.<base>",
+		Parameters: map[string]string{"length": "wire length of the names that fail", "failure": "formerr, servfail, refused or drop"},
+		Outcome:    "names of that exact length fail, all others answer"},
+	{Zone: "encode", Grammar: "<data>.<encoding>.encode.<base>",
+		Parameters: map[string]string{"data": "RDATA, possibly over several labels", "encoding": "hex or b32"},
+		Outcome:    "one record of the query type with exactly the decoded RDATA, valid or not"},
+	{Zone: "wrongclass", Grammar: "<anything>[.<class>][.mixed].wrongclass.<base>",
+		Parameters: map[string]string{"class": "ch, hs, none or c<N>", "mixed": "also include the records in the right class"},
+		Outcome:    "records in the wrong class are discarded"},
+	{Zone: "ns", Grammar: "ns.<base>",
+		Outcome: "healthy answers"},
+	{Zone: "scenario", Grammar: "<anything>.<scenario>.scenario.<base>", Stateful: true,
+		Parameters: map[string]string{"scenario": "a scenario from -scenarios"},
+		Outcome:    "each query for a name gets the next step of the scenario"},
+	{Zone: "nthtry", Grammar: "<anything>.<n>.nthtry.<base>", Stateful: true,
+		Parameters: map[string]string{"n": "attempt from which queries are answered"},
+		Outcome:    "answers if the resolver makes at least n attempts"},
+	{Zone: "ednsdiff", Grammar: "<anything>.ednsdiff.<base>",
+		Outcome: "192.0.2.1, 2001:db8::1 and \"edns\" if asked with EDNS, other answers without"},
+	{Zone: "qps", Grammar: "<anything>.qps.<base>",
+		Outcome: "TXT with the query rate seen from the resolver's address"},
+	{Zone: "signed", Grammar: "<anything>[.tobogus|.bogus|.unordered|.infwild].signed.<base>",
+		Outcome: "secure with the logged trust anchor, including the RRsets under unordered.signed.<base> served out of canonical order and the distinct answers under infwild.signed.<base>; bogus under bogus.signed.<base>"},
+	{Zone: "expiredrrsig", Grammar: "<anything>.expiredrrsig.<base>",
+		Outcome: "bogus with the logged trust anchor, as every signature has expired; SERVFAIL"},
+	{Zone: "badsig", Grammar: "<anything>.badsig.<base>",
+		Outcome: "bogus with the logged trust anchor, as no signature verifies; SERVFAIL"},
+	{Zone: "nods", Grammar: "<anything>.nods.<base>",
+		Outcome: "bogus with the logged trust anchor, as the DS matches no DNSKEY; SERVFAIL"},
+	{Zone: "missingrrsig", Grammar: "<anything>.missingrrsig.<base>",
+		Outcome: "bogus with the logged trust anchor, as there are no signatures; SERVFAIL"},
+	{Zone: "denial", Grammar: "<anything>.<kind>.denial.<base>",
+		Parameters: map[string]string{"kind": "nsecmiss, nsec3iter, optout or bitmap"},
+		Outcome:    "with the logged trust anchor: bogus for nsecmiss and bitmap, insecure or bogus for nsec3iter, never secure for optout"},
+	{Zone: "crosssign", Grammar: "<anything>.<variant>.crosssign.<base>",
+		Parameters: map[string]string{"variant": "valid or bogus"},
+		Outcome:    "with the signed.<base> trust anchor: secure for valid, SERVFAIL for bogus"},
+	{Zone: "dots", Grammar: "<anything>.<variant>.dots.<base>",
+		Parameters: map[string]string{"variant": "root, escaped, double, notrail, mixed or target"},
+		Outcome:    "root, escaped and mixed are valid; double and notrail are malformed and must be rejected"},
+	{Zone: "ephemeral", Grammar: "[<anything>.]<id>.ephemeral.<base>", Stateful: true,
+		Parameters: map[string]string{"id": "name provisioned through the admin API"},
+		Outcome:    "each query for a name gets the next of the provisioned steps; NXDOMAIN once expired"},
+	{Zone: "migrate", Grammar: "<anything>.migrate.<base>", Stateful: true,
+		Outcome: "answers, while the NS set and TXT data switch between two providers every -migrate-period"},
+	{Zone: "blackhole", Grammar: "<anything>.blackhole.<base>",
+		Outcome: "no response; over TCP the connection stays open and silent. Timeout, then SERVFAIL"},
+	{Zone: "interleave", Grammar: "[<n>.]interleave.<base>",
+		Parameters: map[string]string{"n": "bytes of each response sent at a time"},
+		Outcome:    "over TCP, two responses interleaved n bytes at a time; the connection is dropped and neither is accepted"},
+	{Zone: "cnameloop", Grammar: "[<member>.]<n>.cnameloop.<base>",
+		Parameters: map[string]string{"n": "number of names in the loop", "member": "a, b, ... for the names after the first"},
+		Outcome:    "a closed loop of n CNAMEs; the loop is detected and SERVFAIL returned"},
+	{Zone: "truncate", Grammar: "<anything>[.partial][.notcp].truncate.<base>",
+		Parameters: map[string]string{"partial": "keep the answer section in the truncated response", "notcp": "hang up on the TCP retry"},
+		Outcome:    "retried over TCP and answered; SERVFAIL with notcp"},
+	{Zone: "nsanswer", Grammar: "<anything>.nsanswer.<base>",
+		Outcome: "an NS RRset for the name in the answer section of every response; not an answer for A queries"},
+	{Zone: "malformed", Grammar: "<kind>.malformed.<base>",
+		Parameters: map[string]string{"kind": "truncheader, badlabel, labeltype, badrdlen, counts, trailing or empty"},
+		Outcome:    "the response is rejected as malformed; timeout or SERVFAIL, never a crash or hang"},
+	{Zone: "cluster", Grammar: "<anything>.cluster.<base>",
+		Outcome: "answered by whichever cluster members are healthy; lame, slow and dead members are avoided"},
+	{Zone: "comploop", Grammar: "<kind>.comploop.<base>",
+		Parameters: map[string]string{"kind": "self, loop, question or forward"},
+		Outcome:    "the response is rejected as malformed; timeout or SERVFAIL, never a crash or hang"},
+	{Zone: "glueless", Grammar: "<anything>.<zone>.glueless.<base>", Stateful: true,
+		Parameters: map[string]string{"zone": "child zone, delegated without glue; a number N makes a chain of N glueless delegations"},
+		Outcome:    "answered after the resolver looks up the name servers' addresses; SERVFAIL if N exceeds its limit on such lookups"},
+	{Zone: "audit", Grammar: "[<page>.]<token>.audit.<base>", Stateful: true,
+		Parameters: map[string]string{"token": "session token", "page": "page of the query log, from 1; the summary if left out"},
+		Outcome:    "TXT records describing the session's queries"},
+	{Zone: "lame", Grammar: "<anything>.<variant>.lame.<base>", Stateful: true,
+		Parameters: map[string]string{"variant": "how the child server is lame: refused, servfail, upward or noaa"},
+		Outcome:    "the child server is marked lame and the resolver gives up with SERVFAIL"},
+	{Zone: "badid", Grammar: "<anything>[.late].badid.<base>",
+		Parameters: map[string]string{"late": "follow the response with the wrong ID with the right one"},
+		Outcome:    "the response with the wrong ID is dropped; timeout, or the late answer"},
+	{Zone: "multisoa", Grammar: "<anything>[.owners].multisoa.<base>",
+		Parameters: map[string]string{"owners": "give the second SOA a different owner"},
+		Outcome:    "NXDOMAIN, cached for at most the smaller negative TTL, or not at all"},
+	{Zone: "poison", Grammar: "<anything>.<section>.poison.<base>",
+		Parameters: map[string]string{"section": "section to inject records for www.example.org into: answer, authority or additional"},
+		Outcome:    "answered; the injected records are discarded, so www.example.org doesn't resolve to 192.0.2.66 and example.org isn't delegated here"},
+	{Zone: "selfcut", Grammar: "<anything>.selfcut[.signed].<base>", Stateful: true,
+		Parameters: map[string]string{"signed": "make the parent part of signed.<base>, with a signed DS in the referral"},
+		Outcome:    "the referral for the name itself is followed and the child's answer accepted; secure when signed"},
+	{Zone: "edns", Grammar: "<anything>.<behavior>.edns.<base>",
+		Parameters: map[string]string{"behavior": "how EDNS queries are mishandled: ignore, formerr, badversion or multiopt"},
+		Outcome:    "answered, after falling back to plain DNS where the EDNS response is unusable"},
+	{Zone: "badednsflags", Grammar: "<anything>.badednsflags.<base>",
+		Outcome: "answered; the must-be-zero EDNS flags and the unknown option are ignored"},
+	{Zone: "bigudp", Grammar: "[<anything>.]<size>.bigudp.<base>",
+		Parameters: map[string]string{"size": "size of the response in bytes; 1024 bytes over the query's buffer size if left out"},
+		Outcome:    "the response over the buffer size is dropped and the query retried, possibly over TCP, or the answer is accepted if reassembled"},
+	{Zone: "trickle", Grammar: "[<anything>.][<ms>.]trickle.<base>",
+		Parameters: map[string]string{"ms": "milliseconds to wait before each byte of the TCP response; 1000 if left out"},
+		Outcome:    "the client times out reading the TCP response, unless its timeout only covers reads that make no progress"},
+	{Zone: "tcpreset", Grammar: "<anything>.<variant>.tcpreset.<base>",
+		Parameters: map[string]string{"variant": "where the TCP connection is cut: partial and fin halfway through the response, with a RST and a FIN, early before it"},
+		Outcome:    "the partial response is discarded and the query fails or is retried; no answer is made of half a message"},
+	{Zone: "decrement", Grammar: "<anything>.decrement.<base>",
+		Outcome: "the first response's three records, with a TTL of 300; the duplicate with lower TTLs and a record less is ignored"},
+	{Zone: "dupes", Grammar: "[<anything>.][rcode.]<n>.dupes.<base>",
+		Parameters: map[string]string{"n": "number of copies of the UDP response, from 1 to 20; 2 if left out", "rcode": "make every copy after the first an NXDOMAIN"},
+		Outcome:    "the first copy is used and the others are dropped; the name still resolves with rcode"},
+	{Zone: "latereply", Grammar: "<anything>.<ms>.latereply.<base>", Stateful: true,
+		Parameters: map[string]string{"ms": "milliseconds the answer to the first attempt is held back"},
+		Outcome:    "the prompt answer to a retry; the late 198.51.100.1, 2001:db8::2 or \"late\" is ignored"},
+	{Zone: "flaky", Grammar: "[<anything>.][seed<n>.]<percent>.flaky.<base>", Stateful: true,
+		Parameters: map[string]string{"percent": "percentage of queries dropped", "n": "seed making the drops the same on every run"},
+		Outcome:    "answered after retries, unless percent is so high that the resolver runs out of them"},
+	{Zone: "parity", Grammar: "<anything>.parity.<base>",
+		Outcome: "either the even or the odd answer, whole, for as long as it is cached; never both"},
+	{Zone: "failfirst", Grammar: "<anything>.<n>[.servfail].failfirst.<base>", Stateful: true,
+		Parameters: map[string]string{"n": "number of attempts at each question that fail", "servfail": "fail them with SERVFAIL rather than dropping them"},
+		Outcome:    "answered if the resolver makes more than n attempts"},
+	{Zone: "rcode", Grammar: "[<anything>.]<rcode>.rcode.<base>",
+		Parameters: map[string]string{"rcode": "rcode to answer with, by name (e.g. servfail, badvers) or number up to 4095"},
+		Outcome:    "NOERROR and NXDOMAIN as given; SERVFAIL, or another try elsewhere, for the rest"},
+	{Zone: "report", Grammar: "_er.<qtype>.<qname>.<code>._er.report.<base>",
+		Parameters: map[string]string{"qtype": "type of the failed query, as a number", "qname": "name of the failed query", "code": "extended DNS error code of the failure"},
+		Outcome:    "the error report is logged and acknowledged with a TXT record"},
+	{Zone: "broken-but-monitored", Grammar: "<anything>[.<kind>].broken-but-monitored.<base>", Stateful: true,
+		Parameters: map[string]string{"kind": "badsig, expiredrrsig or missingrrsig; secure if left out"},
+		Outcome:    "bogus with the logged trust anchor, SERVFAIL, ideally with an error report to report.<base>; counted per kind on /monitored"},
+	{Zone: "inconsistent", Grammar: "[<anything>.][seed<n>.]inconsistent.<base>", Stateful: true,
+		Parameters: map[string]string{"n": "seed making the sequence of answers the same on every run"},
+		Outcome:    "a different address in 198.18.0.0/15, with a different TTL, for every A query that reaches the server"},
+	{Zone: "unlock", Grammar: "[<anything>|<token>].unlock.<base>", Stateful: true,
+		Parameters: map[string]string{"token": "token from the TXT record of any other name under unlock.<base>"},
+		Outcome:    "TXT queries get a token, and redeeming it unlocks the querying address for bigudp and dupes over UDP when -require-unlock is set"},
+	{Zone: "ttl", Grammar: "[<anything>.][nx.]<ttl>.ttl.<base>",
+		Parameters: map[string]string{"ttl": "TTL of every record in the response, from 0 to 4294967295", "nx": "answer NXDOMAIN, with the TTL on the SOA"},
+		Outcome:    "cached for ttl seconds, capped by the resolver; TTLs above 2147483647 treated as 0"},
+	{Zone: "wrongtype", Grammar: "[<anything>.][<type>.]wrongtype.<base>",
+		Parameters: map[string]string{"type": "type of the records in the answer: a, aaaa, srv, txt or type<N>; txt, or a for TXT queries, if left out"},
+		Outcome:    "NODATA, with the records of the wrong type ignored"},
+}
+
+var manifestOptions = []optionEntry{
+	{Label: "compress-<on|off|rdata>", Flag: "-compress", Meaning: "name compression of the response"},
+	{Label: "maxsize-<bytes>", Flag: "-max-size", Meaning: "truncate responses larger than this"},
+	{Label: "glue-<all|a|aaaa|none>", Flag: "-glue", Meaning: "address families of glue to include"},
+	{Label: "ttl-<seconds>", Flag: "-ttl", Meaning: "TTL of every record in the response"},
+	{Label: "latency-<p50>-<p95>-<p99>", Flag: "-latency", Meaning: "delay responses by this distribution, in milliseconds"},
+	{Label: "case-<any|refuse>", Flag: "-case", Meaning: "answer REFUSED to query names with upper case letters"},
+	{Label: "stripsig-[<type>-...][<percent>]", Flag: "-strip-rrsig", Meaning: "strip the RRSIGs covering these types, or all of them, from this percentage of responses"},
+	{Label: "expect-<off|edns|txt>", Flag: "-expect", Meaning: "annotate the response with the behavior's outcome, in an EDNS option or a TXT record"},
+}
+
+// expectedOutcome returns the outcome in the manifest entry for the handler
+// registered on zone, or "" if there is none.
+func expectedOutcome(zone string) string {
+	for _, b := range manifestBehaviors {
+		if b.Zone == zone {
+			return b.Outcome
+		}
+	}
+	return ""
+}
+
+// writeManifest writes the manifest to out. args are the command line
+// arguments following "manifest".
+func writeManifest(out io.Writer, args []string) error {
+	fs := flag.NewFlagSet("manifest", flag.ContinueOnError)
+	format := fs.String("format", "json", "json or yaml.")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	manifest := struct {
+		Base      string          `json:"base" yaml:"base"`
+		Behaviors []behaviorEntry `json:"behaviors" yaml:"behaviors"`
+		Options   []optionEntry   `json:"options" yaml:"options"`
+	}{*basename, manifestBehaviors, manifestOptions}
+	switch *format {
+	case "json":
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		return enc.Encode(manifest)
+	case "yaml":
+		return yaml.NewEncoder(out).Encode(manifest)
+	}
+	return fmt.Errorf("unknown manifest format %q", *format)
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+var migrateNS = flag.String("migrate-ns", "ns1,ns2;ns3,ns4", "the two NS sets migrate.<base> rotates between, separated by a semicolon, each a comma separated list of hosts. Hosts without a dot are below migrate.<base>.")
+var migratePeriod = flag.Duration("migrate-period", 5*time.Minute, "how long migrate.<base> serves each of the -migrate-ns sets before switching to the other.")
+
+// migrateSets holds the parsed value of -migrate-ns.
+var migrateSets [2][]string
+
+// parseMigrateNS sets migrateSets from the flags.
+func parseMigrateNS() error {
+	sets := strings.Split(*migrateNS, ";")
+	if len(sets) != 2 {
+		return fmt.Errorf("-migrate-ns: expected two NS sets separated by a semicolon, got %q", *migrateNS)
+	}
+	if *migratePeriod <= 0 {
+		return fmt.Errorf("-migrate-period must be positive")
+	}
+	for i, set := range sets {
+		migrateSets[i] = nil
+		for _, host := range strings.Split(set, ",") {
+			if host = strings.TrimSpace(host); host == "" {
+				continue
+			}
+			if !strings.Contains(strings.TrimSuffix(host, "."), ".") {
+				host += "." + zone("migrate")
+			}
+			migrateSets[i] = append(migrateSets[i], dns.Fqdn(strings.ToLower(host)))
+		}
+		if len(migrateSets[i]) == 0 {
+			return fmt.Errorf("-migrate-ns: NS set %d is empty", i+1)
+		}
+	}
+	return nil
+}
+
+// migrateHandler serves migrate.<base> as if it were halfway through moving
+// from one DNS provider to another, with the two not agreeing on anything.
+// Every -migrate-period it switches between the two NS sets of -migrate-ns,
+// which it serves at the apex and in the authority section of answers, and
+// between TXT records naming provider a or provider b. Glue is included for
+// the hosts below migrate.<base>, which all resolve to this server.
+func migrateHandler(w dns.ResponseWriter, q *dns.Msg) {
+	logQuery(w, q, "migrateHandler")
+	apex := zone("migrate")
+	name := qname(q)
+	current := int(time.Now().UnixNano()/int64(*migratePeriod)) % 2
+	var ns, extra []dns.RR
+	for _, host := range migrateSets[current] {
+		ns = append(ns, &dns.NS{
+			Hdr: dns.RR_Header{Name: apex, Rrtype: dns.TypeNS, Class: dns.ClassINET, Ttl: 300},
+			Ns:  host,
+		})
+		if dns.IsSubDomain(apex, host) {
+			extra = append(extra, glue(host)...)
+		}
+	}
+
+	m := new(dns.Msg)
+	m.SetRcode(q, dns.RcodeSuccess)
+	healthyAnswer(m, q, apex)
+	switch qtype := q.Question[0].Qtype; {
+	case qtype == dns.TypeNS && strings.EqualFold(name, apex):
+		m.Answer, m.Ns, m.Extra = ns, nil, extra
+	case qtype == dns.TypeTXT:
+		m.Answer[0].(*dns.TXT).Txt = []string{"served by provider " + string(rune('a'+current))}
+		m.Ns, m.Extra = ns, extra
+	case len(m.Answer) > 0:
+		m.Ns, m.Extra = ns, extra
+	}
+	w.WriteMsg(m)
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// broken-but-monitored.<base> is a signed zone, like those in signedZones,
+// in which names of the form <anything>.<kind>.broken-but-monitored.<base>
+// are deliberately bogus, broken the way the signed zone named kind is:
+// badsig, expiredrrsig or missingrrsig. Its answers always carry a
+// Report-Channel option naming report.<base>, whatever -report-channel says,
+// and the resolvers that are sent bogus data are followed: whether they ask
+// for the DNSKEY or DS records that validating the data takes, and whether
+// they report the failure. /monitored on the admin API sums that up per kind,
+// as the number of resolvers that reported the failure, that validated
+// without reporting, and that ignored the bogus data, never asking for
+// the keys to check it with.
+//
+// Like the signed zones, it only validates for resolvers given the trust
+// anchor logged at startup.
+
+// monitoredKinds are the ways names under broken-but-monitored.<base> can be
+// broken.
+var monitoredKinds = []string{"badsig", "expiredrrsig", "missingrrsig"}
+
+// monitoredMemory is how long what a resolver did is remembered after the
+// last time it did it. A resolver seen again after that counts again.
+const monitoredMemory = 24 * time.Hour
+
+// monitoredTotalsMemory is how long the totals per kind are kept. There are
+// only a few of them, so they may as well be kept for good.
+const monitoredTotalsMemory = 365 * 24 * time.Hour
+
+var (
+	// monitoredResolvers holds what each resolver did, under
+	// "<client>|keys" once it asked for the DNSKEY or DS records,
+	// "<client>|sent|<kind>" once it was sent bogus data of a kind, and
+	// "<client>|reported|<kind>" once it then reported it.
+	monitoredResolvers = newCounters("monitored")
+	// monitoredTotals counts the resolvers sent each kind, by what they did
+	// about it: reported, validated or ignored. As a resolver goes from one
+	// of those to another, "in|<what>|<kind>" is incremented for the new one
+	// and "out|<what>|<kind>" for the old one, and the number of resolvers
+	// is the difference.
+	monitoredTotals = newCounters("monitoredtotals")
+)
+
+// monitoredMove accounts for a resolver sent bogus data of kind going from
+// having done from to having done to. from is "" for one that was just sent
+// it.
+func monitoredMove(kind, from, to string) {
+	if from != "" {
+		monitoredTotals.incr("out|"+from+"|"+kind, monitoredTotalsMemory)
+	}
+	monitoredTotals.incr("in|"+to+"|"+kind, monitoredTotalsMemory)
+}
+
+// monitoredTotal returns the number of resolvers sent bogus data of kind that
+// did what.
+func monitoredTotal(kind, what string) int64 {
+	in, _ := monitoredTotals.get("in|" + what + "|" + kind)
+	out, _ := monitoredTotals.get("out|" + what + "|" + kind)
+	return max(in-out, 0)
+}
+
+// monitoredValidation returns what the resolver at client did with bogus
+// data it didn't report: validated it if it asked for the keys, ignored it if
+// not.
+func monitoredValidation(client string) string {
+	if _, ok := monitoredResolvers.get(client + "|keys"); ok {
+		return "validated"
+	}
+	return "ignored"
+}
+
+// monitoredKind returns the kind of breakage of name, which is under
+// broken-but-monitored.<base>, or "" if it isn't broken.
+func monitoredKind(name string) string {
+	labels := subLabels(name, zone("broken-but-monitored"))
+	if len(labels) < 2 {
+		return ""
+	}
+	kind := strings.ToLower(labels[len(labels)-1])
+	for _, k := range monitoredKinds {
+		if kind == k {
+			return kind
+		}
+	}
+	return ""
+}
+
+// recordMonitoredReport notes that client reported an error for name, if
+// name is under broken-but-monitored.<base> and client was sent bogus data
+// for it.
+func recordMonitoredReport(client, name string) {
+	if !dns.IsSubDomain(zone("broken-but-monitored"), name) {
+		return
+	}
+	kind := monitoredKind(name)
+	if kind == "" {
+		return
+	}
+	if _, ok := monitoredResolvers.get(client + "|sent|" + kind); !ok {
+		return
+	}
+	if monitoredResolvers.incr(client+"|reported|"+kind, monitoredMemory) == 1 {
+		monitoredMove(kind, monitoredValidation(client), "reported")
+	}
+}
+
+// monitoredHandler serves broken-but-monitored.<base>, as described above.
+func monitoredHandler(w dns.ResponseWriter, q *dns.Msg) {
+	logQuery(w, q, "monitoredHandler")
+	apex := zone("broken-but-monitored")
+	name := qname(q)
+	labels := subLabels(name, apex)
+	qtype := q.Question[0].Qtype
+	m := new(dns.Msg)
+	m.SetRcode(q, dns.RcodeSuccess)
+	m.Authoritative = true
+	do := false
+	if opt := q.IsEdns0(); opt != nil && opt.Do() {
+		do = true
+	}
+	kind := monitoredKind(name)
+
+	switch {
+	case len(labels) == 0 && qtype == dns.TypeDNSKEY:
+		m.Answer = []dns.RR{keyFor(zoneKey, apex)}
+	case len(labels) == 0 && qtype == dns.TypeDS:
+		m.Answer = []dns.RR{signedZoneDS(apex)}
+	case len(labels) == 0 && qtype == dns.TypeSOA:
+		m.Answer = []dns.RR{soaRecord(apex)}
+	default:
+		healthyAnswer(m, q, apex)
+	}
+	client := clientIP(w)
+	switch {
+	case len(labels) == 0 && (qtype == dns.TypeDNSKEY || qtype == dns.TypeDS):
+		if monitoredResolvers.incr(client+"|keys", monitoredMemory) > 1 {
+			break
+		}
+		for _, k := range monitoredKinds {
+			_, sent := monitoredResolvers.get(client + "|sent|" + k)
+			_, reported := monitoredResolvers.get(client + "|reported|" + k)
+			if sent && !reported {
+				monitoredMove(k, "ignored", "validated")
+			}
+		}
+	case kind != "" && len(m.Answer) > 0:
+		if monitoredResolvers.incr(client+"|sent|"+kind, monitoredMemory) == 1 {
+			monitoredMove(kind, "", monitoredValidation(client))
+		}
+	}
+
+	// The DS record is the parent's, which isn't signed.
+	if do && !(len(labels) == 0 && qtype == dns.TypeDS) {
+		if len(m.Answer) == 0 {
+			m.Ns = append(m.Ns, nodataNSEC(name, len(labels) == 0))
+		}
+		if kind != "missingrrsig" {
+			m.Answer = signSection(m.Answer, apex, kind)
+			m.Ns = signSection(m.Ns, apex, kind)
+		}
+		m.SetEdns0(1232, true)
+	}
+	w.WriteMsg(m)
+}
+
+// monitoredCounts are the number of resolvers sent bogus data of one kind,
+// by what they did about it.
+type monitoredCounts struct {
+	Resolvers int64 `json:"resolvers"`
+	Reported  int64 `json:"reported"`
+	Validated int64 `json:"validated"`
+	Ignored   int64 `json:"ignored"`
+}
+
+// monitoredAdminHandler exports monitoredCounts for each kind as JSON.
+func monitoredAdminHandler(w http.ResponseWriter, r *http.Request) {
+	counts := make(map[string]monitoredCounts)
+	for _, kind := range monitoredKinds {
+		c := monitoredCounts{
+			Reported:  monitoredTotal(kind, "reported"),
+			Validated: monitoredTotal(kind, "validated"),
+			Ignored:   monitoredTotal(kind, "ignored"),
+		}
+		c.Resolvers = c.Reported + c.Validated + c.Ignored
+		counts[kind] = c
+	}
+	body, err := json.MarshalIndent(counts, "", "  ")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(body)
+}
@@ -0,0 +1,273 @@
+package main
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/hkdf"
+	"crypto/hpke"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+
+	"github.com/miekg/dns"
+)
+
+// Oblivious DoH (RFC 9230) support. The DoH listener doubles as an ODoH
+// target, using a key generated at startup and published on
+// /.well-known/odohconfigs, and can optionally act as an ODoH relay too.
+
+var odohRelay = flag.Bool("odoh-relay", false, "also act as an Oblivious DoH relay on /proxy. This forwards requests to arbitrary hosts, so don't enable it on the public internet.")
+var odohQuirks = flag.String("odoh-quirks", "", "comma separated misbehaviors of the ODoH target: stale-config (publish a key we don't decrypt with), reject-key (answer 401 to every query), corrupt-response (flip a bit in the encrypted response), plaintext-response (answer unencrypted), wrong-content-type.")
+
+const (
+	odohVersion         = 0x0001
+	odohMessageQuery    = 0x01
+	odohMessageResponse = 0x02
+	odohContentType     = "application/oblivious-dns-message"
+
+	// We use DHKEM(X25519, HKDF-SHA256), HKDF-SHA256 and AES-128-GCM, the
+	// suite every ODoH implementation supports.
+	odohKEMID  = 0x0020
+	odohKDFID  = 0x0001
+	odohAEADID = 0x0001
+	odohNk     = 16
+	odohNn     = 12
+	odohNenc   = 32
+)
+
+// odohTarget is the key material of the ODoH target.
+type odohTarget struct {
+	key hpke.PrivateKey
+	// contents is the serialized ObliviousDoHConfigContents for key.
+	contents []byte
+	keyID    []byte
+	// published is the serialized ObliviousDoHConfigs we hand out. It only
+	// differs from what key can decrypt with the stale-config quirk.
+	published []byte
+}
+
+var odoh *odohTarget
+
+// newODoHTarget generates a fresh target key.
+func newODoHTarget() (*odohTarget, error) {
+	kem := hpke.DHKEM(ecdh.X25519())
+	key, err := kem.GenerateKey()
+	if err != nil {
+		return nil, err
+	}
+	t := &odohTarget{key: key}
+	t.contents = odohConfigContents(key.PublicKey().Bytes())
+	prk, err := hkdf.Extract(sha256.New, t.contents, nil)
+	if err != nil {
+		return nil, err
+	}
+	t.keyID, err = hkdf.Expand(sha256.New, prk, "odoh key id", sha256.Size)
+	if err != nil {
+		return nil, err
+	}
+	published := t.contents
+	if hasQuirk(*odohQuirks, "stale-config") {
+		other, err := kem.GenerateKey()
+		if err != nil {
+			return nil, err
+		}
+		published = odohConfigContents(other.PublicKey().Bytes())
+	}
+	var config []byte
+	config = binary.BigEndian.AppendUint16(config, odohVersion)
+	config = appendOpaque16(config, published)
+	t.published = appendOpaque16(nil, config)
+	return t, nil
+}
+
+func odohConfigContents(publicKey []byte) []byte {
+	var b []byte
+	b = binary.BigEndian.AppendUint16(b, odohKEMID)
+	b = binary.BigEndian.AppendUint16(b, odohKDFID)
+	b = binary.BigEndian.AppendUint16(b, odohAEADID)
+	return appendOpaque16(b, publicKey)
+}
+
+// appendOpaque16 appends data with a two byte length prefix.
+func appendOpaque16(b, data []byte) []byte {
+	b = binary.BigEndian.AppendUint16(b, uint16(len(data)))
+	return append(b, data...)
+}
+
+// readOpaque16 reads a value with a two byte length prefix from the front of
+// b, and returns it and whatever follows.
+func readOpaque16(b []byte) (data, rest []byte, err error) {
+	if len(b) < 2 {
+		return nil, nil, errors.New("truncated length")
+	}
+	n := int(binary.BigEndian.Uint16(b))
+	if len(b) < 2+n {
+		return nil, nil, errors.New("truncated value")
+	}
+	return b[2 : 2+n], b[2+n:], nil
+}
+
+// odohConfigsHandler publishes the target's ObliviousDoHConfigs.
+func odohConfigsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Write(odoh.published)
+}
+
+// odohQueryHandler answers an ODoH query that arrived in r.
+func odohQueryHandler(w http.ResponseWriter, r *http.Request) {
+	if !requirePost(w, r) {
+		return
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, 2*dns.MaxMsgSize))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if hasQuirk(*odohQuirks, "reject-key") {
+		http.Error(w, "unknown key", http.StatusUnauthorized)
+		return
+	}
+	response, status, err := odoh.answer(r, body)
+	if err != nil {
+		log.Printf("odoh query from %s: %s", r.RemoteAddr, err)
+		http.Error(w, err.Error(), status)
+		return
+	}
+	if hasQuirk(*odohQuirks, "wrong-content-type") {
+		w.Header().Set("Content-Type", "application/dns-message")
+	} else {
+		w.Header().Set("Content-Type", odohContentType)
+	}
+	w.Write(response)
+}
+
+// answer decrypts an ObliviousDoHMessage, runs the query through the
+// handlers and returns the encrypted response.
+func (t *odohTarget) answer(r *http.Request, body []byte) ([]byte, int, error) {
+	if len(body) < 1 || body[0] != odohMessageQuery {
+		return nil, http.StatusBadRequest, errors.New("not an ODoH query")
+	}
+	keyID, rest, err := readOpaque16(body[1:])
+	if err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+	encrypted, _, err := readOpaque16(rest)
+	if err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+	if !bytes.Equal(keyID, t.keyID) {
+		return nil, http.StatusUnauthorized, errors.New("unknown key id")
+	}
+	if len(encrypted) < odohNenc {
+		return nil, http.StatusBadRequest, errors.New("encrypted query too short")
+	}
+	recipient, err := hpke.NewRecipient(encrypted[:odohNenc], t.key,
+		hpke.HKDFSHA256(), hpke.AES128GCM(), []byte("odoh query"))
+	if err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+	aad := appendOpaque16([]byte{odohMessageQuery}, keyID)
+	plaintext, err := recipient.Open(aad, encrypted[odohNenc:])
+	if err != nil {
+		return nil, http.StatusBadRequest, fmt.Errorf("decrypting query: %s", err)
+	}
+	wire, _, err := readOpaque16(plaintext)
+	if err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+	q := new(dns.Msg)
+	if err := q.Unpack(wire); err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+
+	response, ok := serveHTTPQuery(r, q)
+	if !ok {
+		return nil, http.StatusGatewayTimeout, errors.New("no answer")
+	}
+	if hasQuirk(*odohQuirks, "plaintext-response") {
+		return response, http.StatusOK, nil
+	}
+
+	secret, err := recipient.Export("odoh response", odohNk)
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+	nonce := make([]byte, max(odohNn, odohNk))
+	rand.Read(nonce)
+	salt := appendOpaque16(append([]byte(nil), plaintext...), nonce)
+	prk, err := hkdf.Extract(sha256.New, secret, salt)
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+	key, err := hkdf.Expand(sha256.New, prk, "odoh key", odohNk)
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+	aeadNonce, err := hkdf.Expand(sha256.New, prk, "odoh nonce", odohNn)
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+	sealed, err := sealAESGCM(key, aeadNonce, appendOpaque16([]byte{odohMessageResponse}, nonce),
+		appendOpaque16(appendOpaque16(nil, response), nil))
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+	if hasQuirk(*odohQuirks, "corrupt-response") {
+		sealed[len(sealed)-1] ^= 1
+	}
+	out := appendOpaque16([]byte{odohMessageResponse}, nonce)
+	return appendOpaque16(out, sealed), http.StatusOK, nil
+}
+
+// odohRelayHandler forwards an ODoH query to the target given by the
+// targethost and targetpath parameters, as described in RFC 9230, section 5.
+func odohRelayHandler(w http.ResponseWriter, r *http.Request) {
+	if !requirePost(w, r) {
+		return
+	}
+	host, path := r.FormValue("targethost"), r.FormValue("targetpath")
+	if host == "" || path == "" {
+		http.Error(w, "need targethost and targetpath", http.StatusBadRequest)
+		return
+	}
+	target := url.URL{Scheme: "https", Host: host, Path: path}
+	req, err := http.NewRequestWithContext(r.Context(), http.MethodPost, target.String(),
+		io.LimitReader(r.Body, 2*dns.MaxMsgSize))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	req.Header.Set("Content-Type", odohContentType)
+	req.Header.Set("Accept", odohContentType)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	defer resp.Body.Close()
+	w.Header().Set("Content-Type", resp.Header.Get("Content-Type"))
+	w.WriteHeader(resp.StatusCode)
+	io.Copy(w, io.LimitReader(resp.Body, 2*dns.MaxMsgSize))
+}
+
+// sealAESGCM encrypts plaintext with AES-GCM.
+func sealAESGCM(key, nonce, aad, plaintext []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nil, nonce, plaintext, aad), nil
+}
@@ -0,0 +1,748 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"math/rand/v2"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// Option labels are labels of the form <key>-<value>, such as "compress-on",
+// that can appear anywhere to the left of a handler's zone. They change how
+// the response is put on the wire regardless of which handler produces it, so
+// any behavior can be combined with them. They are stripped from the query
+// before the handler sees it, and put back into the names in the response.
+//
+// Each option can also be set for all handlers with a flag, and per handler
+// with a flag of the form "handler=value,handler=value". Option labels take
+// precedence over per-handler flags, which take precedence over global ones.
+
+var compress = flag.String("compress", "off", "name compression for responses: on, off, or rdata (compress names in RDATA where that is forbidden).")
+var handlerCompress = flag.String("handler-compress", "", "per-handler overrides of -compress, e.g. cnamepit=on,manycuts=rdata.")
+var maxSize = flag.Int("max-size", 0, "maximum wire size of any response; larger ones are truncated and get TC set. 0 means no limit.")
+var handlerMaxSize = flag.String("handler-max-size", "", "per-handler overrides of -max-size, e.g. cnamepit=512.")
+var glueMode = flag.String("glue", "all", "address records to include for name servers in the additional section: all, a (leave out AAAA), aaaa (leave out A) or none.")
+var handlerGlue = flag.String("handler-glue", "", "per-handler overrides of -glue, e.g. manycuts=a.")
+var ttlOverride = flag.String("ttl", "", "TTL in seconds to give every record in responses, in place of the handler's own. Empty leaves TTLs alone.")
+var handlerTTL = flag.String("handler-ttl", "", "per-handler overrides of -ttl, e.g. ghost=5,stalens=86400.")
+var latency = flag.String("latency", "", "latency distribution to delay responses by, as p50-p95-p99 in milliseconds, e.g. 20-150-800. Empty means no delay.")
+var handlerLatency = flag.String("handler-latency", "", "per-handler overrides of -latency, e.g. matrix=5-20-100.")
+var stripRRSIG = flag.String("strip-rrsig", "", "RRSIGs to strip from responses, as dash separated types they cover and a percentage of responses to strip them from, e.g. dnskey-ds, a-50 or 30. Without types every RRSIG is stripped. Empty strips none.")
+var handlerStripRRSIG = flag.String("handler-strip-rrsig", "", "per-handler overrides of -strip-rrsig, e.g. signed=dnskey.")
+var caseMode = flag.String("case", "any", "how to treat query names with upper case letters: any (answer them) or refuse (answer REFUSED, like servers that break 0x20 encoding).")
+var handlerCase = flag.String("handler-case", "", "per-handler overrides of -case, e.g. matrix=refuse.")
+var expectMode = flag.String("expect", "off", "whether to annotate responses with what a correct resolver makes of them, as the manifest says: off, edns (in an EDNS option) or txt (in a TXT record at the end of the additional section).")
+var handlerExpect = flag.String("handler-expect", "", "per-handler overrides of -expect, e.g. cnamepit=txt.")
+
+// optionKeys are the keys that are recognized in option labels.
+var optionKeys = map[string]bool{
+	"compress": true,
+	"maxsize":  true,
+	"glue":     true,
+	"ttl":      true,
+	"latency":  true,
+	"stripsig": true,
+	"case":     true,
+	"expect":   true,
+}
+
+// perHandler holds the parsed values of the per-handler option flags, keyed
+// by option and then by handler name.
+var perHandler = make(map[string]map[string]string)
+
+// parseOptionFlags validates the option flags and fills in perHandler.
+func parseOptionFlags() error {
+	if err := validCompress(*compress); err != nil {
+		return err
+	}
+	values, err := parseHandlerValues(*handlerCompress)
+	if err != nil {
+		return err
+	}
+	for _, v := range values {
+		if err := validCompress(v); err != nil {
+			return err
+		}
+	}
+	perHandler["compress"] = values
+
+	values, err = parseHandlerValues(*handlerMaxSize)
+	if err != nil {
+		return err
+	}
+	for _, v := range values {
+		if _, err := strconv.ParseUint(v, 10, 16); err != nil {
+			return fmt.Errorf("bad maximum size %q", v)
+		}
+	}
+	perHandler["maxsize"] = values
+
+	if err := validGlue(*glueMode); err != nil {
+		return err
+	}
+	values, err = parseHandlerValues(*handlerGlue)
+	if err != nil {
+		return err
+	}
+	for _, v := range values {
+		if err := validGlue(v); err != nil {
+			return err
+		}
+	}
+	perHandler["glue"] = values
+
+	if err := validTTL(*ttlOverride); err != nil {
+		return err
+	}
+	values, err = parseHandlerValues(*handlerTTL)
+	if err != nil {
+		return err
+	}
+	for _, v := range values {
+		if err := validTTL(v); err != nil {
+			return err
+		}
+	}
+	perHandler["ttl"] = values
+
+	if _, err := parseLatency(*latency); err != nil {
+		return err
+	}
+	values, err = parseHandlerValues(*handlerLatency)
+	if err != nil {
+		return err
+	}
+	for _, v := range values {
+		if _, err := parseLatency(v); err != nil {
+			return err
+		}
+	}
+	perHandler["latency"] = values
+
+	if _, _, err := parseStripSig(*stripRRSIG); err != nil {
+		return err
+	}
+	values, err = parseHandlerValues(*handlerStripRRSIG)
+	if err != nil {
+		return err
+	}
+	for _, v := range values {
+		if _, _, err := parseStripSig(v); err != nil {
+			return err
+		}
+	}
+	perHandler["stripsig"] = values
+
+	if err := validCase(*caseMode); err != nil {
+		return err
+	}
+	values, err = parseHandlerValues(*handlerCase)
+	if err != nil {
+		return err
+	}
+	for _, v := range values {
+		if err := validCase(v); err != nil {
+			return err
+		}
+	}
+	perHandler["case"] = values
+
+	if err := validExpect(*expectMode); err != nil {
+		return err
+	}
+	values, err = parseHandlerValues(*handlerExpect)
+	if err != nil {
+		return err
+	}
+	for _, v := range values {
+		if err := validExpect(v); err != nil {
+			return err
+		}
+	}
+	perHandler["expect"] = values
+	return nil
+}
+
+func validCompress(mode string) error {
+	switch mode {
+	case "on", "off", "rdata":
+		return nil
+	}
+	return fmt.Errorf("unknown compression mode %q", mode)
+}
+
+func validGlue(mode string) error {
+	switch mode {
+	case "all", "a", "aaaa", "none":
+		return nil
+	}
+	return fmt.Errorf("unknown glue mode %q", mode)
+}
+
+func validCase(mode string) error {
+	switch mode {
+	case "any", "refuse":
+		return nil
+	}
+	return fmt.Errorf("unknown case mode %q", mode)
+}
+
+func validExpect(mode string) error {
+	switch mode {
+	case "off", "edns", "txt":
+		return nil
+	}
+	return fmt.Errorf("unknown expect mode %q", mode)
+}
+
+func validTTL(ttl string) error {
+	if ttl == "" {
+		return nil
+	}
+	if _, err := strconv.ParseUint(ttl, 10, 32); err != nil {
+		return fmt.Errorf("bad TTL %q", ttl)
+	}
+	return nil
+}
+
+// parseStripSig parses a value of the stripsig option into the types whose
+// RRSIGs are to be stripped, nil meaning all of them, and the percentage of
+// responses to strip them from.
+func parseStripSig(spec string) (types map[uint16]bool, percent int, err error) {
+	if spec == "" {
+		return nil, 0, nil
+	}
+	percent = 100
+	for _, item := range strings.Split(spec, "-") {
+		if n, err := strconv.Atoi(item); err == nil {
+			if n < 0 || n > 100 {
+				return nil, 0, fmt.Errorf("bad RRSIG stripping percentage %q", item)
+			}
+			percent = n
+			continue
+		}
+		rrtype, ok := dns.StringToType[strings.ToUpper(item)]
+		if !ok {
+			return nil, 0, fmt.Errorf("unknown type %q to strip RRSIGs of", item)
+		}
+		if types == nil {
+			types = make(map[uint16]bool)
+		}
+		types[rrtype] = true
+	}
+	return types, percent, nil
+}
+
+// parseHandlerValues parses a comma separated list of handler=value pairs.
+func parseHandlerValues(s string) (map[string]string, error) {
+	values := make(map[string]string)
+	for _, pair := range strings.Split(s, ",") {
+		if pair == "" {
+			continue
+		}
+		handler, value, ok := strings.Cut(pair, "=")
+		if !ok {
+			return nil, fmt.Errorf("malformed handler setting %q", pair)
+		}
+		values[handler] = value
+	}
+	return values, nil
+}
+
+// serveQuery is the entry point for every query. It pulls the option labels
+// and session token out of the query name, applies any override for the
+// client or else the behavior zone's assignment for the name, and hands the
+// query to the mux unless the -flap profile in effect says otherwise.
+// Afterwards it accounts for the query, publishes it to gRPC watchers and
+// calls any webhooks for the name.
+func serveQuery(w dns.ResponseWriter, q *dns.Msg) {
+	rw := &responseWriter{
+		ResponseWriter: w,
+		options:        make(map[string]string),
+	}
+	if len(q.Question) > 0 {
+		rw.asked = q.Question[0].Name
+	}
+	rw.edns = q.IsEdns0() != nil
+	start := time.Now()
+	countArrival(clientIP(w))
+	recordCapabilities(w, q)
+	if hangUp(w, q) {
+		return
+	}
+	asked := q
+	q = rw.extractOptions(q)
+	hooks := webhooksFor(qname(q))
+	watched := watching()
+	rw.capture = rw.session != nil || len(hooks) > 0 || watched
+	named := q
+	if name, ok := overrideFor(w, q); ok {
+		q = rw.serveAs(q, name)
+	} else if name, ok := behaviorFor(q); ok {
+		q = rw.serveAs(q, name)
+	}
+	q, ok := rw.flap(q)
+	if ok {
+		rw.delay(q)
+		mux.ServeDNS(rw, q)
+	}
+	elapsed := time.Since(start)
+	retry := recordQuery(clientIP(w), rw.handler, q, elapsed)
+	if rw.session != nil && rw.handler != "audit" {
+		rw.session.record(rw, asked, start, elapsed, retry)
+	}
+	if watched {
+		publishQuery(rw, asked, named, start, elapsed)
+	}
+	if len(hooks) > 0 {
+		body := webhookPayload(rw, named, start, elapsed)
+		for _, url := range hooks {
+			go notifyWebhook(url, body)
+		}
+	}
+}
+
+// A responseWriter applies the response options before handing a message to
+// the underlying ResponseWriter. Raw writes with Write are passed through
+// untouched, but recorded if the query is part of a session.
+type responseWriter struct {
+	dns.ResponseWriter
+	// handler is the name of the handler serving the query, or "" if it
+	// didn't match any.
+	handler string
+	// options holds the option labels found in the query name.
+	options map[string]string
+	// renames are applied, last first, to the names in the response.
+	renames []rename
+	// asked is the query name as it arrived, before any labels were taken
+	// out of it or it was lowercased along the way.
+	asked string
+	// edns is set if the query had an OPT record.
+	edns bool
+	// session is the session whose token was in the query name, if any.
+	session *session
+	// written keeps everything written if capture is set, for the session
+	// or webhooks.
+	capture bool
+	written []capturedWrite
+}
+
+// A rename maps names at or below from to the same names below to.
+type rename struct {
+	from, to string
+}
+
+// extractOptions records and removes any option labels and session token in
+// q's name. If there are any it returns a copy of q with them removed.
+func (rw *responseWriter) extractOptions(q *dns.Msg) *dns.Msg {
+	if len(q.Question) == 0 {
+		return q
+	}
+	name := q.Question[0].Name
+	var kept []string
+	for _, label := range dns.SplitDomainName(name) {
+		key, value, ok := strings.Cut(strings.ToLower(label), "-")
+		if ok && optionKeys[key] {
+			rw.options[key] = value
+			continue
+		}
+		if s := lookupSession(label); s != nil {
+			rw.session = s
+			continue
+		}
+		kept = append(kept, label)
+	}
+	stripped := dns.Fqdn(strings.Join(kept, "."))
+	if stripped == name {
+		return q
+	}
+	return rw.serveAs(q, stripped)
+}
+
+// serveAs returns a copy of q asking for name instead, and arranges for
+// names in the response to be mapped back to q's name.
+func (rw *responseWriter) serveAs(q *dns.Msg, name string) *dns.Msg {
+	q2 := q.Copy()
+	rw.renames = append(rw.renames, rename{from: name, to: q.Question[0].Name})
+	q2.Question[0].Name = name
+	return q2
+}
+
+// serveAs serves q as if it asked for name instead, which is usually in
+// another handler's subtree, and maps the names in the response back to the
+// ones that were asked for.
+func serveAs(w dns.ResponseWriter, q *dns.Msg, name string) {
+	rw, ok := w.(*responseWriter)
+	if !ok {
+		rw = &responseWriter{ResponseWriter: w, options: make(map[string]string)}
+	}
+	mux.ServeDNS(rw, rw.serveAs(q, name))
+}
+
+// option returns the value of an option for this response.
+func (rw *responseWriter) option(key, global string) string {
+	if v, ok := rw.options[key]; ok {
+		return v
+	}
+	if v, ok := perHandler[key][rw.handler]; ok {
+		return v
+	}
+	return global
+}
+
+// delay sleeps for a delay sampled from the latency option of the handler
+// for q. It is called once per query, before the handler runs, so that
+// handlers sending several responses, or writing them raw, are delayed once
+// like the rest.
+func (rw *responseWriter) delay(q *dns.Msg) {
+	rw.handler = handlerFor(qname(q))
+	if l, err := parseLatency(rw.option("latency", *latency)); err == nil {
+		time.Sleep(l.sample())
+	}
+}
+
+// WriteMsg implements dns.ResponseWriter.
+func (rw *responseWriter) WriteMsg(m *dns.Msg) error {
+	rw.restoreNames(m)
+	rw.omitGlue(m)
+	rw.overrideTTL(m)
+	rw.stripSignatures(m)
+	rw.annotate(m)
+	rw.advertiseAgent(m)
+	wire, err := rw.pack(m)
+	if err != nil {
+		return err
+	}
+	max, _ := strconv.Atoi(rw.option("maxsize", strconv.Itoa(*maxSize)))
+	if max > 0 && len(wire) > max {
+		m.Truncate(max)
+		m.Truncated = true
+		if wire, err = rw.pack(m); err != nil {
+			return err
+		}
+		if len(wire) > max {
+			// The chosen compression mode made it too big again, so
+			// drop everything but the EDNS OPT record.
+			opt := m.IsEdns0()
+			m.Answer, m.Ns, m.Extra = nil, nil, nil
+			if opt != nil {
+				m.Extra = []dns.RR{opt}
+			}
+			if wire, err = rw.pack(m); err != nil {
+				return err
+			}
+		}
+	}
+	_, err = rw.Write(wire)
+	return err
+}
+
+// Write implements dns.ResponseWriter.
+func (rw *responseWriter) Write(b []byte) (int, error) {
+	if rw.capture {
+		rw.written = append(rw.written, capturedWrite{time.Now(), append([]byte(nil), b...)})
+	}
+	return rw.ResponseWriter.Write(b)
+}
+
+// restoreNames maps the names in m back to the ones that were asked for.
+func (rw *responseWriter) restoreNames(m *dns.Msg) {
+	for i := len(rw.renames) - 1; i >= 0; i-- {
+		renameMsg(m, rw.renames[i].from, rw.renames[i].to)
+	}
+}
+
+// omitGlue takes the address records the glue option leaves out of the
+// additional section, for the name servers named in the answer and authority
+// sections. Glue mode a leaves out AAAA records and aaaa leaves out A, so
+// that a resolver has to look up the other family itself.
+func (rw *responseWriter) omitGlue(m *dns.Msg) {
+	mode := rw.option("glue", *glueMode)
+	if mode == "all" {
+		return
+	}
+	servers := make(map[string]bool)
+	for _, rr := range append(m.Answer[:len(m.Answer):len(m.Answer)], m.Ns...) {
+		if ns, ok := rr.(*dns.NS); ok {
+			servers[strings.ToLower(ns.Ns)] = true
+		}
+	}
+	var extra []dns.RR
+	for _, rr := range m.Extra {
+		rrtype := rr.Header().Rrtype
+		if servers[strings.ToLower(rr.Header().Name)] &&
+			(rrtype == dns.TypeA && mode != "a" || rrtype == dns.TypeAAAA && mode != "aaaa") {
+			continue
+		}
+		extra = append(extra, rr)
+	}
+	m.Extra = extra
+}
+
+// overrideTTL sets the TTL of every record in m, other than the EDNS OPT
+// record, to the one given by the ttl option, if there is one. Handlers
+// don't need to know about it, so any behavior can be tried with short or
+// long caching.
+func (rw *responseWriter) overrideTTL(m *dns.Msg) {
+	s := rw.option("ttl", *ttlOverride)
+	if s == "" {
+		return
+	}
+	ttl, err := strconv.ParseUint(s, 10, 32)
+	if err != nil {
+		return
+	}
+	for _, section := range [][]dns.RR{m.Answer, m.Ns, m.Extra} {
+		for _, rr := range section {
+			if rr.Header().Rrtype != dns.TypeOPT {
+				rr.Header().Ttl = uint32(ttl)
+			}
+		}
+	}
+}
+
+// refuseMixedCase answers q with REFUSED and returns true if the case
+// option says to refuse names with upper case letters, and the name asked for
+// has some. Resolvers using 0x20 encoding have to fall back to asking in
+// lower case.
+func (rw *responseWriter) refuseMixedCase(q *dns.Msg) bool {
+	if rw.option("case", *caseMode) != "refuse" || rw.asked == strings.ToLower(rw.asked) {
+		return false
+	}
+	m := new(dns.Msg)
+	m.SetRcode(q, dns.RcodeRefused)
+	rw.WriteMsg(m)
+	return true
+}
+
+// stripSignatures takes the RRSIGs the stripsig option selects out of m, the
+// way a signature-stripping attacker or a broken middlebox would. Validators
+// expecting the zone to be signed must then fail to validate, rather than
+// accept the answer as insecure.
+func (rw *responseWriter) stripSignatures(m *dns.Msg) {
+	types, percent, err := parseStripSig(rw.option("stripsig", *stripRRSIG))
+	if err != nil || percent == 0 || rand.IntN(100) >= percent {
+		return
+	}
+	strip := func(rrs []dns.RR) []dns.RR {
+		var kept []dns.RR
+		for _, rr := range rrs {
+			if sig, ok := rr.(*dns.RRSIG); ok && (types == nil || types[sig.TypeCovered]) {
+				continue
+			}
+			kept = append(kept, rr)
+		}
+		return kept
+	}
+	m.Answer, m.Ns, m.Extra = strip(m.Answer), strip(m.Ns), strip(m.Extra)
+}
+
+// expectOption is the code of the EDNS option the expect option's edns mode
+// adds, from the range for local and experimental use, next to the one
+// badednsflags.<base> uses.
+const expectOption = dns.EDNS0LOCALSTART + 1
+
+// annotate adds to m what a correct resolver makes of the responses of the
+// handler serving it, as its entry in the manifest says, if the expect
+// option asks for it. Conformance harnesses can then check a resolver's
+// result against the response itself. In edns mode the text goes into an
+// EDNS option with code expectOption, in an OPT record added if there is
+// none, and in txt mode into a TXT record for the question name at the end
+// of the additional section.
+func (rw *responseWriter) annotate(m *dns.Msg) {
+	mode := rw.option("expect", *expectMode)
+	outcome := expectedOutcome(rw.handler)
+	if mode == "off" || outcome == "" || len(m.Question) == 0 {
+		return
+	}
+	text := "expected: " + outcome
+	switch mode {
+	case "edns":
+		opt := m.IsEdns0()
+		if opt == nil {
+			m.SetEdns0(dns.DefaultMsgSize, false)
+			opt = m.IsEdns0()
+		}
+		opt.Option = append(opt.Option, &dns.EDNS0_LOCAL{Code: expectOption, Data: []byte(text)})
+	case "txt":
+		m.Extra = append(m.Extra, &dns.TXT{
+			Hdr: dns.RR_Header{Name: m.Question[0].Name, Rrtype: dns.TypeTXT, Class: dns.ClassINET},
+			Txt: splitTXT(text),
+		})
+	}
+}
+
+// packed returns m as WriteMsg would put it on the wire for w, short of
+// truncating it to the maximum size. m itself is left alone. It is for
+// handlers that need to control the exact size of a response.
+func packed(w dns.ResponseWriter, m *dns.Msg) ([]byte, error) {
+	rw, ok := w.(*responseWriter)
+	if !ok {
+		return m.Pack()
+	}
+	m = m.Copy()
+	rw.restoreNames(m)
+	rw.omitGlue(m)
+	rw.overrideTTL(m)
+	rw.stripSignatures(m)
+	rw.annotate(m)
+	rw.advertiseAgent(m)
+	return rw.pack(m)
+}
+
+// pack packs m using the compression mode in effect for this response.
+func (rw *responseWriter) pack(m *dns.Msg) ([]byte, error) {
+	switch rw.option("compress", *compress) {
+	case "on":
+		m.Compress = true
+		return m.Pack()
+	case "rdata":
+		m.Compress = false
+		return packRdataCompressed(m)
+	default:
+		m.Compress = false
+		return m.Pack()
+	}
+}
+
+// renamed returns name with from replaced by to, if name is at or below from.
+func renamed(name, from, to string) string {
+	if !dns.IsSubDomain(from, name) {
+		return name
+	}
+	return name[:len(name)-len(from)] + to
+}
+
+// renameMsg renames the question, owner names, and names in the RDATA of
+// common types throughout m.
+func renameMsg(m *dns.Msg, from, to string) {
+	for i := range m.Question {
+		m.Question[i].Name = renamed(m.Question[i].Name, from, to)
+	}
+	for _, section := range [][]dns.RR{m.Answer, m.Ns, m.Extra} {
+		for _, rr := range section {
+			hdr := rr.Header()
+			hdr.Name = renamed(hdr.Name, from, to)
+			switch rr := rr.(type) {
+			case *dns.CNAME:
+				rr.Target = renamed(rr.Target, from, to)
+			case *dns.DNAME:
+				rr.Target = renamed(rr.Target, from, to)
+			case *dns.NS:
+				rr.Ns = renamed(rr.Ns, from, to)
+			case *dns.PTR:
+				rr.Ptr = renamed(rr.Ptr, from, to)
+			case *dns.MX:
+				rr.Mx = renamed(rr.Mx, from, to)
+			case *dns.SRV:
+				rr.Target = renamed(rr.Target, from, to)
+			case *dns.NSEC:
+				rr.NextDomain = renamed(rr.NextDomain, from, to)
+			}
+		}
+	}
+}
+
+// packRdataCompressed packs m without the usual name compression, but with
+// names in the RDATA of RRSIG, NSEC, SRV and DNAME records compressed against
+// the question name. RFCs 2782, 3597, 4034 and 6672 all forbid that.
+// Pointers only ever target the question, which always starts at offset 12,
+// so changing RDATA lengths later in the message can't invalidate them.
+func packRdataCompressed(m *dns.Msg) ([]byte, error) {
+	wire, err := m.Pack()
+	if err != nil || len(m.Question) == 0 {
+		return wire, err
+	}
+	qname := m.Question[0].Name
+	off := 12 + len(packName(qname)) + 4
+	out := append([]byte(nil), wire[:off]...)
+	for _, rr := range append(append(append([]dns.RR(nil), m.Answer...), m.Ns...), m.Extra...) {
+		end := skipName(wire, off)
+		if end+10 > len(wire) {
+			return wire, nil
+		}
+		rdlen := int(wire[end+8])<<8 | int(wire[end+9])
+		rdStart := end + 10
+		if rdStart+rdlen > len(wire) {
+			return wire, nil
+		}
+		rdata := wire[rdStart : rdStart+rdlen]
+		var nameOff int
+		var name string
+		switch rr := rr.(type) {
+		case *dns.RRSIG:
+			nameOff, name = 18, rr.SignerName
+		case *dns.NSEC:
+			nameOff, name = 0, rr.NextDomain
+		case *dns.SRV:
+			nameOff, name = 6, rr.Target
+		case *dns.DNAME:
+			nameOff, name = 0, rr.Target
+		default:
+			nameOff = -1
+		}
+		if nameOff >= 0 {
+			plain := len(packName(name))
+			var newRdata []byte
+			newRdata = append(newRdata, rdata[:nameOff]...)
+			newRdata = append(newRdata, compressAgainst(name, qname)...)
+			newRdata = append(newRdata, rdata[nameOff+plain:]...)
+			rdata = newRdata
+		}
+		out = append(out, wire[off:end+8]...)
+		out = append(out, byte(len(rdata)>>8), byte(len(rdata)))
+		out = append(out, rdata...)
+		off = rdStart + rdlen
+	}
+	return out, nil
+}
+
+// packName returns the uncompressed wire form of name.
+func packName(name string) []byte {
+	buf := make([]byte, 256)
+	n, err := dns.PackDomainName(name, buf, 0, nil, false)
+	if err != nil {
+		return nil
+	}
+	return buf[:n]
+}
+
+// skipName returns the offset just past the, possibly compressed, name
+// starting at off.
+func skipName(wire []byte, off int) int {
+	for off < len(wire) {
+		switch l := int(wire[off]); {
+		case l == 0:
+			return off + 1
+		case l&0xC0 == 0xC0:
+			return off + 2
+		default:
+			off += l + 1
+		}
+	}
+	return off
+}
+
+// compressAgainst encodes name, replacing the longest suffix it shares with
+// qname by a pointer into the question section.
+func compressAgainst(name, qname string) []byte {
+	nameLabels := dns.SplitDomainName(name)
+	qLabels := dns.SplitDomainName(qname)
+	for i := range nameLabels {
+		suffix := dns.Fqdn(strings.Join(nameLabels[i:], "."))
+		for j := range qLabels {
+			if !strings.EqualFold(suffix, dns.Fqdn(strings.Join(qLabels[j:], "."))) {
+				continue
+			}
+			ptr := 12 + len(packName(dns.Fqdn(strings.Join(qLabels[:j], ".")))) - 1
+			out := packName(dns.Fqdn(strings.Join(nameLabels[:i], ".")))
+			out = out[:len(out)-1]
+			return append(out, byte(0xC0|ptr>>8), byte(ptr))
+		}
+	}
+	return packName(name)
+}
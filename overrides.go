@@ -0,0 +1,197 @@
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net/http"
+	"net/netip"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// Overrides let testers sharing one instance each pick a behavior for their
+// own resolver. A resolver is recognized by its source address falling in a
+// prefix, or by the client part of the EDNS cookie it sends. Every query from
+// it for a name under -base is then served as if it asked for the
+// override's name instead, like adaptive.<base> does.
+
+// overrideDefaultTTL is how long an override lasts if the tester doesn't say.
+const overrideDefaultTTL = time.Hour
+
+// An override is a behavior chosen for the clients matching it.
+type override struct {
+	// match is the key the override is stored under.
+	match string
+	// name is what matching queries are served as, relative to -base.
+	name    string
+	expires time.Time
+}
+
+// overrides are keyed by "cookie:<hex client cookie>" or by a prefix in CIDR
+// notation.
+var (
+	overridesMu sync.Mutex
+	overrides   = make(map[string]override)
+)
+
+// overrideFor returns the name q should be served as, if an override applies
+// to it. Cookies take precedence over prefixes, and longer prefixes over
+// shorter ones.
+func overrideFor(w dns.ResponseWriter, q *dns.Msg) (string, bool) {
+	if len(q.Question) == 0 || !dns.IsSubDomain(dns.Fqdn(*basename), qname(q)) {
+		return "", false
+	}
+	overridesMu.Lock()
+	defer overridesMu.Unlock()
+	if len(overrides) == 0 {
+		return "", false
+	}
+	now := time.Now()
+	if cookie := clientCookie(q); cookie != "" {
+		if o, ok := overrides["cookie:"+cookie]; ok && now.Before(o.expires) {
+			return dns.Fqdn(o.name + "." + *basename), true
+		}
+	}
+	addr, err := netip.ParseAddr(clientIP(w))
+	if err != nil {
+		return "", false
+	}
+	best, found := override{}, -1
+	for match, o := range overrides {
+		prefix, err := netip.ParsePrefix(match)
+		if err != nil || !now.Before(o.expires) || !prefix.Contains(addr.Unmap()) {
+			continue
+		}
+		if prefix.Bits() > found {
+			best, found = o, prefix.Bits()
+		}
+	}
+	if found < 0 {
+		return "", false
+	}
+	return dns.Fqdn(best.name + "." + *basename), true
+}
+
+// clientCookie returns the client cookie in q's EDNS COOKIE option, in
+// lowercase hex, or "".
+func clientCookie(q *dns.Msg) string {
+	opt := q.IsEdns0()
+	if opt == nil {
+		return ""
+	}
+	for _, o := range opt.Option {
+		if c, ok := o.(*dns.EDNS0_COOKIE); ok && len(c.Cookie) >= 16 {
+			return strings.ToLower(c.Cookie[:16])
+		}
+	}
+	return ""
+}
+
+// overridesAdminHandler lists the overrides on GET. On POST it sets an
+// override with ?match=<prefix or cookie:hex>&behavior=<name>&action=set,
+// optionally with &ttl=<duration>, or removes one with action=clear.
+// behavior is a name relative to -base, such as 800.sleep or tc-txt.preset.
+func overridesAdminHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodGet {
+		for _, o := range liveOverrides() {
+			fmt.Fprintf(w, "%s %s %s\n", o.match, o.name, o.expires.Format(time.RFC3339))
+		}
+		return
+	}
+	if !requirePost(w, r) {
+		return
+	}
+	match, err := parseOverrideMatch(r.FormValue("match"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	switch action := r.FormValue("action"); action {
+	case "set":
+		ttl := overrideDefaultTTL
+		if s := r.FormValue("ttl"); s != "" {
+			if ttl, err = time.ParseDuration(s); err != nil || ttl <= 0 {
+				http.Error(w, fmt.Sprintf("bad ttl %q", s), http.StatusBadRequest)
+				return
+			}
+		}
+		if _, err := setOverride(match, r.FormValue("behavior"), ttl); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	case "clear":
+		clearOverride(match)
+	default:
+		http.Error(w, fmt.Sprintf("unknown action %q", action), http.StatusBadRequest)
+		return
+	}
+	fmt.Fprintf(w, "%s: %s\n", match, r.FormValue("action"))
+}
+
+// liveOverrides returns the overrides that haven't expired, sorted by match.
+func liveOverrides() []override {
+	overridesMu.Lock()
+	var live []override
+	now := time.Now()
+	for _, o := range overrides {
+		if now.Before(o.expires) {
+			live = append(live, o)
+		}
+	}
+	overridesMu.Unlock()
+	sort.Slice(live, func(i, j int) bool { return live[i].match < live[j].match })
+	return live
+}
+
+// setOverride serves the clients matching match, which parseOverrideMatch
+// has normalized, as behavior for ttl.
+func setOverride(match, behavior string, ttl time.Duration) (override, error) {
+	name := strings.Trim(strings.ToLower(behavior), ".")
+	if name == "" {
+		return override{}, fmt.Errorf("behavior must be a name relative to the base")
+	}
+	overridesMu.Lock()
+	defer overridesMu.Unlock()
+	now := time.Now()
+	for k, o := range overrides {
+		if !now.Before(o.expires) {
+			delete(overrides, k)
+		}
+	}
+	o := override{match: match, name: name, expires: now.Add(ttl)}
+	overrides[match] = o
+	log.Printf("override: %s served as %s for %s", match, name, ttl)
+	return o, nil
+}
+
+// clearOverride removes the override for match, if there is one.
+func clearOverride(match string) {
+	overridesMu.Lock()
+	defer overridesMu.Unlock()
+	delete(overrides, match)
+	log.Printf("override: %s cleared", match)
+}
+
+// parseOverrideMatch validates and normalizes the match parameter. A bare
+// address is taken to be a prefix of its full length.
+func parseOverrideMatch(s string) (string, error) {
+	if cookie, ok := strings.CutPrefix(strings.ToLower(s), "cookie:"); ok {
+		if b, err := hex.DecodeString(cookie); err != nil || len(b) != 8 {
+			return "", fmt.Errorf("client cookies are 8 bytes of hex")
+		}
+		return "cookie:" + cookie, nil
+	}
+	if addr, err := netip.ParseAddr(s); err == nil {
+		s = netip.PrefixFrom(addr, addr.BitLen()).String()
+	}
+	prefix, err := netip.ParsePrefix(s)
+	if err != nil {
+		return "", fmt.Errorf("match must be a prefix, an address or cookie:<hex>")
+	}
+	return prefix.Masked().String(), nil
+}
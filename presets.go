@@ -0,0 +1,134 @@
+package main
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// A quirk wraps a handler to reproduce one specific way real authoritative
+// servers have been seen to misbehave.
+type quirk func(next dns.HandlerFunc) dns.HandlerFunc
+
+// presets are named baskets of quirks. Each one is modeled on a class of
+// server that resolver developers keep running into in the wild.
+var presets = map[string][]quirk{
+	// Servers that predate EDNS and choke on anything they don't know.
+	"pre-edns": {formerrEDNS, notimpUnknownType},
+	// Load balancers that only know about A records.
+	"v4-only-lb": {dropAAAA, formerrEDNS},
+	// Appliances that claim the name doesn't exist when asked for AAAA.
+	"nxdomain-aaaa": {nxdomainAAAA},
+	// Servers that can't fit TXT records in any response, even over TCP.
+	"tc-txt": {truncateTXT},
+	// Everything above at once.
+	"kitchen-sink": {formerrEDNS, notimpUnknownType, nxdomainAAAA, truncateTXT},
+}
+
+// presetHandler serves names of the form <anything>.<preset>.preset.<base>.
+// Names are answered like a healthy zone, but with the quirks of the named
+// preset applied.
+func presetHandler(w dns.ResponseWriter, q *dns.Msg) {
+	logQuery(w, q, "presetHandler")
+	labels := subLabels(qname(q), zone("preset"))
+	if len(labels) == 0 {
+		txtError(w, q, "available presets: "+strings.Join(presetNames(), ", "))
+		return
+	}
+	name := strings.ToLower(labels[len(labels)-1])
+	quirks, ok := presets[name]
+	if !ok {
+		txtError(w, q, "unknown preset "+name)
+		return
+	}
+	presetZone := name + "." + zone("preset")
+	var h dns.HandlerFunc = func(w dns.ResponseWriter, q *dns.Msg) {
+		m := new(dns.Msg)
+		m.SetRcode(q, dns.RcodeSuccess)
+		healthyAnswer(m, q, presetZone)
+		w.WriteMsg(m)
+	}
+	for i := len(quirks) - 1; i >= 0; i-- {
+		h = quirks[i](h)
+	}
+	h(w, q)
+}
+
+// presetNames returns the names of all presets in sorted order.
+func presetNames() []string {
+	var names []string
+	for name := range presets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// formerrEDNS answers FORMERR, without an OPT record, to any query that has
+// one.
+func formerrEDNS(next dns.HandlerFunc) dns.HandlerFunc {
+	return func(w dns.ResponseWriter, q *dns.Msg) {
+		if q.IsEdns0() == nil {
+			next(w, q)
+			return
+		}
+		m := new(dns.Msg)
+		m.SetRcode(q, dns.RcodeFormatError)
+		w.WriteMsg(m)
+	}
+}
+
+// notimpUnknownType answers NOTIMP to queries for anything but the handful
+// of types an old server would have known about.
+func notimpUnknownType(next dns.HandlerFunc) dns.HandlerFunc {
+	return func(w dns.ResponseWriter, q *dns.Msg) {
+		switch q.Question[0].Qtype {
+		case dns.TypeA, dns.TypeNS, dns.TypeCNAME, dns.TypeSOA, dns.TypePTR,
+			dns.TypeMX, dns.TypeTXT:
+			next(w, q)
+		default:
+			m := new(dns.Msg)
+			m.SetRcode(q, dns.RcodeNotImplemented)
+			w.WriteMsg(m)
+		}
+	}
+}
+
+// dropAAAA never answers AAAA queries.
+func dropAAAA(next dns.HandlerFunc) dns.HandlerFunc {
+	return func(w dns.ResponseWriter, q *dns.Msg) {
+		if q.Question[0].Qtype == dns.TypeAAAA {
+			return
+		}
+		next(w, q)
+	}
+}
+
+// nxdomainAAAA answers NXDOMAIN to AAAA queries for names that exist.
+func nxdomainAAAA(next dns.HandlerFunc) dns.HandlerFunc {
+	return func(w dns.ResponseWriter, q *dns.Msg) {
+		if q.Question[0].Qtype != dns.TypeAAAA {
+			next(w, q)
+			return
+		}
+		m := new(dns.Msg)
+		m.SetRcode(q, dns.RcodeNameError)
+		w.WriteMsg(m)
+	}
+}
+
+// truncateTXT answers TXT queries with an empty, truncated response over
+// every transport.
+func truncateTXT(next dns.HandlerFunc) dns.HandlerFunc {
+	return func(w dns.ResponseWriter, q *dns.Msg) {
+		if q.Question[0].Qtype != dns.TypeTXT {
+			next(w, q)
+			return
+		}
+		m := new(dns.Msg)
+		m.SetRcode(q, dns.RcodeSuccess)
+		m.Truncated = true
+		w.WriteMsg(m)
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// arrivals counts the queries from each client address, per second, under
+// "<client>|<Unix second>".
+var arrivals = newCounters("qps")
+
+// countArrival counts a query from client towards its query rate.
+func countArrival(client string) {
+	arrivals.incr(client+"|"+strconv.FormatInt(time.Now().Unix(), 10), time.Minute+time.Second)
+}
+
+// recentArrivals returns how many queries client sent in each of the last
+// seconds, the current one first, read in one go.
+func recentArrivals(client string, seconds int) []int64 {
+	now := time.Now().Unix()
+	keys := make([]string, seconds)
+	for i := range keys {
+		keys[i] = client + "|" + strconv.FormatInt(now-int64(i), 10)
+	}
+	return arrivals.getMany(keys...)
+}
+
+// qpsHandler answers queries for names under qps.<base> with a TXT record
+// giving the rate of queries the server has seen from the querying address,
+// over all names, in the last 10 seconds and the last minute. The query
+// asking counts too.
+func qpsHandler(w dns.ResponseWriter, q *dns.Msg) {
+	logQuery(w, q, "qpsHandler")
+	client := clientIP(w)
+	m := new(dns.Msg)
+	m.SetRcode(q, dns.RcodeSuccess)
+	m.Authoritative = true
+	if q.Question[0].Qtype != dns.TypeTXT && q.Question[0].Qtype != dns.TypeANY {
+		m.Ns = []dns.RR{soaRecord(zone("qps"))}
+		w.WriteMsg(m)
+		return
+	}
+	// The current second counts as a whole one.
+	counts := recentArrivals(client, 60)
+	var txt []string
+	for _, window := range []time.Duration{10 * time.Second, time.Minute} {
+		var n int64
+		for _, c := range counts[:int(window/time.Second)] {
+			n += c
+		}
+		txt = append(txt, fmt.Sprintf("%s: %d queries in %s, %.1f qps",
+			client, n, window, float64(n)/window.Seconds()))
+	}
+	m.Answer = []dns.RR{&dns.TXT{
+		Hdr: dns.RR_Header{Name: qname(q), Rrtype: dns.TypeTXT, Class: dns.ClassINET},
+		Txt: txt,
+	}}
+	w.WriteMsg(m)
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"runtime/debug"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+var quarantineAfter = flag.Int("quarantine-after", 3, "number of panics after which a handler is disabled and answers SERVFAIL, until released through the admin API.")
+
+// A quarantineRecord tracks the panics of one handler.
+type quarantineRecord struct {
+	Panics    int       `json:"panics"`
+	LastPanic string    `json:"last_panic"`
+	LastAt    time.Time `json:"last_at"`
+	Disabled  bool      `json:"disabled"`
+}
+
+var (
+	quarantineMu sync.Mutex
+	// quarantine is keyed by handler name. Handlers that never panicked
+	// aren't in it.
+	quarantine = make(map[string]*quarantineRecord)
+)
+
+// guarded runs h, recovering from any panic in it or in what it calls, such
+// as the dns library packing a response it can't handle. That query goes
+// unanswered, but the rest of the instance stays up. After -quarantine-after
+// panics the handler is disabled, so that a query of death can't keep
+// knocking it over.
+func guarded(name string, h dns.HandlerFunc) dns.HandlerFunc {
+	return func(w dns.ResponseWriter, q *dns.Msg) {
+		if quarantined(name) {
+			m := new(dns.Msg)
+			m.SetRcode(q, dns.RcodeServerFailure)
+			w.WriteMsg(m)
+			return
+		}
+		defer func() {
+			if err := recover(); err != nil {
+				log.Printf("panic in %s handling %q from %s: %v\n%s", name, qname(q), w.RemoteAddr(), err, debug.Stack())
+				recordPanic(name, err)
+			}
+		}()
+		h(w, q)
+	}
+}
+
+func quarantined(name string) bool {
+	quarantineMu.Lock()
+	defer quarantineMu.Unlock()
+	r := quarantine[name]
+	return r != nil && r.Disabled
+}
+
+func recordPanic(name string, err any) {
+	quarantineMu.Lock()
+	defer quarantineMu.Unlock()
+	r := quarantine[name]
+	if r == nil {
+		r = new(quarantineRecord)
+		quarantine[name] = r
+	}
+	r.Panics++
+	r.LastPanic = fmt.Sprint(err)
+	r.LastAt = time.Now()
+	if !r.Disabled && *quarantineAfter > 0 && r.Panics >= *quarantineAfter {
+		r.Disabled = true
+		log.Printf("quarantine: disabling %s after %d panics", name, r.Panics)
+	}
+}
+
+// quarantineSnapshot returns a copy of the quarantine records.
+func quarantineSnapshot() map[string]quarantineRecord {
+	quarantineMu.Lock()
+	defer quarantineMu.Unlock()
+	snapshot := make(map[string]quarantineRecord)
+	for name, r := range quarantine {
+		snapshot[name] = *r
+	}
+	return snapshot
+}
+
+// quarantineAdminHandler lists the handlers that panicked on GET, and on
+// POST re-enables a disabled one, resetting its count:
+//
+//	POST /quarantine?handler=cnamepit&action=release
+func quarantineAdminHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodGet {
+		snapshot := quarantineSnapshot()
+		var names []string
+		for name := range snapshot {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			q := snapshot[name]
+			fmt.Fprintf(w, "%s panics=%d disabled=%t last=%s %q\n", name, q.Panics, q.Disabled, q.LastAt.Format(time.RFC3339), q.LastPanic)
+		}
+		return
+	}
+	if !requirePost(w, r) {
+		return
+	}
+	name := r.FormValue("handler")
+	if action := r.FormValue("action"); action != "release" {
+		http.Error(w, fmt.Sprintf("unknown action %q", action), http.StatusBadRequest)
+		return
+	}
+	quarantineMu.Lock()
+	_, ok := quarantine[name]
+	delete(quarantine, name)
+	quarantineMu.Unlock()
+	if !ok {
+		http.Error(w, "handler is not quarantined", http.StatusNotFound)
+		return
+	}
+	log.Printf("quarantine: %s released", name)
+	fmt.Fprintf(w, "%s: release\n", name)
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+var redisAddr = flag.String("redis", "", "host:port of a Redis server to keep the counters of stateful handlers, such as nthtry and adaptive, and the session tokens in, so that instances behind a load balancer share them. Kept in memory if empty.")
+var redisPrefix = flag.String("redis-prefix", "awful:", "prefix of the keys in -redis, to share a Redis server with other things.")
+
+// redisTimeout bounds each Redis operation. A query shouldn't hang on it for
+// longer than on the handler itself.
+const redisTimeout = 500 * time.Millisecond
+
+// A redisStore is a counterStore in Redis. Errors are logged, and reads that
+// fail are treated as missing entries, so that a Redis outage makes handlers
+// forget rather than stop answering.
+type redisStore struct {
+	client *redis.Client
+	prefix string
+}
+
+// openRedis sets sharedStore to the Redis server at -redis, if there is one.
+func openRedis() error {
+	if *redisAddr == "" {
+		return nil
+	}
+	client := redis.NewClient(&redis.Options{Addr: *redisAddr})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := client.Ping(ctx).Err(); err != nil {
+		return fmt.Errorf("-redis: %s", err)
+	}
+	sharedStore = &redisStore{client: client, prefix: *redisPrefix}
+	return nil
+}
+
+func (r *redisStore) get(key string) (int64, bool) {
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+	n, err := r.client.Get(ctx, r.prefix+key).Int64()
+	if err != nil {
+		if !errors.Is(err, redis.Nil) {
+			log.Printf("redis: get %s: %s", key, err)
+		}
+		return 0, false
+	}
+	return n, true
+}
+
+func (r *redisStore) getMany(keys []string) []int64 {
+	values := make([]int64, len(keys))
+	if len(keys) == 0 {
+		return values
+	}
+	prefixed := make([]string, len(keys))
+	for i, key := range keys {
+		prefixed[i] = r.prefix + key
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+	stored, err := r.client.MGet(ctx, prefixed...).Result()
+	if err != nil {
+		log.Printf("redis: mget %s...: %s", keys[0], err)
+		return values
+	}
+	for i, v := range stored {
+		if s, ok := v.(string); ok {
+			values[i], _ = strconv.ParseInt(s, 10, 64)
+		}
+	}
+	return values
+}
+
+func (r *redisStore) set(key string, value int64, ttl time.Duration) {
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+	// A ttl of zero would keep the key for good, rather than not at all.
+	if ttl <= 0 {
+		if err := r.client.Del(ctx, r.prefix+key).Err(); err != nil {
+			log.Printf("redis: del %s: %s", key, err)
+		}
+		return
+	}
+	if err := r.client.Set(ctx, r.prefix+key, value, ttl).Err(); err != nil {
+		log.Printf("redis: set %s: %s", key, err)
+	}
+}
+
+func (r *redisStore) incr(key string, ttl time.Duration) int64 {
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+	var incr *redis.IntCmd
+	_, err := r.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		incr = pipe.Incr(ctx, r.prefix+key)
+		if ttl <= 0 {
+			pipe.Del(ctx, r.prefix+key)
+		} else {
+			pipe.PExpire(ctx, r.prefix+key, ttl)
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("redis: incr %s: %s", key, err)
+		return 1
+	}
+	return incr.Val()
+}
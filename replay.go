@@ -0,0 +1,104 @@
+package main
+
+import (
+	"encoding/binary"
+	"flag"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+	bolt "go.etcd.io/bbolt"
+)
+
+var responsesDB = flag.String("responses", "", "BoltDB file of captured responses to replay verbatim for the names in it. See replay.go for the layout.")
+
+// The -responses database has a single bucket, "responses". Each key is a
+// query name, type and transport separated by spaces, and each value the wire
+// format response to send for it:
+//
+//	www.vendor.example. AAAA udp
+//	www.vendor.example. AAAA tcp
+//	www.vendor.example. AAAA
+//
+// The name is fully qualified and lowercase, the type is as dns.TypeToString
+// has it, and the transport is udp or tcp, with DoT and DoH counting as tcp.
+// A key without a transport is used when there is none for the transport the
+// query came over.
+//
+// Only the message ID of a stored response is changed, to match the query.
+// Everything else, including malformed parts, goes out as stored. Names the
+// database has no response for are served as usual, so replayed names can sit
+// next to the handlers under -base or anywhere else the server is asked
+// about. The file is read through a memory map in read only transactions, so
+// it can be much larger than memory and be shared by concurrent queries.
+
+// responsesBucket is the bucket the responses are in.
+var responsesBucket = []byte("responses")
+
+// replayDB is the opened -responses database, or nil.
+var replayDB *bolt.DB
+
+// openResponses opens the database for -responses and checks that it has the
+// responses bucket.
+func openResponses(path string) (*bolt.DB, error) {
+	db, err := bolt.Open(path, 0o400, &bolt.Options{ReadOnly: true, Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("-responses: %s", err)
+	}
+	err = db.View(func(tx *bolt.Tx) error {
+		if tx.Bucket(responsesBucket) == nil {
+			return fmt.Errorf("-responses: %s has no %q bucket", path, responsesBucket)
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// replayedResponse looks up the stored response for q, preferring one stored
+// for the transport it came over.
+func replayedResponse(w dns.ResponseWriter, q *dns.Msg) ([]byte, bool) {
+	if replayDB == nil || len(q.Question) == 0 {
+		return nil, false
+	}
+	transport := "udp"
+	if w.RemoteAddr().Network() == "tcp" {
+		transport = "tcp"
+	}
+	key := strings.ToLower(qname(q)) + " " + dns.TypeToString[q.Question[0].Qtype]
+	var wire []byte
+	replayDB.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(responsesBucket)
+		v := b.Get([]byte(key + " " + transport))
+		if v == nil {
+			v = b.Get([]byte(key))
+		}
+		// Values are only valid during the transaction.
+		wire = append([]byte(nil), v...)
+		return nil
+	})
+	return wire, len(wire) > 0
+}
+
+// replayHandler is the catch-all handler when -responses is given. It sends
+// the stored response for names in the database, and hands everything else
+// to unknownHandler.
+func replayHandler(w dns.ResponseWriter, q *dns.Msg) {
+	wire, ok := replayedResponse(w, q)
+	if !ok {
+		unknownHandler(w, q)
+		return
+	}
+	if rw, ok := w.(*responseWriter); ok {
+		rw.handler = "replay"
+	}
+	logQuery(w, q, "replayHandler")
+	if len(wire) >= 2 {
+		binary.BigEndian.PutUint16(wire, q.Id)
+	}
+	w.Write(wire)
+}
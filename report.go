@@ -0,0 +1,81 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+var reportChannel = flag.Bool("report-channel", false, "advertise report.<base> as the DNS error reporting agent (RFC 9567) in responses to queries with EDNS.")
+
+// report.<base> is a DNS error reporting agent, as in RFC 9567. Resolvers
+// that run into trouble with a zone served here, and were told of the agent
+// in a Report-Channel option (see -report-channel), report it by asking for
+// the TXT record of
+//
+//	_er.<qtype>.<qname>.<extended error code>._er.report.<base>
+//
+// which is logged and answered with a TXT record, whose TTL keeps the
+// resolver from reporting the same error again for a while.
+
+// reportTTL is the TTL of the answers to error reports.
+const reportTTL = 3600
+
+// reportHandler logs the error reports under report.<base>.
+func reportHandler(w dns.ResponseWriter, q *dns.Msg) {
+	logQuery(w, q, "reportHandler")
+	name := qname(q)
+	labels := subLabels(name, zone("report"))
+	m := new(dns.Msg)
+	m.SetRcode(q, dns.RcodeSuccess)
+	m.Authoritative = true
+	n := len(labels)
+	if n < 4 || labels[0] != "_er" || labels[n-1] != "_er" {
+		m.Rcode = dns.RcodeNameError
+		m.Ns = []dns.RR{soaRecord(zone("report"))}
+		w.WriteMsg(m)
+		return
+	}
+	qtype, err := strconv.ParseUint(labels[1], 10, 16)
+	code, err2 := strconv.ParseUint(labels[n-2], 10, 16)
+	if err != nil || err2 != nil {
+		m.Rcode = dns.RcodeNameError
+		m.Ns = []dns.RR{soaRecord(zone("report"))}
+		w.WriteMsg(m)
+		return
+	}
+	reported := dns.Fqdn(strings.Join(labels[2:n-2], "."))
+	log.Printf("error report from %s: %s/%s failed with extended error %d (%s)",
+		w.RemoteAddr(), reported, dns.Type(qtype), code, dns.ExtendedErrorCodeToString[uint16(code)])
+	recordMonitoredReport(clientIP(w), reported)
+
+	if q.Question[0].Qtype != dns.TypeTXT {
+		m.Ns = []dns.RR{soaRecord(zone("report"))}
+		w.WriteMsg(m)
+		return
+	}
+	m.Answer = []dns.RR{&dns.TXT{
+		Hdr: dns.RR_Header{Name: name, Rrtype: dns.TypeTXT, Class: dns.ClassINET, Ttl: reportTTL},
+		Txt: []string{"report received"},
+	}}
+	w.WriteMsg(m)
+}
+
+// advertiseAgent adds a Report-Channel option naming report.<base> to m if
+// -report-channel is set and the query had EDNS, or always for
+// broken-but-monitored.<base>. Answers from the agent itself don't get one,
+// so that errors in reporting aren't reported.
+func (rw *responseWriter) advertiseAgent(m *dns.Msg) {
+	if !rw.edns || rw.handler == "report" || !*reportChannel && rw.handler != "broken-but-monitored" {
+		return
+	}
+	opt := m.IsEdns0()
+	if opt == nil {
+		m.SetEdns0(1232, false)
+		opt = m.IsEdns0()
+	}
+	opt.Option = append(opt.Option, &dns.EDNS0_REPORTING{Code: dns.EDNS0REPORTING, AgentDomain: zone("report")})
+}
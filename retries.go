@@ -0,0 +1,68 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// Handlers that behave differently on retries count the attempts of each
+// client in counters, keyed by retryClient and what is asked. The entries
+// expire nthTryMemory after the last attempt, so a test can be run again
+// with the same names after a pause.
+
+// retryClient returns who an attempt to resolve q is counted against: the
+// session, if the query carries a session token, since resolvers often
+// retry from different addresses, and the client address otherwise.
+func retryClient(w dns.ResponseWriter) string {
+	if rw, ok := w.(*responseWriter); ok && rw.session != nil {
+		return rw.session.token
+	}
+	return clientIP(w)
+}
+
+// questionKey returns the key counting attempts by w's client at q's
+// question, name and type both.
+func questionKey(w dns.ResponseWriter, q *dns.Msg) string {
+	return retryClient(w) + "|" + strings.ToLower(qname(q)) + "|" + dns.TypeToString[q.Question[0].Qtype]
+}
+
+// failFirstAttempts counts attempts under questionKey.
+var failFirstAttempts = newCounters("failfirst")
+
+// failFirstHandler serves names of the form
+// <anything>.<n>[.servfail].failfirst.<base>. It drops the first n attempts
+// at each question, or answers them with SERVFAIL with a label servfail, and
+// gives a healthy answer from attempt n+1 on. Unlike nthtry.<base>,
+// attempts are counted per query type, so a resolver asking for A and AAAA
+// at once fails each of them n times.
+func failFirstHandler(w dns.ResponseWriter, q *dns.Msg) {
+	logQuery(w, q, "failFirstHandler")
+	labels := subLabels(qname(q), zone("failfirst"))
+	servfail := len(labels) > 0 && strings.EqualFold(labels[len(labels)-1], "servfail")
+	if servfail {
+		labels = labels[:len(labels)-1]
+	}
+	n := int64(-1)
+	if len(labels) > 0 {
+		if v, err := strconv.ParseInt(labels[len(labels)-1], 10, 32); err == nil {
+			n = v
+		}
+	}
+	if n < 0 {
+		txtError(w, q, "query <anything>.<n>[.servfail].failfirst.<base>")
+		return
+	}
+	m := new(dns.Msg)
+	if failFirstAttempts.incr(questionKey(w, q), nthTryMemory) <= n {
+		if servfail {
+			m.SetRcode(q, dns.RcodeServerFailure)
+			w.WriteMsg(m)
+		}
+		return
+	}
+	m.SetRcode(q, dns.RcodeSuccess)
+	healthyAnswer(m, q, zone("failfirst"))
+	w.WriteMsg(m)
+}
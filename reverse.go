@@ -0,0 +1,99 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+var reverseZones = flag.String("reverse-zones", "", "comma separated reverse zones delegated to this server, such as 2.0.192.in-addr.arpa, in which the advertised addresses get PTR records pointing at ns.<base>. auto serves the /24 and /64 around the advertised addresses. Disabled if empty.")
+
+// serveReverse registers handlers for the zones in -reverse-zones.
+func serveReverse() error {
+	for _, z := range strings.Split(*reverseZones, ",") {
+		switch z = strings.TrimSpace(z); z {
+		case "":
+		case "auto":
+			serveReverseZone(reverseZone(advertise4, 3))
+			if advertise6 != nil {
+				serveReverseZone(reverseZone(advertise6, 16))
+			}
+		default:
+			z = dns.Fqdn(strings.ToLower(z))
+			if !dns.IsSubDomain("in-addr.arpa.", z) && !dns.IsSubDomain("ip6.arpa.", z) {
+				return fmt.Errorf("-reverse-zones: %q is not a reverse zone", z)
+			}
+			serveReverseZone(z)
+		}
+	}
+	return nil
+}
+
+// reverseZone returns the reverse zone for the first n labels of ip's
+// reverse name, i.e. octets for IPv4 and nibbles for IPv6.
+func reverseZone(ip net.IP, n int) string {
+	name, _ := dns.ReverseAddr(ip.String())
+	labels := dns.SplitDomainName(name)
+	keep := len(labels) - 2 - n
+	return dns.Fqdn(strings.Join(labels[keep:], "."))
+}
+
+// serveReverseZone registers a handler serving the reverse zone z. The
+// reverse names of the advertised addresses get PTR records pointing at
+// ns.<base>, which in turn has A and AAAA records for them, so that the
+// server's addresses pass forward-confirmed reverse DNS checks. Other names
+// in z don't exist.
+func serveReverseZone(z string) {
+	mux.HandleFunc(z, func(w dns.ResponseWriter, q *dns.Msg) {
+		logQuery(w, q, "reverseHandler")
+		name := strings.ToLower(qname(q))
+		m := new(dns.Msg)
+		m.SetRcode(q, dns.RcodeSuccess)
+		m.Authoritative = true
+
+		var ours bool
+		for _, ip := range []net.IP{advertise4, advertise6} {
+			if ip == nil {
+				continue
+			}
+			if reverse, _ := dns.ReverseAddr(ip.String()); reverse == name {
+				ours = true
+			}
+		}
+		switch {
+		case name == z:
+			switch q.Question[0].Qtype {
+			case dns.TypeSOA:
+				m.Answer = []dns.RR{soaRecord(z)}
+			case dns.TypeNS:
+				m.Answer, m.Extra = nsRRset(z, 3600, "ns."+dns.Fqdn(*basename))
+			default:
+				m.Ns = []dns.RR{soaRecord(z)}
+			}
+		case ours && q.Question[0].Qtype == dns.TypePTR:
+			m.Answer = []dns.RR{&dns.PTR{
+				Hdr: dns.RR_Header{Name: qname(q), Rrtype: dns.TypePTR, Class: dns.ClassINET},
+				Ptr: "ns." + dns.Fqdn(*basename),
+			}}
+		case ours:
+			m.Ns = []dns.RR{soaRecord(z)}
+		default:
+			m.Rcode = dns.RcodeNameError
+			m.Ns = []dns.RR{soaRecord(z)}
+		}
+		w.WriteMsg(m)
+	})
+}
+
+// nsHandler serves ns.<base>, the name that the SOA records and the reverse
+// names of the advertised addresses point at, like a healthy zone.
+func nsHandler(w dns.ResponseWriter, q *dns.Msg) {
+	logQuery(w, q, "nsHandler")
+	m := new(dns.Msg)
+	m.SetRcode(q, dns.RcodeSuccess)
+	healthyAnswer(m, q, zone("ns"))
+	w.WriteMsg(m)
+}
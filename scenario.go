@@ -0,0 +1,185 @@
+package main
+
+import (
+	"encoding/base64"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+	"gopkg.in/yaml.v3"
+)
+
+var scenarioFile = flag.String("scenarios", "", "YAML file of scenarios served under scenario.<base>.")
+
+// A scenario file looks like this:
+//
+//	scenarios:
+//	  flaky:
+//	    steps: [referral, servfail, badsig]
+//	    then: restart
+//	  slow-then-fine:
+//	    steps: [3000.sleep, answer]
+//
+// Each query for a name <anything>.<scenario>.scenario.<base> is answered by
+// the next step of the scenario, counting queries for that exact name. After
+// the last step the scenario stays there, or with "then: restart" goes back
+// to the first one. A step is one of
+//
+//	answer    a healthy answer
+//	referral  a referral to the name itself, served by this server
+//	servfail, nxdomain, refused, formerr
+//	          an empty response with that rcode
+//	truncate  an empty response with TC set
+//	drop      no response at all
+//	badsig    a healthy answer with an RRSIG that doesn't verify
+//
+// or else a name relative to -base, such as 800.sleep or tc-txt.preset, that
+// the query is served as.
+type scenarioConfig struct {
+	Scenarios map[string]*scenario `yaml:"scenarios"`
+}
+
+type scenario struct {
+	Steps []string `yaml:"steps"`
+	Then  string   `yaml:"then"`
+}
+
+// scenarioMemory is how long a name's position in its scenario is kept after
+// its last query.
+const scenarioMemory = 10 * time.Minute
+
+// scenarios holds the scenarios loaded from -scenarios, keyed by name.
+var scenarios map[string]*scenario
+
+// scenarioPositions counts queries for each name under scenario.<base>.
+var scenarioPositions = newCounters("scenario")
+
+// loadScenarios reads and checks a scenario file.
+func loadScenarios(path string) (map[string]*scenario, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var config scenarioConfig
+	if err := yaml.Unmarshal(b, &config); err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err)
+	}
+	loaded := make(map[string]*scenario)
+	for name, s := range config.Scenarios {
+		if s == nil || len(s.Steps) == 0 {
+			return nil, fmt.Errorf("%s: scenario %q has no steps", path, name)
+		}
+		if strings.Contains(name, ".") {
+			return nil, fmt.Errorf("%s: scenario name %q must be a single label", path, name)
+		}
+		switch s.Then {
+		case "", "stay", "restart":
+		default:
+			return nil, fmt.Errorf("%s: scenario %q: unknown then %q", path, name, s.Then)
+		}
+		loaded[strings.ToLower(name)] = s
+	}
+	return loaded, nil
+}
+
+// scenarioHandler serves names of the form <anything>.<scenario>.scenario.<base>
+// with the steps of the scenario, as described above.
+func scenarioHandler(w dns.ResponseWriter, q *dns.Msg) {
+	logQuery(w, q, "scenarioHandler")
+	name := qname(q)
+	labels := subLabels(name, zone("scenario"))
+	if len(labels) == 0 {
+		names := make([]string, 0, len(scenarios))
+		for n := range scenarios {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		txtError(w, q, "available scenarios: "+strings.Join(names, ", "))
+		return
+	}
+	scenarioName := strings.ToLower(labels[len(labels)-1])
+	s, ok := scenarios[scenarioName]
+	if !ok {
+		txtError(w, q, "unknown scenario "+scenarioName)
+		return
+	}
+	n := int(scenarioPositions.incr(strings.ToLower(name), scenarioMemory)) - 1
+	serveStep(w, q, s.step(n), scenarioName+"."+zone("scenario"))
+}
+
+// step returns the step of s that answers query n for a name, counting from
+// zero.
+func (s *scenario) step(n int) string {
+	if n >= len(s.Steps) {
+		if s.Then == "restart" {
+			n %= len(s.Steps)
+		} else {
+			n = len(s.Steps) - 1
+		}
+	}
+	return s.Steps[n]
+}
+
+// serveStep answers q with a scenario step, as described above, for names
+// in stepZone.
+func serveStep(w dns.ResponseWriter, q *dns.Msg, step, stepZone string) {
+	name := qname(q)
+	m := new(dns.Msg)
+	m.SetRcode(q, dns.RcodeSuccess)
+	switch strings.ToLower(step) {
+	case "answer":
+		healthyAnswer(m, q, stepZone)
+	case "referral":
+		m.Ns, m.Extra = delegation(name, 0)
+	case "servfail":
+		m.Rcode = dns.RcodeServerFailure
+	case "nxdomain":
+		m.Rcode = dns.RcodeNameError
+		m.Authoritative = true
+		m.Ns = []dns.RR{soaRecord(stepZone)}
+	case "refused":
+		m.Rcode = dns.RcodeRefused
+	case "formerr":
+		m.Rcode = dns.RcodeFormatError
+	case "truncate":
+		m.Truncated = true
+	case "drop":
+		return
+	case "badsig":
+		healthyAnswer(m, q, stepZone)
+		if len(m.Answer) > 0 {
+			m.Answer = append(m.Answer, badRRSIG(m.Answer[0], stepZone))
+		}
+	default:
+		serveAs(w, q, dns.Fqdn(step+"."+*basename))
+		return
+	}
+	w.WriteMsg(m)
+}
+
+// badRRSIG returns an RRSIG over rr's RRset, by signer, whose signature is
+// made up.
+func badRRSIG(rr dns.RR, signer string) dns.RR {
+	hdr := rr.Header()
+	now := signingTime(hdr.Name)
+	var sig []byte
+	for i := 0; len(sig) < 64; i++ {
+		sig = append(sig, nameHash(hdr.Name, int(now.Unix())+i)...)
+	}
+	return &dns.RRSIG{
+		Hdr:         dns.RR_Header{Name: hdr.Name, Rrtype: dns.TypeRRSIG, Class: dns.ClassINET, Ttl: hdr.Ttl},
+		TypeCovered: hdr.Rrtype,
+		Algorithm:   dns.ECDSAP256SHA256,
+		Labels:      uint8(dns.CountLabel(hdr.Name)),
+		OrigTtl:     hdr.Ttl,
+		Expiration:  uint32(now.Add(24 * time.Hour).Unix()),
+		Inception:   uint32(now.Add(-time.Hour).Unix()),
+		KeyTag:      1,
+		SignerName:  signer,
+		Signature:   base64.StdEncoding.EncodeToString(sig),
+	}
+}
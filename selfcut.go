@@ -0,0 +1,108 @@
+package main
+
+import (
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// Under selfcut.<base>, every name queried is delegated to a zone of its
+// own, with the cut at the very name, and served by ns.<base>. This process
+// plays both the parent and the child: as under ghost.<base>, a client that
+// hasn't been handed the referral for a name within the last
+// selfCutParentTTL is talking to the parent, and otherwise to the child,
+// which answers for the name as the apex of its zone. DS queries for the name
+// always get the parent's answer.
+//
+// The signed variant is <anything>.selfcut.signed.<base>, where the parent is
+// part of signed.<base> and the referral carries a signed DS for the child,
+// which is signed with the same key.
+
+// selfCutParentTTL is the TTL of the parent's delegations.
+const selfCutParentTTL = 60 * time.Second
+
+// selfCutReferrals remembers when each client was last referred to each
+// name.
+var selfCutReferrals = newCounters("selfcut")
+
+// selfCutHandler serves selfcut.<base> and all the zones cut below it.
+func selfCutHandler(w dns.ResponseWriter, q *dns.Msg) {
+	logQuery(w, q, "selfCutHandler")
+	serveSelfCut(w, q, zone("selfcut"), false)
+}
+
+// serveSelfCut answers q, for a name below parent, as described above. If
+// signed is set, parent is within signed.<base>.
+func serveSelfCut(w dns.ResponseWriter, q *dns.Msg, parent string, signed bool) {
+	name := qname(q)
+	qtype := q.Question[0].Qtype
+	m := new(dns.Msg)
+	m.SetRcode(q, dns.RcodeSuccess)
+	if strings.EqualFold(name, parent) {
+		txtError(w, q, "query a name under "+parent)
+		return
+	}
+	do := false
+	if opt := q.IsEdns0(); opt != nil && opt.Do() {
+		do = signed
+		m.SetEdns0(1232, true)
+	}
+	var ds []dns.RR
+	if signed {
+		d := keyFor(zoneKey, name).ToDS(dns.SHA256)
+		d.Hdr.Ttl = uint32(selfCutParentTTL / time.Second)
+		ds = []dns.RR{d}
+	}
+	if do {
+		ds = signSection(ds, zone("signed"), "signed")
+	}
+
+	if qtype == dns.TypeDS {
+		m.Authoritative = true
+		m.Answer = ds
+		if !signed {
+			m.Ns = []dns.RR{soaRecord(parent)}
+		}
+		w.WriteMsg(m)
+		return
+	}
+
+	ns, _ := nsRRset(name, uint32(selfCutParentTTL/time.Second), zone("ns"))
+	key := clientIP(w) + "|" + strings.ToLower(name)
+	if _, ok := selfCutReferrals.get(key); !ok {
+		selfCutReferrals.set(key, 1, selfCutParentTTL)
+		m.Ns = append(ns, ds...)
+		w.WriteMsg(m)
+		return
+	}
+
+	switch qtype {
+	case dns.TypeNS:
+		m.Authoritative = true
+		m.Answer = ns
+	case dns.TypeSOA:
+		m.Authoritative = true
+		m.Answer = []dns.RR{soaRecord(name)}
+	case dns.TypeDNSKEY:
+		m.Authoritative = true
+		if signed {
+			m.Answer = []dns.RR{keyFor(zoneKey, name)}
+		}
+	default:
+		healthyAnswer(m, q, name)
+	}
+	if len(m.Answer) == 0 && len(m.Ns) == 0 {
+		m.Ns = []dns.RR{soaRecord(name)}
+	}
+	if do {
+		if len(m.Answer) == 0 {
+			nsec := nodataNSEC(name, true).(*dns.NSEC)
+			nsec.TypeBitMap = append([]uint16{dns.TypeA, dns.TypeNS}, nsec.TypeBitMap[1:]...)
+			m.Ns = append(m.Ns, nsec)
+		}
+		m.Answer = signSection(m.Answer, name, "signed")
+		m.Ns = signSection(m.Ns, name, "signed")
+	}
+	w.WriteMsg(m)
+}
@@ -0,0 +1,8 @@
+//go:build !windows
+
+package main
+
+// waitForServers waits for the first error from the servers.
+func waitForServers(errChan <-chan error) error {
+	return <-errChan
+}
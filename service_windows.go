@@ -0,0 +1,61 @@
+//go:build windows
+
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+
+	"golang.org/x/sys/windows/svc"
+)
+
+var serviceLog = flag.String("service-log", "", "file to append the log to when running as a Windows service, whose standard error goes nowhere.")
+
+// awfulService runs the server under the Windows service manager. To install
+// it, give the flags in the service's command line, e.g.
+//
+//	sc.exe create awful start= auto binPath= "C:\awful\awful.exe -base example.com -listen :53 -service-log C:\awful\awful.log"
+type awfulService struct {
+	errChan <-chan error
+}
+
+func (s awfulService) Execute(args []string, requests <-chan svc.ChangeRequest, status chan<- svc.Status) (bool, uint32) {
+	status <- svc.Status{State: svc.Running, Accepts: svc.AcceptStop | svc.AcceptShutdown}
+	for {
+		select {
+		case err := <-s.errChan:
+			log.Print(err)
+			return false, 1
+		case r := <-requests:
+			switch r.Cmd {
+			case svc.Interrogate:
+				status <- r.CurrentStatus
+			case svc.Stop, svc.Shutdown:
+				status <- svc.Status{State: svc.StopPending}
+				return false, 0
+			}
+		}
+	}
+}
+
+// waitForServers waits for the first error from the servers, or, when the
+// process was started by the Windows service manager, until it stops the
+// service.
+func waitForServers(errChan <-chan error) error {
+	isService, err := svc.IsWindowsService()
+	if err != nil {
+		return err
+	}
+	if !isService {
+		return <-errChan
+	}
+	if *serviceLog != "" {
+		f, err := os.OpenFile(*serviceLog, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+		if err != nil {
+			return err
+		}
+		log.SetOutput(f)
+	}
+	return svc.Run("awful", awfulService{errChan})
+}
@@ -0,0 +1,403 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// Sessions group the queries of one test run. A tester mints a token through
+// the admin API and puts it as a label anywhere in the names they query, as
+// in <token>.800.sleep.<base>. Like option labels, the token is stripped
+// before the query reaches the handler. The queries carrying it, their
+// responses and statistics about them can then be fetched as a whole.
+
+const (
+	// sessionDefaultTTL is how long a session lasts if the tester doesn't
+	// say.
+	sessionDefaultTTL = 24 * time.Hour
+	// sessionMaxQueries is how many queries a session keeps the details
+	// and packets of. Later ones only count towards its statistics.
+	sessionMaxQueries = 10000
+	// sessionMaxPacketBytes is how many bytes of messages a session keeps
+	// the packets of. Giant responses are up to 64KiB each, so a count of
+	// queries doesn't bound them. Queries whose packets would go over it
+	// are treated like those beyond sessionMaxQueries.
+	sessionMaxPacketBytes = 64 << 20
+	// sessionTokenPrefix starts every token, so that other labels needn't
+	// be looked up.
+	sessionTokenPrefix = "sess"
+)
+
+// A session is everything recorded about the queries carrying one token.
+type session struct {
+	token            string
+	created, expires time.Time
+
+	// The rest is guarded by sessionsMu.
+	stats   map[string]*usage
+	queries []queryRecord
+	packets []capturedPacket
+	// packetBytes is the size of the messages in packets.
+	packetBytes int
+	// dropped counts queries beyond sessionMaxQueries or
+	// sessionMaxPacketBytes.
+	dropped int
+}
+
+// queryRecord describes one query, for sessions and webhooks.
+type queryRecord struct {
+	Time      time.Time `json:"time"`
+	Client    string    `json:"client"`
+	Transport string    `json:"transport"`
+	Name      string    `json:"name"`
+	Type      string    `json:"type"`
+	Handler   string    `json:"handler"`
+	// Rcode is that of the first response, or "" if there was none.
+	Rcode     string  `json:"rcode"`
+	Responses int     `json:"responses"`
+	ElapsedMS float64 `json:"elapsed_ms"`
+}
+
+// A capturedPacket is a DNS message sent or received in a session.
+type capturedPacket struct {
+	at       time.Time
+	src, dst netip.AddrPort
+	payload  []byte
+}
+
+// A capturedWrite is a message written by a handler.
+type capturedWrite struct {
+	at   time.Time
+	wire []byte
+}
+
+var (
+	sessionsMu sync.Mutex
+	// sessions holds the sessions this instance knows of, with what it
+	// recorded of them.
+	sessions = make(map[string]*session)
+	// sessionTimes holds when each live session was created and expires,
+	// in Unix nanoseconds, under "<token>|created" and "<token>|expires".
+	// With -redis that is how instances learn of the sessions minted by
+	// others. Each logs the queries it answers itself, but the counters
+	// handlers keep per session are shared like the rest.
+	sessionTimes = newCounters("session")
+)
+
+// lookupSession returns the live session whose token is label, or nil.
+func lookupSession(label string) *session {
+	label = strings.ToLower(label)
+	if !strings.HasPrefix(label, sessionTokenPrefix) {
+		return nil
+	}
+	s := knownSession(label)
+	if s == nil || !time.Now().Before(s.expires) {
+		return nil
+	}
+	return s
+}
+
+// knownSession returns the session whose token is token, whether this
+// instance has it, live or not, or another instance minted it, or nil.
+func knownSession(token string) *session {
+	sessionsMu.Lock()
+	s := sessions[token]
+	sessionsMu.Unlock()
+	if s != nil {
+		return s
+	}
+	times := sessionTimes.getMany(token+"|created", token+"|expires")
+	if times[0] == 0 || times[1] == 0 {
+		return nil
+	}
+	return addSession(&session{
+		token:   token,
+		created: time.Unix(0, times[0]),
+		expires: time.Unix(0, times[1]),
+		stats:   make(map[string]*usage),
+	})
+}
+
+// addSession adds s to sessions, unless another goroutine got there first,
+// and returns the one that is there. Expired sessions are dropped.
+func addSession(s *session) *session {
+	now := time.Now()
+	sessionsMu.Lock()
+	defer sessionsMu.Unlock()
+	for token, old := range sessions {
+		if !now.Before(old.expires) {
+			delete(sessions, token)
+		}
+	}
+	if old := sessions[s.token]; old != nil {
+		return old
+	}
+	sessions[s.token] = s
+	return s
+}
+
+// record adds a query that was asked as asked, and answered with rw, to the
+// session.
+func (s *session) record(rw *responseWriter, asked *dns.Msg, start time.Time, elapsed time.Duration, retry bool) {
+	entry := newQueryRecord(rw, asked, start, elapsed)
+	local, remote := addrPort(rw.LocalAddr()), addrPort(rw.RemoteAddr())
+	if local.Addr().IsUnspecified() {
+		// Sockets bound to the wildcard address don't know which address
+		// the query was sent to, so assume it was the advertised one.
+		advertised := advertise4
+		if remote.Addr().Is6() && advertise6 != nil {
+			advertised = advertise6
+		}
+		if addr, ok := netip.AddrFromSlice(advertised); ok {
+			local = netip.AddrPortFrom(addr.Unmap(), local.Port())
+		}
+	}
+	var packets []capturedPacket
+	if wire, err := asked.Pack(); err == nil {
+		packets = append(packets, capturedPacket{start, remote, local, wire})
+	}
+	for _, write := range rw.written {
+		packets = append(packets, capturedPacket{write.at, local, remote, write.wire})
+	}
+	size := 0
+	for _, p := range packets {
+		size += len(p.payload)
+	}
+
+	sessionsMu.Lock()
+	defer sessionsMu.Unlock()
+	if s.stats[entry.Handler] == nil {
+		s.stats[entry.Handler] = new(usage)
+	}
+	s.stats[entry.Handler].record(elapsed, retry)
+	if len(s.queries) >= sessionMaxQueries || s.packetBytes+size > sessionMaxPacketBytes {
+		s.dropped++
+		return
+	}
+	s.queries = append(s.queries, entry)
+	s.packets = append(s.packets, packets...)
+	s.packetBytes += size
+}
+
+// newQueryRecord describes q, which was answered with rw.
+func newQueryRecord(rw *responseWriter, q *dns.Msg, start time.Time, elapsed time.Duration) queryRecord {
+	r := queryRecord{
+		Time:      start,
+		Client:    clientIP(rw),
+		Transport: rw.RemoteAddr().Network(),
+		Name:      qname(q),
+		Handler:   rw.handler,
+		Responses: len(rw.written),
+		ElapsedMS: float64(elapsed) / float64(time.Millisecond),
+	}
+	if r.Handler == "" {
+		r.Handler = "unknown"
+	}
+	if len(q.Question) > 0 {
+		r.Type = dns.Type(q.Question[0].Qtype).String()
+	}
+	if len(rw.written) > 0 && len(rw.written[0].wire) >= 4 {
+		r.Rcode = dns.RcodeToString[int(rw.written[0].wire[3]&0xf)]
+	}
+	return r
+}
+
+// addrPort converts a as well as it can. For transports without real
+// addresses the result is the unspecified address.
+func addrPort(a net.Addr) netip.AddrPort {
+	ap, err := netip.ParseAddrPort(a.String())
+	if err != nil {
+		return netip.AddrPortFrom(netip.IPv4Unspecified(), 0)
+	}
+	return netip.AddrPortFrom(ap.Addr().Unmap(), ap.Port())
+}
+
+// sessionsAdminHandler mints a token on POST, optionally lasting
+// ?ttl=<duration>, and responds with it. GET ?token=<token> returns the
+// session's statistics and query log as JSON, or with &format=pcap its
+// packets as a pcap file, as far as this instance recorded them. GET without
+// a token lists the live sessions this instance knows of.
+func sessionsAdminHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodGet {
+		if token := strings.ToLower(r.FormValue("token")); token != "" {
+			showSession(w, r, token)
+			return
+		}
+		sessionsMu.Lock()
+		var lines []string
+		now := time.Now()
+		for token, s := range sessions {
+			if now.Before(s.expires) {
+				lines = append(lines, fmt.Sprintf("%s %d %s", token, len(s.queries)+s.dropped, s.expires.Format(time.RFC3339)))
+			}
+		}
+		sessionsMu.Unlock()
+		sort.Strings(lines)
+		for _, line := range lines {
+			fmt.Fprintln(w, line)
+		}
+		return
+	}
+	if !requirePost(w, r) {
+		return
+	}
+	ttl := sessionDefaultTTL
+	if s := r.FormValue("ttl"); s != "" {
+		var err error
+		if ttl, err = time.ParseDuration(s); err != nil || ttl <= 0 {
+			http.Error(w, fmt.Sprintf("bad ttl %q", s), http.StatusBadRequest)
+			return
+		}
+	}
+	fmt.Fprintln(w, newSession(ttl).token)
+}
+
+// newSession mints a token for a session lasting ttl.
+func newSession(ttl time.Duration) *session {
+	b := make([]byte, 6)
+	rand.Read(b)
+	now := time.Now()
+	s := &session{
+		token:   sessionTokenPrefix + hex.EncodeToString(b),
+		created: now,
+		expires: now.Add(ttl),
+		stats:   make(map[string]*usage),
+	}
+	sessionTimes.set(s.token+"|created", s.created.UnixNano(), ttl)
+	sessionTimes.set(s.token+"|expires", s.expires.UnixNano(), ttl)
+	return addSession(s)
+}
+
+// showSession writes out the session with the given token.
+func showSession(w http.ResponseWriter, r *http.Request, token string) {
+	s := knownSession(token)
+	if s == nil {
+		http.Error(w, "no such session", http.StatusNotFound)
+		return
+	}
+	sessionsMu.Lock()
+	defer sessionsMu.Unlock()
+	if r.FormValue("format") == "pcap" {
+		w.Header().Set("Content-Type", "application/vnd.tcpdump.pcap")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", token+".pcap"))
+		writePcap(w, s.packets)
+		return
+	}
+	body, err := json.MarshalIndent(struct {
+		Token           string            `json:"token"`
+		Created         time.Time         `json:"created"`
+		Expires         time.Time         `json:"expires"`
+		HistogramBounds []float64         `json:"histogram_bounds_ms"`
+		Handlers        map[string]*usage `json:"handlers"`
+		Queries         []queryRecord     `json:"queries"`
+		Dropped         int               `json:"queries_not_logged"`
+	}{s.token, s.created, s.expires, histogramBounds, s.stats, s.queries, s.dropped}, "", "  ")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(body)
+}
+
+// writePcap writes packets as a pcap file of raw IP packets. Every message is
+// put in a UDP datagram between the real addresses and ports, whatever
+// transport actually carried it, and cut short if it doesn't fit one.
+func writePcap(w io.Writer, packets []capturedPacket) error {
+	const linktypeRaw = 101
+	header := make([]byte, 24)
+	binary.LittleEndian.PutUint32(header[0:], 0xa1b2c3d4)
+	binary.LittleEndian.PutUint16(header[4:], 2)
+	binary.LittleEndian.PutUint16(header[6:], 4)
+	binary.LittleEndian.PutUint32(header[16:], 65535)
+	binary.LittleEndian.PutUint32(header[20:], linktypeRaw)
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+	for _, p := range packets {
+		packet := ipUDPPacket(p.src, p.dst, p.payload)
+		record := make([]byte, 16, 16+len(packet))
+		binary.LittleEndian.PutUint32(record[0:], uint32(p.at.Unix()))
+		binary.LittleEndian.PutUint32(record[4:], uint32(p.at.Nanosecond()/1000))
+		binary.LittleEndian.PutUint32(record[8:], uint32(len(packet)))
+		binary.LittleEndian.PutUint32(record[12:], uint32(len(packet)))
+		if _, err := w.Write(append(record, packet...)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ipUDPPacket returns an IPv4 or IPv6 packet carrying payload in a UDP
+// datagram from src to dst. If only one of them is IPv6, the other is used
+// in its IPv4-mapped form.
+func ipUDPPacket(src, dst netip.AddrPort, payload []byte) []byte {
+	v6 := src.Addr().Is6() || dst.Addr().Is6()
+	ipHeaderLen := 20
+	if v6 {
+		ipHeaderLen = 40
+	}
+	if max := 65535 - ipHeaderLen - 8; len(payload) > max {
+		payload = payload[:max]
+	}
+	udp := make([]byte, 8, 8+len(payload))
+	binary.BigEndian.PutUint16(udp[0:], src.Port())
+	binary.BigEndian.PutUint16(udp[2:], dst.Port())
+	binary.BigEndian.PutUint16(udp[4:], uint16(8+len(payload)))
+	udp = append(udp, payload...)
+
+	var ip, pseudo []byte
+	if v6 {
+		s, d := src.Addr().As16(), dst.Addr().As16()
+		ip = make([]byte, 8, 40)
+		ip[0] = 0x60
+		binary.BigEndian.PutUint16(ip[4:], uint16(len(udp)))
+		ip[6], ip[7] = 17, 64
+		ip = append(append(ip, s[:]...), d[:]...)
+		pseudo = append(append([]byte(nil), ip[8:40]...), 0, 0, byte(len(udp)>>8), byte(len(udp)), 0, 0, 0, 17)
+	} else {
+		s, d := src.Addr().As4(), dst.Addr().As4()
+		ip = make([]byte, 12, 20)
+		ip[0] = 0x45
+		binary.BigEndian.PutUint16(ip[2:], uint16(20+len(udp)))
+		ip[6] = 0x40 // don't fragment
+		ip[8], ip[9] = 64, 17
+		ip = append(append(ip, s[:]...), d[:]...)
+		binary.BigEndian.PutUint16(ip[10:], internetChecksum(ip))
+		pseudo = append(append([]byte(nil), ip[12:20]...), 0, 17, byte(len(udp)>>8), byte(len(udp)))
+	}
+	sum := internetChecksum(append(pseudo, udp...))
+	if sum == 0 {
+		sum = 0xffff
+	}
+	binary.BigEndian.PutUint16(udp[6:], sum)
+	return append(ip, udp...)
+}
+
+// internetChecksum returns the RFC 1071 checksum of b.
+func internetChecksum(b []byte) uint16 {
+	var sum uint32
+	for i := 0; i+1 < len(b); i += 2 {
+		sum += uint32(b[i])<<8 | uint32(b[i+1])
+	}
+	if len(b)%2 == 1 {
+		sum += uint32(b[len(b)-1]) << 8
+	}
+	for sum > 0xffff {
+		sum = sum>>16 + sum&0xffff
+	}
+	return ^uint16(sum)
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// A counterStore keeps counters that disappear after a TTL.
+type counterStore interface {
+	// get returns the value stored under key, if it hasn't expired.
+	get(key string) (int64, bool)
+	// getMany returns the values stored under keys, in one go, with zero
+	// for those that are missing or expired.
+	getMany(keys []string) []int64
+	// set stores value under key for ttl. A ttl of zero or less removes
+	// the entry instead.
+	set(key string, value int64, ttl time.Duration)
+	// incr adds one to the value stored under key, treating a missing or
+	// expired entry as zero, and returns the result. The entry's TTL is
+	// reset, and with a ttl of zero or less the entry is removed.
+	incr(key string, ttl time.Duration) int64
+}
+
+// sharedStore, if set, holds the counters of all handlers instead of their
+// own expiringMaps, so that several instances behind a load balancer can
+// share them.
+var sharedStore counterStore
+
+// counters are what handlers keep their state in. They live in the handler's
+// own expiringMap, unless there is a sharedStore.
+type counters struct {
+	// namespace keeps the keys of different handlers apart in the
+	// sharedStore.
+	namespace string
+	local     *expiringMap
+}
+
+func newCounters(namespace string) *counters {
+	return &counters{namespace: namespace, local: newExpiringMap()}
+}
+
+func (c *counters) get(key string) (int64, bool) {
+	if sharedStore != nil {
+		return sharedStore.get(c.namespace + "|" + key)
+	}
+	return c.local.get(key)
+}
+
+func (c *counters) getMany(keys ...string) []int64 {
+	if sharedStore != nil {
+		prefixed := make([]string, len(keys))
+		for i, key := range keys {
+			prefixed[i] = c.namespace + "|" + key
+		}
+		return sharedStore.getMany(prefixed)
+	}
+	return c.local.getMany(keys)
+}
+
+func (c *counters) set(key string, value int64, ttl time.Duration) {
+	if sharedStore != nil {
+		sharedStore.set(c.namespace+"|"+key, value, ttl)
+		return
+	}
+	c.local.set(key, value, ttl)
+}
+
+func (c *counters) incr(key string, ttl time.Duration) int64 {
+	if sharedStore != nil {
+		return sharedStore.incr(c.namespace+"|"+key, ttl)
+	}
+	return c.local.incr(key, ttl)
+}
+
+// expiringMap is a concurrency-safe map of counters whose entries disappear
+// after a TTL, and the default counterStore. Handlers use it to remember
+// things about recent clients and names without growing without bound.
+type expiringMap struct {
+	sync.Mutex
+	entries map[string]expiringEntry
+	// writes counts insertions since the last sweep of expired entries.
+	writes int
+}
+
+type expiringEntry struct {
+	value   int64
+	expires time.Time
+}
+
+// sweepInterval is how many insertions happen between sweeps of expired
+// entries.
+const sweepInterval = 1024
+
+func newExpiringMap() *expiringMap {
+	return &expiringMap{entries: make(map[string]expiringEntry)}
+}
+
+func (e *expiringMap) get(key string) (int64, bool) {
+	e.Lock()
+	defer e.Unlock()
+	entry, ok := e.entries[key]
+	if !ok || time.Now().After(entry.expires) {
+		return 0, false
+	}
+	return entry.value, true
+}
+
+func (e *expiringMap) getMany(keys []string) []int64 {
+	e.Lock()
+	defer e.Unlock()
+	now := time.Now()
+	values := make([]int64, len(keys))
+	for i, key := range keys {
+		if entry, ok := e.entries[key]; ok && !now.After(entry.expires) {
+			values[i] = entry.value
+		}
+	}
+	return values
+}
+
+func (e *expiringMap) set(key string, value int64, ttl time.Duration) {
+	e.Lock()
+	defer e.Unlock()
+	if ttl <= 0 {
+		delete(e.entries, key)
+		return
+	}
+	e.store(key, value, time.Now().Add(ttl))
+}
+
+func (e *expiringMap) incr(key string, ttl time.Duration) int64 {
+	e.Lock()
+	defer e.Unlock()
+	now := time.Now()
+	entry := e.entries[key]
+	if now.After(entry.expires) {
+		entry.value = 0
+	}
+	entry.value++
+	if ttl <= 0 {
+		delete(e.entries, key)
+		return entry.value
+	}
+	e.store(key, entry.value, now.Add(ttl))
+	return entry.value
+}
+
+// store must be called with the lock held.
+func (e *expiringMap) store(key string, value int64, expires time.Time) {
+	e.entries[key] = expiringEntry{value: value, expires: expires}
+	e.writes++
+	if e.writes < sweepInterval {
+		return
+	}
+	e.writes = 0
+	now := time.Now()
+	for k, entry := range e.entries {
+		if now.After(entry.expires) {
+			delete(e.entries, k)
+		}
+	}
+}
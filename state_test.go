@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// testStores returns the counterStores to test: an expiringMap, and a
+// redisStore if AWFUL_TEST_REDIS is the host:port of a Redis server to test
+// against.
+func testStores(t *testing.T) map[string]counterStore {
+	stores := map[string]counterStore{"expiringMap": newExpiringMap()}
+	if addr := os.Getenv("AWFUL_TEST_REDIS"); addr != "" {
+		client := redis.NewClient(&redis.Options{Addr: addr})
+		t.Cleanup(func() { client.Close() })
+		prefix := fmt.Sprintf("awfultest:%d:", time.Now().UnixNano())
+		stores["redisStore"] = &redisStore{client: client, prefix: prefix}
+	} else {
+		t.Log("AWFUL_TEST_REDIS not set, not testing redisStore")
+	}
+	return stores
+}
+
+func TestStoreZeroTTL(t *testing.T) {
+	for name, store := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			store.set("set", 1, time.Minute)
+			store.set("set", 2, 0)
+			if v, ok := store.get("set"); ok {
+				t.Errorf("get after set with ttl 0 = %d, want nothing", v)
+			}
+			store.set("negative", 1, -time.Second)
+			if v, ok := store.get("negative"); ok {
+				t.Errorf("get after set with negative ttl = %d, want nothing", v)
+			}
+
+			if v := store.incr("incr", time.Minute); v != 1 {
+				t.Errorf("first incr = %d, want 1", v)
+			}
+			if v := store.incr("incr", 0); v != 2 {
+				t.Errorf("incr with ttl 0 = %d, want 2", v)
+			}
+			if v, ok := store.get("incr"); ok {
+				t.Errorf("get after incr with ttl 0 = %d, want nothing", v)
+			}
+			if v := store.incr("incr", time.Minute); v != 1 {
+				t.Errorf("incr after incr with ttl 0 = %d, want 1", v)
+			}
+		})
+	}
+}
+
+func TestStoreTTL(t *testing.T) {
+	for name, store := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			store.set("a", 5, time.Minute)
+			if v, ok := store.get("a"); !ok || v != 5 {
+				t.Errorf("get = %d, %t, want 5, true", v, ok)
+			}
+			if v := store.incr("a", time.Minute); v != 6 {
+				t.Errorf("incr = %d, want 6", v)
+			}
+			store.set("short", 1, 50*time.Millisecond)
+			time.Sleep(100 * time.Millisecond)
+			if v, ok := store.get("short"); ok {
+				t.Errorf("get after expiry = %d, want nothing", v)
+			}
+			values := store.getMany([]string{"a", "missing", "short"})
+			if values[0] != 6 || values[1] != 0 || values[2] != 0 {
+				t.Errorf("getMany = %v, want [6 0 0]", values)
+			}
+		})
+	}
+}
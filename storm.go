@@ -0,0 +1,44 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+var trapBudget = flag.Int("trap-budget", 10000, "number of queries a client may send into a trap such as cnamepit or manycuts without pausing for -trap-idle, after which it gets NXDOMAIN until it does pause. 0 means no limit.")
+var trapIdle = flag.Duration("trap-idle", time.Minute, "how long a client must leave a trap alone for its -trap-budget to be restored.")
+
+// trapQueries counts, for each client and trap, the queries sent without a
+// pause of -trap-idle.
+var trapQueries = newCounters("trap")
+
+// disarming wraps the handler of a trap, i.e. a handler that keeps resolvers
+// busy for as long as they are willing to follow it. Once a client has spent
+// its -trap-budget, the trap is disarmed for that client and answers NXDOMAIN,
+// so that an unattended instance doesn't hold on to a stuck resolver forever.
+func disarming(trap string, h dns.HandlerFunc) dns.HandlerFunc {
+	return func(w dns.ResponseWriter, q *dns.Msg) {
+		if *trapBudget <= 0 {
+			h(w, q)
+			return
+		}
+		client := clientIP(w)
+		n := trapQueries.incr(client+"|"+trap, *trapIdle)
+		if n <= int64(*trapBudget) {
+			h(w, q)
+			return
+		}
+		if n == int64(*trapBudget)+1 {
+			log.Printf("storm: %s sent %d queries into %s without pausing, disarming it until %s of silence",
+				client, *trapBudget, trap, *trapIdle)
+		}
+		m := new(dns.Msg)
+		m.SetRcode(q, dns.RcodeNameError)
+		m.Authoritative = true
+		m.Ns = []dns.RR{soaRecord(zone(trap))}
+		w.WriteMsg(m)
+	}
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+var tcpIdle = flag.Duration("tcp-idle-timeout", 8*time.Second, "how long a plain TCP connection may sit idle between queries before it is closed.")
+var tcpMaxQueries = flag.Int("tcp-max-queries", 128, "number of queries answered on a plain TCP connection before it is closed. 0 means no limit.")
+var tcpClose = flag.String("tcp-close", "fin", "how plain TCP connections are closed, by handlers or once idle or used up: fin, or rst to reset them.")
+var tcpHangup = flag.Int("tcp-hangup", 0, "close every plain TCP connection as soon as its nth query has been read, leaving that query unanswered. 0 disables it.")
+
+// checkTCPPolicy checks the flags setting how plain TCP connections are
+// handled.
+func checkTCPPolicy() error {
+	if *tcpClose != "fin" && *tcpClose != "rst" {
+		return fmt.Errorf("-tcp-close must be fin or rst, not %q", *tcpClose)
+	}
+	if *tcpIdle <= 0 {
+		return fmt.Errorf("-tcp-idle-timeout must be positive")
+	}
+	if *tcpMaxQueries < 0 || *tcpHangup < 0 {
+		return fmt.Errorf("-tcp-max-queries and -tcp-hangup can't be negative")
+	}
+	return nil
+}
+
+// tcpServer returns a server for the plain TCP connections accepted by l,
+// following the flags above.
+func tcpServer(l net.Listener) *dns.Server {
+	limit := *tcpMaxQueries
+	if limit == 0 {
+		limit = -1
+	}
+	return &dns.Server{
+		Listener:      trackingListener{l, &tcpConns},
+		Net:           "tcp",
+		Handler:       dns.HandlerFunc(serveQuery),
+		IdleTimeout:   func() time.Duration { return *tcpIdle },
+		MaxTCPQueries: limit,
+	}
+}
+
+// tcpConns holds the open connections accepted by the plain TCP listeners,
+// keyed by local and remote address, so that handlers can get at the
+// connection a query arrived on.
+var tcpConns sync.Map
+
+// dotConns holds the open DoT connections, like tcpConns.
+var dotConns sync.Map
+
+// A trackingListener records the connections it accepts in conns, which is
+// tcpConns or dotConns.
+type trackingListener struct {
+	net.Listener
+	conns *sync.Map
+}
+
+func (l trackingListener) Accept() (net.Conn, error) {
+	c, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	tc := &trackedConn{Conn: c, conns: l.conns}
+	l.conns.Store(connKey(c.LocalAddr(), c.RemoteAddr()), tc)
+	return tc, nil
+}
+
+// A trackedConn removes itself from its map when closed, and a plain TCP one
+// is reset rather than closed with a FIN if -tcp-close is rst.
+type trackedConn struct {
+	net.Conn
+	conns *sync.Map
+	// queries counts the queries read from the connection, once -tcp-hangup
+	// is set.
+	queries atomic.Int64
+}
+
+func (c *trackedConn) Close() error {
+	c.conns.CompareAndDelete(connKey(c.LocalAddr(), c.RemoteAddr()), c)
+	if c.conns == &tcpConns && *tcpClose == "rst" {
+		if err := lingerZero(c.Conn); err != nil {
+			log.Printf("resetting TCP connection: %s", err)
+		}
+	}
+	return c.Conn.Close()
+}
+
+// hangUp closes the plain TCP connection of w, without answering q, if q is
+// the -tcp-hangup'th query read from it, and reports whether it did.
+func hangUp(w dns.ResponseWriter, q *dns.Msg) bool {
+	if *tcpHangup == 0 {
+		return false
+	}
+	c, ok := tcpConnFor(w).(*trackedConn)
+	if !ok || c.queries.Add(1) != int64(*tcpHangup) {
+		return false
+	}
+	log.Printf("hanging up on %s after reading query %d, for %q", w.RemoteAddr(), *tcpHangup, qname(q))
+	w.Close()
+	return true
+}
+
+func connKey(local, remote net.Addr) string {
+	return local.String() + "|" + remote.String()
+}
+
+// tcpConnFor returns the TCP connection that the query being answered with w
+// arrived on, or nil if it didn't arrive over plain TCP. Anything written to
+// it goes to the client as is, without a length prefix.
+func tcpConnFor(w dns.ResponseWriter) net.Conn {
+	c, ok := tcpConns.Load(connKey(w.LocalAddr(), w.RemoteAddr()))
+	if !ok {
+		return nil
+	}
+	return c.(net.Conn)
+}
+
+// dotConnFor returns the DoT connection that the query being answered with w
+// arrived on, or nil if it didn't arrive over DoT. Anything written to it goes
+// to the client as is, encrypted but without a length prefix.
+func dotConnFor(w dns.ResponseWriter) net.Conn {
+	c, ok := dotConns.Load(connKey(w.LocalAddr(), w.RemoteAddr()))
+	if !ok {
+		return nil
+	}
+	return c.(net.Conn)
+}
+
+// NetConn returns the connection c wraps.
+func (c *trackedConn) NetConn() net.Conn {
+	return c.Conn
+}
+
+// resetTCP closes c, which must have come from a trackingListener, with a
+// RST rather than a FIN.
+func resetTCP(c net.Conn) error {
+	if err := lingerZero(c); err != nil {
+		return err
+	}
+	return c.Close()
+}
+
+// lingerZero sets a linger time of zero on the TCP connection underneath c,
+// if there is one, so that closing it sends a RST.
+func lingerZero(c net.Conn) error {
+	for {
+		switch conn := c.(type) {
+		case *net.TCPConn:
+			return conn.SetLinger(0)
+		case interface{ NetConn() net.Conn }:
+			c = conn.NetConn()
+		default:
+			return nil
+		}
+	}
+}
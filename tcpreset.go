@@ -0,0 +1,68 @@
+package main
+
+import (
+	"encoding/binary"
+	"log"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// tcpResetHandler serves names of the form <anything>.<variant>.tcpreset.<base>
+// over TCP by cutting the connection, at a point that depends on variant:
+//
+//	partial  after the length prefix and the first half of a healthy answer,
+//	         with a RST
+//	fin      at the same point, but closed with an orderly FIN, so the
+//	         client reads a clean end of stream in the middle of the message
+//	early    with a RST, before anything is written
+//
+// Over UDP the response is empty and truncated, sending the client to TCP.
+func tcpResetHandler(w dns.ResponseWriter, q *dns.Msg) {
+	logQuery(w, q, "tcpResetHandler")
+	labels := subLabels(qname(q), zone("tcpreset"))
+	if len(labels) == 0 {
+		txtError(w, q, "query <anything>.<variant>.tcpreset.<base> with variant partial, fin or early")
+		return
+	}
+	variant := strings.ToLower(labels[len(labels)-1])
+	switch variant {
+	case "partial", "fin", "early":
+	default:
+		txtError(w, q, "unknown variant "+variant)
+		return
+	}
+	m := new(dns.Msg)
+	m.SetRcode(q, dns.RcodeSuccess)
+	conn := tcpConnFor(w)
+	if conn == nil {
+		m.Truncated = true
+		w.WriteMsg(m)
+		return
+	}
+	if variant == "early" {
+		if err := resetTCP(conn); err != nil {
+			log.Printf("resetting connection: %s", err)
+		}
+		return
+	}
+
+	healthyAnswer(m, q, zone("tcpreset"))
+	wire, err := packed(w, m)
+	if err != nil {
+		log.Printf("packing response: %s", err)
+		return
+	}
+	framed := binary.BigEndian.AppendUint16(nil, uint16(len(wire)))
+	framed = append(framed, wire[:len(wire)/2]...)
+	if _, err := conn.Write(framed); err != nil {
+		log.Printf("writing partial response: %s", err)
+	}
+	if variant == "fin" {
+		w.Close()
+		return
+	}
+	if err := resetTCP(conn); err != nil {
+		log.Printf("resetting connection: %s", err)
+	}
+}
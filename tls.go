@@ -0,0 +1,105 @@
+package main
+
+import (
+	"crypto/tls"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+
+	"github.com/miekg/dns"
+)
+
+var tlsListen = flag.String("tls-listen", "", "address for a DNS over TLS listener, e.g. :853. Disabled if empty.")
+var tlsCert = flag.String("tls-cert", "", "PEM certificate chain for the TLS listeners.")
+var tlsKey = flag.String("tls-key", "", "PEM private key for the TLS listeners.")
+var dotALPN = flag.String("dot-alpn", "dot", "ALPN behavior of the DoT listener: dot to negotiate \"dot\", none to ignore ALPN entirely, or mismatch to only offer \"h2\", which fails the handshake for clients that ask for \"dot\".")
+var tlsClientAuth = flag.String("tls-client-auth", "none", "client certificate demands of the DoT listener: none, request, require, request-then-reject or require-then-reject. The -then-reject variants complete the handshake and then hang up on clients that presented a certificate.")
+
+// tlsConfig returns the configuration shared by the TLS listeners.
+func tlsConfig() (*tls.Config, error) {
+	if *tlsCert == "" || *tlsKey == "" {
+		return nil, fmt.Errorf("TLS listeners need -tls-cert and -tls-key")
+	}
+	cert, err := tls.LoadX509KeyPair(*tlsCert, *tlsKey)
+	if err != nil {
+		return nil, err
+	}
+	return &tls.Config{Certificates: []tls.Certificate{cert}}, nil
+}
+
+// dotServer returns a DNS over TLS server listening on addr.
+func dotServer(addr string) (*dns.Server, error) {
+	config, err := tlsConfig()
+	if err != nil {
+		return nil, err
+	}
+	switch *dotALPN {
+	case "dot":
+		config.NextProtos = []string{"dot"}
+	case "none":
+	case "mismatch":
+		config.NextProtos = []string{"h2"}
+	default:
+		return nil, fmt.Errorf("unknown -dot-alpn %q", *dotALPN)
+	}
+	reject := false
+	switch *tlsClientAuth {
+	case "none":
+	case "request":
+		config.ClientAuth = tls.RequestClientCert
+	case "require":
+		config.ClientAuth = tls.RequireAnyClientCert
+	case "request-then-reject":
+		config.ClientAuth = tls.RequestClientCert
+		reject = true
+	case "require-then-reject":
+		config.ClientAuth = tls.RequireAnyClientCert
+		reject = true
+	default:
+		return nil, fmt.Errorf("unknown -tls-client-auth %q", *tlsClientAuth)
+	}
+
+	l, err := listenTCP(addr)
+	if err != nil {
+		return nil, err
+	}
+	var listener net.Listener = tls.NewListener(l, config)
+	if reject {
+		listener = certRejectingListener{listener}
+	}
+	return &dns.Server{
+		Listener: trackingListener{listener, &dotConns},
+		Net:      "tcp-tls",
+		Handler:  dns.HandlerFunc(serveQuery),
+	}, nil
+}
+
+// certRejectingListener hangs up on any client that presents a certificate,
+// but only once the TLS handshake has fully completed.
+type certRejectingListener struct {
+	net.Listener
+}
+
+func (l certRejectingListener) Accept() (net.Conn, error) {
+	c, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return &certRejectingConn{Conn: c.(*tls.Conn)}, nil
+}
+
+type certRejectingConn struct {
+	*tls.Conn
+}
+
+func (c *certRejectingConn) Read(b []byte) (int, error) {
+	if err := c.Handshake(); err != nil {
+		return 0, err
+	}
+	if len(c.ConnectionState().PeerCertificates) > 0 {
+		c.Close()
+		return 0, io.EOF
+	}
+	return c.Conn.Read(b)
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"encoding/binary"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// trickleDefaultDelay is the pause between bytes when the name doesn't give
+// one.
+const trickleDefaultDelay = time.Second
+
+// trickleHandler serves names of the form [<anything>.][<ms>.]trickle.<base>
+// over TCP with a healthy answer that is written, length prefix and all, one
+// byte at a time, pausing ms milliseconds (default 1000) before each. A
+// client with a read timeout for the whole response gives up; one that only
+// times out reads that make no progress waits it out. Over UDP the response
+// is empty and truncated, sending the client to TCP.
+func trickleHandler(w dns.ResponseWriter, q *dns.Msg) {
+	logQuery(w, q, "trickleHandler")
+	delay := trickleDefaultDelay
+	if labels := subLabels(qname(q), zone("trickle")); len(labels) > 0 {
+		if ms, err := strconv.ParseUint(labels[len(labels)-1], 10, 16); err == nil {
+			delay = time.Duration(ms) * time.Millisecond
+		}
+	}
+	m := new(dns.Msg)
+	m.SetRcode(q, dns.RcodeSuccess)
+	conn := tcpConnFor(w)
+	if conn == nil {
+		m.Truncated = true
+		w.WriteMsg(m)
+		return
+	}
+	healthyAnswer(m, q, zone("trickle"))
+	wire, err := packed(w, m)
+	if err != nil {
+		log.Printf("packing response: %s", err)
+		return
+	}
+	framed := append(binary.BigEndian.AppendUint16(nil, uint16(len(wire))), wire...)
+	for _, b := range framed {
+		time.Sleep(delay)
+		if _, err := conn.Write([]byte{b}); err != nil {
+			log.Printf("trickling response: %s", err)
+			break
+		}
+	}
+	w.Close()
+}
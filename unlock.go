@@ -0,0 +1,116 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+var requireUnlock = flag.Bool("require-unlock", false, "answer queries to handlers that amplify over UDP, such as bigudp and dupes, only from addresses unlocked through unlock.<base>; others are sent to TCP.")
+var unlockTTL = flag.Duration("unlock-ttl", time.Hour, "how long an address stays unlocked.")
+
+// Some handlers send far more over UDP than they are sent, which a spoofed
+// source address would turn against someone else. With -require-unlock they
+// only do so for addresses that have shown they get the responses sent to
+// them, with a challenge under unlock.<base>:
+//
+//  1. A TXT query for any name under unlock.<base> is answered with a token,
+//     made for the address the query came from.
+//  2. A TXT query for <token>.unlock.<base> from that same address, within
+//     unlockChallengeTTL, unlocks it for -unlock-ttl.
+//
+// Queried through a resolver, it is the resolver's egress address that gets
+// unlocked, so a resolver with several of them may have to be asked more than
+// once. Until then, the UDP queries to the locked handlers get an empty,
+// truncated response, with which no one is flooded, and retry over TCP.
+
+// unlockChallengeTTL is how long a token can be redeemed for.
+const unlockChallengeTTL = 5 * time.Minute
+
+// unlockTokenPrefix starts every token, telling tokens from the names
+// challenges are asked for under.
+const unlockTokenPrefix = "ul"
+
+var (
+	// unlockChallenges holds the tokens handed out, under
+	// "<client>|<token>".
+	unlockChallenges = newCounters("unlockchallenge")
+	// unlocked holds the addresses that are unlocked.
+	unlocked = newCounters("unlocked")
+)
+
+// unlockHandler hands out and redeems the tokens under unlock.<base>.
+func unlockHandler(w dns.ResponseWriter, q *dns.Msg) {
+	logQuery(w, q, "unlockHandler")
+	name := qname(q)
+	client := clientIP(w)
+	labels := subLabels(name, zone("unlock"))
+	m := new(dns.Msg)
+	m.SetRcode(q, dns.RcodeSuccess)
+	m.Authoritative = true
+	if q.Question[0].Qtype != dns.TypeTXT {
+		m.Ns = []dns.RR{soaRecord(zone("unlock"))}
+		w.WriteMsg(m)
+		return
+	}
+	var text string
+	if len(labels) == 1 && strings.HasPrefix(strings.ToLower(labels[0]), unlockTokenPrefix) {
+		token := strings.ToLower(labels[0])
+		if _, ok := unlockChallenges.get(client + "|" + token); ok {
+			unlocked.set(client, 1, *unlockTTL)
+			log.Printf("unlock: %s unlocked for %s", client, *unlockTTL)
+			text = fmt.Sprintf("%s is unlocked for %s", client, *unlockTTL)
+		} else {
+			text = fmt.Sprintf("%s is not a token for %s, or it has expired; query TXT %s again", token, client, zone("unlock"))
+		}
+	} else {
+		b := make([]byte, 8)
+		rand.Read(b)
+		token := unlockTokenPrefix + hex.EncodeToString(b)
+		unlockChallenges.set(client+"|"+token, 1, unlockChallengeTTL)
+		text = fmt.Sprintf("query %s.%s from %s within %s", token, zone("unlock"), client, unlockChallengeTTL)
+	}
+	// Neither the tokens nor the verdicts are any use to anyone else, so
+	// they aren't to be cached.
+	m.Answer = []dns.RR{&dns.TXT{
+		Hdr: dns.RR_Header{Name: name, Rrtype: dns.TypeTXT, Class: dns.ClassINET},
+		Txt: []string{text},
+	}}
+	w.WriteMsg(m)
+}
+
+// locked wraps the handler of one that amplifies over UDP, such that with
+// -require-unlock it only answers UDP queries from unlocked addresses. Other
+// UDP queries get an empty, truncated response, explained in an extended
+// error if they have EDNS.
+func locked(h dns.HandlerFunc) dns.HandlerFunc {
+	return func(w dns.ResponseWriter, q *dns.Msg) {
+		if _, udp := w.RemoteAddr().(*net.UDPAddr); !*requireUnlock || !udp {
+			h(w, q)
+			return
+		}
+		if _, ok := unlocked.get(clientIP(w)); ok {
+			h(w, q)
+			return
+		}
+		m := new(dns.Msg)
+		m.SetRcode(q, dns.RcodeSuccess)
+		m.Truncated = true
+		if q.IsEdns0() != nil {
+			m.SetEdns0(1232, false)
+			opt := m.IsEdns0()
+			opt.Option = append(opt.Option, &dns.EDNS0_EDE{
+				InfoCode:  dns.ExtendedErrorCodeProhibited,
+				ExtraText: "query TXT " + zone("unlock") + " to unlock UDP",
+			})
+		}
+		w.WriteMsg(m)
+	}
+}
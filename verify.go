@@ -0,0 +1,340 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// "awful verify-delegation" checks, from the host the server runs on, that
+// the public DNS sends queries for -base to this instance. It's meant to be
+// run with the same flags as the server, while the server is running, and
+// it prints one line per check, with what to fix for those that fail.
+//
+// The parent zone's servers are asked directly for the delegation of -base,
+// which must point at least one name server at -advertise-ip (or
+// -advertise-ip6), with glue where the name server is below -base. A DS
+// record there is a failure, since -base itself is never signed. Then a
+// public resolver is asked for a fresh name under -base, which it can only
+// answer by reaching this instance from the outside on port 53. Finally the
+// advertised addresses are probed on ports 53, 853 and 443, for those of the
+// listeners that are enabled. These probes come from this host, so they can
+// pass thanks to hairpin NAT while the outside still can't get in; the
+// resolver check is the one that counts for port 53.
+
+// verifyTimeout bounds each query and probe verify-delegation makes.
+const verifyTimeout = 5 * time.Second
+
+// verifier keeps track of the checks verify-delegation has run.
+type verifier struct {
+	out      io.Writer
+	resolver string
+	client   *dns.Client
+	failures int
+}
+
+// verifyDelegation implements the verify-delegation command, with the
+// arguments that follow it. It returns an error if any check failed.
+func verifyDelegation(out io.Writer, args []string) error {
+	fs := flag.NewFlagSet("verify-delegation", flag.ContinueOnError)
+	resolver := fs.String("resolver", "8.8.8.8:53", "public recursive resolver to look names up with.")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := parseAdvertised(); err != nil {
+		return err
+	}
+	v := &verifier{
+		out:      out,
+		resolver: *resolver,
+		client:   &dns.Client{Timeout: verifyTimeout},
+	}
+	v.checkDelegation()
+	v.checkResolution()
+	v.checkPorts()
+	if v.failures > 0 {
+		return fmt.Errorf("%d checks failed", v.failures)
+	}
+	return nil
+}
+
+func (v *verifier) ok(format string, args ...any) {
+	fmt.Fprintf(v.out, "ok    "+format+"\n", args...)
+}
+
+func (v *verifier) warn(format string, args ...any) {
+	fmt.Fprintf(v.out, "warn  "+format+"\n", args...)
+}
+
+func (v *verifier) fail(format string, args ...any) {
+	v.failures++
+	fmt.Fprintf(v.out, "FAIL  "+format+"\n", args...)
+}
+
+// exchange sends a query for name and qtype to server, retrying over TCP if
+// the answer is truncated.
+func (v *verifier) exchange(server, name string, qtype uint16, recurse bool) (*dns.Msg, error) {
+	q := new(dns.Msg)
+	q.SetQuestion(name, qtype)
+	q.RecursionDesired = recurse
+	q.SetEdns0(1232, false)
+	r, _, err := v.client.Exchange(q, server)
+	if err == nil && r.Truncated {
+		tcp := &dns.Client{Net: "tcp", Timeout: verifyTimeout}
+		r, _, err = tcp.Exchange(q, server)
+	}
+	return r, err
+}
+
+// lookup asks the resolver for the addresses of name.
+func (v *verifier) lookup(name string) []net.IP {
+	var addrs []net.IP
+	for _, qtype := range []uint16{dns.TypeA, dns.TypeAAAA} {
+		r, err := v.exchange(v.resolver, name, qtype, true)
+		if err != nil {
+			continue
+		}
+		addrs = append(addrs, addresses(r.Answer, name)...)
+	}
+	return addrs
+}
+
+// addresses returns the addresses in the A and AAAA records for name among
+// rrs.
+func addresses(rrs []dns.RR, name string) []net.IP {
+	var addrs []net.IP
+	for _, rr := range rrs {
+		if !strings.EqualFold(rr.Header().Name, name) {
+			continue
+		}
+		switch rr := rr.(type) {
+		case *dns.A:
+			addrs = append(addrs, rr.A)
+		case *dns.AAAA:
+			addrs = append(addrs, rr.AAAA)
+		}
+	}
+	return addrs
+}
+
+// isAdvertised reports whether addr is one of this instance's addresses.
+func isAdvertised(addr net.IP) bool {
+	return addr.Equal(advertise4) || advertise6 != nil && addr.Equal(advertise6)
+}
+
+// parentServers finds the closest zone above name, through the resolver,
+// and returns it with the addresses of its name servers.
+func (v *verifier) parentServers(name string) (string, []string, error) {
+	for off, end := dns.NextLabel(name, 0); !end; off, end = dns.NextLabel(name, off) {
+		parent := name[off:]
+		r, err := v.exchange(v.resolver, parent, dns.TypeNS, true)
+		if err != nil {
+			return "", nil, err
+		}
+		var servers []string
+		for _, rr := range r.Answer {
+			ns, ok := rr.(*dns.NS)
+			if !ok || !strings.EqualFold(ns.Hdr.Name, parent) {
+				continue
+			}
+			for _, addr := range v.lookup(ns.Ns) {
+				servers = append(servers, net.JoinHostPort(addr.String(), "53"))
+			}
+		}
+		if len(servers) > 0 {
+			return parent, servers, nil
+		}
+	}
+	return "", nil, fmt.Errorf("found no zone above %s", name)
+}
+
+// checkDelegation checks the NS, glue and DS records for -base at the
+// parent.
+func (v *verifier) checkDelegation() {
+	base := dns.Fqdn(*basename)
+	parent, servers, err := v.parentServers(base)
+	if err != nil {
+		v.fail("looking up the zone above %s through %s: %v", base, v.resolver, err)
+		return
+	}
+	var r *dns.Msg
+	var server string
+	for _, server = range servers {
+		if r, err = v.exchange(server, base, dns.TypeNS, false); err == nil {
+			break
+		}
+	}
+	if r == nil {
+		v.fail("none of the name servers of %s answered: %v", parent, err)
+		return
+	}
+
+	var nsNames []string
+	for _, rr := range append(r.Answer, r.Ns...) {
+		if ns, ok := rr.(*dns.NS); ok && strings.EqualFold(ns.Hdr.Name, base) {
+			nsNames = append(nsNames, ns.Ns)
+		}
+	}
+	if len(nsNames) == 0 {
+		v.fail("%s (a name server of %s) has no delegation for %s; add NS records for %s to %s, e.g. %s",
+			server, parent, base, base, parent, zone("ns"))
+		return
+	}
+	v.ok("%s delegates %s to %s", parent, base, strings.Join(nsNames, ", "))
+
+	here := 0
+	for _, name := range nsNames {
+		var addrs []net.IP
+		if dns.IsSubDomain(base, name) {
+			addrs = addresses(r.Extra, name)
+			if len(addrs) == 0 {
+				v.fail("%s is below %s, but %s has no glue for it; add an A record for %s with %s to the delegation",
+					name, base, parent, name, advertise4)
+				continue
+			}
+		} else {
+			addrs = v.lookup(name)
+			if len(addrs) == 0 {
+				v.fail("%s has no addresses in the public DNS", name)
+				continue
+			}
+		}
+		pointsHere := false
+		for _, addr := range addrs {
+			pointsHere = pointsHere || isAdvertised(addr)
+		}
+		if pointsHere {
+			here++
+			v.ok("%s is at %s", name, joinIPs(addrs))
+		} else {
+			v.warn("%s is at %s, not at this instance", name, joinIPs(addrs))
+		}
+	}
+	if here == 0 {
+		v.fail("no name server of %s points at %s; change the delegation or -advertise-ip", base, advertise4)
+	}
+
+	r, err = v.exchange(server, base, dns.TypeDS, false)
+	switch {
+	case err != nil:
+		v.fail("asking %s for the DS records of %s: %v", server, base, err)
+	case len(r.Answer) > 0:
+		v.fail("%s has a DS record for %s, which isn't signed, so validating resolvers reject all answers under it; remove the DS record",
+			parent, base)
+	default:
+		v.ok("%s has no DS record for %s", parent, base)
+	}
+}
+
+// checkResolution asks the resolver for a name under ns.<base> that no one
+// has asked for before, which it has to come to this instance for.
+func (v *verifier) checkResolution() {
+	nonce := make([]byte, 6)
+	rand.Read(nonce)
+	name := "verify-" + hex.EncodeToString(nonce) + "." + zone("ns")
+	r, err := v.exchange(v.resolver, name, dns.TypeA, true)
+	if err != nil {
+		v.fail("asking %s for %s: %v", v.resolver, name, err)
+		return
+	}
+	addrs := addresses(r.Answer, name)
+	if len(addrs) == 1 && isAdvertised(addrs[0]) {
+		v.ok("%s resolves %s to %s through this instance", v.resolver, name, addrs[0])
+		return
+	}
+	v.fail("%s resolves %s to %s with rcode %s; check that UDP and TCP port 53 on %s are open to the outside and forwarded to -listen",
+		v.resolver, name, joinIPs(addrs), dns.RcodeToString[r.Rcode], advertise4)
+}
+
+// checkPorts probes the advertised addresses on the ports of the enabled
+// listeners.
+func (v *verifier) checkPorts() {
+	addrs := []net.IP{advertise4}
+	if advertise6 != nil {
+		addrs = append(addrs, advertise6)
+	}
+	q := new(dns.Msg)
+	q.SetQuestion(zone("ns"), dns.TypeA)
+	// The probes are about reachability, and the certificate may well not
+	// name the address, so it isn't verified.
+	insecure := &tls.Config{InsecureSkipVerify: true}
+	probes := []portProbe{
+		{"53", "udp", probeDNS("udp", nil, q)},
+		{"53", "tcp", probeDNS("tcp", nil, q)},
+	}
+	if *tlsListen != "" {
+		probes = append(probes, portProbe{"853", "DoT", probeDNS("tcp-tls", insecure, q)})
+	}
+	if *httpsListen != "" {
+		probes = append(probes, portProbe{"443", "DoH", probeDoH(insecure, q)})
+	}
+	for _, addr := range addrs {
+		for _, p := range probes {
+			hostport := net.JoinHostPort(addr.String(), p.port)
+			if err := p.probe(hostport); err != nil {
+				v.fail("%s on %s from this host: %v; check the firewall and port forwarding", p.proto, hostport, err)
+			} else {
+				v.ok("%s on %s from this host", p.proto, hostport)
+			}
+		}
+	}
+}
+
+// portProbe is a check that a port on an advertised address speaks a
+// protocol.
+type portProbe struct {
+	port  string
+	proto string
+	probe func(hostport string) error
+}
+
+// probeDNS returns a probe sending q over the given network.
+func probeDNS(network string, config *tls.Config, q *dns.Msg) func(string) error {
+	return func(hostport string) error {
+		c := &dns.Client{Net: network, TLSConfig: config, Timeout: verifyTimeout}
+		_, _, err := c.Exchange(q, hostport)
+		return err
+	}
+}
+
+// probeDoH returns a probe POSTing q to the DoH endpoint.
+func probeDoH(config *tls.Config, q *dns.Msg) func(string) error {
+	return func(hostport string) error {
+		wire, err := q.Pack()
+		if err != nil {
+			return err
+		}
+		c := &http.Client{Timeout: verifyTimeout, Transport: &http.Transport{TLSClientConfig: config}}
+		resp, err := c.Post("https://"+hostport+dohPath, "application/dns-message", bytes.NewReader(wire))
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return fmt.Errorf("HTTP status %s", resp.Status)
+		}
+		return nil
+	}
+}
+
+// joinIPs returns addrs as a comma separated list, or "nothing".
+func joinIPs(addrs []net.IP) string {
+	if len(addrs) == 0 {
+		return "nothing"
+	}
+	var s []string
+	for _, addr := range addrs {
+		s = append(s, addr.String())
+	}
+	return strings.Join(s, ", ")
+}
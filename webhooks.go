@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+var webhooks = flag.String("webhooks", "", "comma separated name=url pairs. Whenever a name relative to -base is queried, the url is sent a POST describing the query. A name starting with *. matches the names below it.")
+
+// webhookTimeout bounds each webhook request.
+const webhookTimeout = 5 * time.Second
+
+var webhookClient = &http.Client{Timeout: webhookTimeout}
+
+// webhookURLs holds the parsed value of -webhooks, keyed by fully qualified
+// name in lowercase, with wildcards keeping their "*.".
+var webhookURLs map[string]string
+
+// parseWebhooks fills in webhookURLs.
+func parseWebhooks() error {
+	values, err := parseHandlerValues(*webhooks)
+	if err != nil {
+		return err
+	}
+	webhookURLs = make(map[string]string)
+	for name, url := range values {
+		if !strings.HasPrefix(url, "http://") && !strings.HasPrefix(url, "https://") {
+			return fmt.Errorf("-webhooks: %q is not an http or https URL", url)
+		}
+		name = strings.ToLower(strings.Trim(name, "."))
+		if name == "" {
+			return fmt.Errorf("-webhooks: empty name for %q", url)
+		}
+		webhookURLs[dns.Fqdn(name+"."+*basename)] = url
+	}
+	return nil
+}
+
+// webhooksFor returns the URLs to notify of a query for name.
+func webhooksFor(name string) []string {
+	if len(webhookURLs) == 0 {
+		return nil
+	}
+	name = strings.ToLower(name)
+	var urls []string
+	if url, ok := webhookURLs[name]; ok {
+		urls = append(urls, url)
+	}
+	for off, end := dns.NextLabel(name, 0); !end; off, end = dns.NextLabel(name, off) {
+		if url, ok := webhookURLs["*."+name[off:]]; ok {
+			urls = append(urls, url)
+		}
+	}
+	return urls
+}
+
+// webhookPayload returns the JSON body describing a query for named, which
+// was answered with rw.
+func webhookPayload(rw *responseWriter, named *dns.Msg, start time.Time, elapsed time.Duration) []byte {
+	var session string
+	if rw.session != nil {
+		session = rw.session.token
+	}
+	body, _ := json.Marshal(struct {
+		queryRecord
+		Session string `json:"session,omitempty"`
+	}{newQueryRecord(rw, named, start, elapsed), session})
+	return body
+}
+
+// notifyWebhook posts body to url.
+func notifyWebhook(url string, body []byte) {
+	resp, err := webhookClient.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		log.Printf("webhook %s: %s", url, err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		log.Printf("webhook %s: %s", url, resp.Status)
+	}
+}